@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/tcpIP"
+	"strconv"
+)
+
+const uso = `Uso: admin [-servidor host:porta] [-operador nome] <comando> [argumentos]
+
+Comandos:
+  conexoes                      lista pontos e veículos conectados
+  fila <ponto>                  exibe a fila do ponto
+  editar-fila <ponto> [placas]  reordena a fila; placas omitidas são retiradas
+  liberar <ponto>               esvazia a fila e libera o ponto
+  cancelar <placa>              cancela a reserva do veículo
+  desconectar ponto <id>        encerra a conexão do ponto
+  desconectar veiculo <placa>   encerra a conexão do veículo
+  compactar                     grava o snapshot do estado e esvazia o diário de eventos
+  senha <placa>                 cadastra a senha de um veículo que ainda não tem senha
+
+A credencial do operador é lida da variável OPERADOR_CREDENCIAL e a senha do
+comando senha, da variável VEICULO_SENHA.
+`
+
+func main() {
+	servidor := flag.String("servidor", "localhost:5000", "endereço do servidor")
+	operador := flag.String("operador", os.Getenv("USER"), "nome do operador cadastrado no servidor")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, uso) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := logger.NewLogger(os.Stderr)
+	tlsConfig, erro := tcpIP.ClientTLSConfig(tcpIP.ArquivosTLSDoAmbiente(), *servidor)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar TLS: %v", erro))
+		os.Exit(1)
+	}
+	conexao, erro := tcpIP.ConnectToServerTCP(*servidor, tlsConfig)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro em ConnectToServerTCP - admin: %v", erro))
+		os.Exit(1)
+	}
+	defer conexao.Close()
+
+	_, erro = tcpIP.SendIdentification(conexao, "operador", dataJson.Identificacao{
+		Credencial: os.Getenv("OPERADOR_CREDENCIAL"),
+		Operador:   *operador,
+	})
+	if erro != nil {
+		var recusa *tcpIP.ErroIdentificacaoRecusada
+		if errors.As(erro, &recusa) {
+			logger.Erro(textoRecusa(recusa.Recusa.Motivo))
+		} else {
+			logger.Erro(fmt.Sprintf("Erro na identificacao: %v", erro))
+		}
+		os.Exit(1)
+	}
+
+	dispatcher := tcpIP.NewDispatcher(conexao, logger)
+	go dispatcher.Run()
+
+	erro = executarComando(dispatcher, flag.Args())
+	if erro != nil {
+		logger.Erro(erro.Error())
+		os.Exit(1)
+	}
+}
+
+func executarComando(dispatcher *tcpIP.Dispatcher, args []string) error {
+	comando, args := args[0], args[1:]
+	switch comando {
+	case "conexoes":
+		return listarConexoes(dispatcher)
+	case "fila":
+		pontoID, erro := argumentoPonto(args)
+		if erro != nil {
+			return erro
+		}
+		return exibirFila(dispatcher, pontoID)
+	case "editar-fila":
+		if len(args) == 0 {
+			return fmt.Errorf("informe o ID do ponto")
+		}
+		pontoID, erro := argumentoPonto(args[:1])
+		if erro != nil {
+			return erro
+		}
+		placas := append([]string{}, args[1:]...)
+		return operacao(dispatcher, "editar-fila", dataJson.PedidoFila{PontoID: pontoID, Placas: placas},
+			fmt.Sprintf("Fila do ponto ID %d atualizada", pontoID))
+	case "liberar":
+		pontoID, erro := argumentoPonto(args)
+		if erro != nil {
+			return erro
+		}
+		return operacao(dispatcher, "forcar-liberacao", dataJson.ForcarLiberacao{PontoID: pontoID},
+			fmt.Sprintf("Ponto ID %d liberado", pontoID))
+	case "cancelar":
+		if len(args) != 1 {
+			return fmt.Errorf("informe a placa do veículo")
+		}
+		return operacao(dispatcher, "cancelar-reserva", dataJson.CancelarReserva{Placa: args[0]},
+			fmt.Sprintf("Reserva do veículo %s cancelada", args[0]))
+	case "desconectar":
+		if len(args) != 2 {
+			return fmt.Errorf("uso: desconectar ponto <id> | desconectar veiculo <placa>")
+		}
+		switch args[0] {
+		case "ponto":
+			pontoID, erro := argumentoPonto(args[1:])
+			if erro != nil {
+				return erro
+			}
+			return operacao(dispatcher, "desconectar-cliente", dataJson.DesconectarCliente{PontoID: pontoID},
+				fmt.Sprintf("Ponto ID %d desconectado", pontoID))
+		case "veiculo":
+			return operacao(dispatcher, "desconectar-cliente", dataJson.DesconectarCliente{Placa: args[1]},
+				fmt.Sprintf("Veículo %s desconectado", args[1]))
+		}
+		return fmt.Errorf("uso: desconectar ponto <id> | desconectar veiculo <placa>")
+	case "compactar":
+		return compactarDiario(dispatcher)
+	case "senha":
+		if len(args) != 1 {
+			return fmt.Errorf("informe a placa do veículo")
+		}
+		senha := os.Getenv("VEICULO_SENHA")
+		if senha == "" {
+			return fmt.Errorf("informe a senha do veículo na variável VEICULO_SENHA")
+		}
+		return operacao(dispatcher, "cadastrar-senha", dataJson.CadastrarSenha{Placa: args[0], Senha: senha},
+			fmt.Sprintf("Senha do veículo %s cadastrada", args[0]))
+	default:
+		return fmt.Errorf("comando desconhecido: %s\n%s", comando, uso)
+	}
+}
+
+func argumentoPonto(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("informe o ID do ponto")
+	}
+	pontoID, erro := strconv.Atoi(args[0])
+	if erro != nil || pontoID <= 0 {
+		return 0, fmt.Errorf("ID de ponto inválido: %s", args[0])
+	}
+	return pontoID, nil
+}
+
+func listarConexoes(dispatcher *tcpIP.Dispatcher) error {
+	resposta, erro := dispatcher.Request("listar-conexoes", "operador", nil)
+	if erro != nil {
+		return fmt.Errorf("erro ao listar conexões: %v", erro)
+	}
+	var lista dataJson.ListaConexoes
+	if erro := resposta.DecodeDados(&lista); erro != nil {
+		return erro
+	}
+
+	fmt.Printf("Pontos conectados (%d):\n", len(lista.Pontos))
+	for _, ponto := range lista.Pontos {
+		fmt.Printf("  ID %-4d %s\n", ponto.ID, ponto.Endereco)
+	}
+	fmt.Printf("Veículos conectados (%d):\n", len(lista.Veiculos))
+	for _, veiculo := range lista.Veiculos {
+		reserva := "-"
+		if veiculo.PontoReservado != 0 {
+			reserva = fmt.Sprintf("reserva no ponto %d", veiculo.PontoReservado)
+		}
+		fmt.Printf("  %-8s %-21s %s\n", veiculo.Placa, veiculo.Endereco, reserva)
+	}
+	return nil
+}
+
+func exibirFila(dispatcher *tcpIP.Dispatcher, pontoID int) error {
+	resposta, erro := dispatcher.Request("consultar-fila", "operador", dataJson.PedidoFila{PontoID: pontoID})
+	if erro != nil {
+		return fmt.Errorf("erro ao consultar fila: %v", erro)
+	}
+	if resposta.Tipo == "operacao-falhou" {
+		return falhaOperacao(resposta)
+	}
+	var fila dataJson.FilaPonto
+	if erro := resposta.DecodeDados(&fila); erro != nil {
+		return erro
+	}
+
+	if len(fila.Placas) == 0 {
+		fmt.Printf("Fila do ponto ID %d vazia\n", pontoID)
+		return nil
+	}
+	fmt.Printf("Fila do ponto ID %d:\n", pontoID)
+	for i, placa := range fila.Placas {
+		fmt.Printf("  %d. %s\n", i+1, placa)
+	}
+	return nil
+}
+
+func compactarDiario(dispatcher *tcpIP.Dispatcher) error {
+	resposta, erro := dispatcher.Request("compactar-diario", "operador", nil)
+	if erro != nil {
+		return fmt.Errorf("erro ao compactar diário: %v", erro)
+	}
+	if resposta.Tipo == "operacao-falhou" {
+		return falhaOperacao(resposta)
+	}
+	var compactado dataJson.DiarioCompactado
+	if erro := resposta.DecodeDados(&compactado); erro != nil {
+		return erro
+	}
+	fmt.Printf("Diário compactado: %d eventos retirados, snapshot até o evento %d\n", compactado.Eventos, compactado.Seq)
+	return nil
+}
+
+// Envia uma operação cuja resposta é operacao-concluida ou operacao-falhou
+func operacao(dispatcher *tcpIP.Dispatcher, tipo string, dados any, sucesso string) error {
+	resposta, erro := dispatcher.Request(tipo, "operador", dados)
+	if erro != nil {
+		return fmt.Errorf("erro ao enviar %s: %v", tipo, erro)
+	}
+	if resposta.Tipo == "operacao-falhou" {
+		return falhaOperacao(resposta)
+	}
+	fmt.Println(sucesso)
+	return nil
+}
+
+func falhaOperacao(resposta dataJson.Mensagem) error {
+	var falha dataJson.OperacaoFalhou
+	if erro := resposta.DecodeDados(&falha); erro != nil {
+		return erro
+	}
+	switch falha.Motivo {
+	case dataJson.MotivoPontoNaoEncontrado:
+		return fmt.Errorf("ponto não conectado")
+	case dataJson.MotivoVeiculoNaoEncontrado:
+		return fmt.Errorf("veículo não conectado")
+	case dataJson.MotivoSemReserva:
+		return fmt.Errorf("o veículo não tem reserva ativa")
+	case dataJson.MotivoFilaDivergente:
+		return fmt.Errorf("a nova fila só pode conter placas que já estão na fila do ponto, sem repetição")
+	case dataJson.MotivoPlacaInvalida:
+		return fmt.Errorf("placa inválida")
+	case dataJson.MotivoFalhaComunicacao:
+		return fmt.Errorf("falha ao comunicar com o ponto")
+	case dataJson.MotivoDiarioIndisponivel:
+		return fmt.Errorf("o servidor não tem diário de eventos")
+	case dataJson.MotivoFalhaCompactacao:
+		return fmt.Errorf("o servidor não conseguiu gravar o snapshot; veja o log do servidor")
+	case dataJson.MotivoSenhaInvalida:
+		return fmt.Errorf("a senha deve ter ao menos %d caracteres", dataJson.TamanhoMinimoSenha)
+	case dataJson.MotivoSenhaJaCadastrada:
+		return fmt.Errorf("o veículo já tem senha cadastrada")
+	case dataJson.MotivoFalhaCadastro:
+		return fmt.Errorf("o servidor não conseguiu gravar a senha; veja o log do servidor")
+	default:
+		return fmt.Errorf("operação recusada pelo servidor: %s", falha.Motivo)
+	}
+}
+
+func textoRecusa(motivo string) string {
+	switch motivo {
+	case dataJson.MotivoCredencialInvalida:
+		return "Operador desconhecido ou credencial inválida"
+	case dataJson.MotivoOperadorDesabilitado:
+		return "O servidor não aceita operadores (OPERADORES não configurada)"
+	default:
+		return fmt.Sprintf("Identificacao recusada pelo servidor: %s", motivo)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/backup"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"strings"
+	"time"
+)
+
+const uso = `Uso: backup [-dados diretório] [-backups diretório] <comando>
+
+Comandos:
+  listar               lista os snapshots, do mais antigo ao mais recente, e confere se podem ser restaurados
+  criar                cria um snapshot de regiao.json e veiculos.json
+  restaurar <nome>     volta os dados ao snapshot informado, ou ao mais recente com "ultimo"
+
+Antes de restaurar, os arquivos do snapshot são validados e o estado atual é
+guardado em um novo snapshot. Pare o servidor antes de restaurar.
+
+Opções:
+  -dados      diretório dos arquivos de dados (padrão: DADOS_DIR ou app/internal/dataJson)
+  -backups    diretório dos snapshots (padrão: BACKUP_DIR ou backups no diretório de dados)
+`
+
+func main() {
+	diretorio := flag.String("dados", dataJson.DiretorioDadosDoAmbiente(), "diretório dos arquivos de dados")
+	diretorioBackup := flag.String("backups", "", "diretório dos snapshots")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, uso) }
+	flag.Parse()
+	if *diretorioBackup == "" {
+		*diretorioBackup = backup.DiretorioDoAmbiente(*diretorio)
+	}
+
+	logger := logger.NewLogger(os.Stderr)
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if erro := dataJson.VerificarDiretorioDados(*diretorio); erro != nil {
+		logger.Erro(erro.Error())
+		os.Exit(1)
+	}
+	if erro := executarComando(*diretorio, *diretorioBackup, flag.Args()); erro != nil {
+		logger.Erro(erro.Error())
+		os.Exit(1)
+	}
+}
+
+func executarComando(diretorio string, diretorioBackup string, argumentos []string) error {
+	switch argumentos[0] {
+	case "listar":
+		snapshots, erro := backup.Listar(diretorioBackup)
+		if erro != nil {
+			return erro
+		}
+		if len(snapshots) == 0 {
+			fmt.Printf("Nenhum snapshot em %s\n", diretorioBackup)
+		}
+		for _, snapshot := range snapshots {
+			situacao := "ok"
+			if _, erro := backup.Validar(snapshot); erro != nil {
+				situacao = "inválido: " + erro.Error()
+			}
+			fmt.Printf("%s  %s  %s  %s\n", snapshot.Nome, snapshot.Data.Format("2006-01-02 15:04:05"), strings.Join(snapshot.Arquivos, ","), situacao)
+		}
+		return nil
+
+	case "criar":
+		snapshot, criado, erro := backup.Criar(diretorio, diretorioBackup, time.Now())
+		if erro != nil {
+			return erro
+		}
+		if !criado {
+			fmt.Printf("Dados sem alteração desde o snapshot %s\n", snapshot.Nome)
+			return nil
+		}
+		fmt.Printf("Snapshot %s criado em %s\n", snapshot.Nome, snapshot.Caminho)
+		return nil
+
+	case "restaurar":
+		if len(argumentos) != 2 {
+			return fmt.Errorf("uso: restaurar <nome>")
+		}
+		snapshot, erro := backup.Buscar(diretorioBackup, argumentos[1])
+		if erro != nil {
+			return erro
+		}
+		anterior, erro := backup.Restaurar(diretorio, diretorioBackup, snapshot, time.Now())
+		if erro != nil {
+			if anterior.Nome != "" {
+				return fmt.Errorf("%v; o estado anterior está no snapshot %s", erro, anterior.Nome)
+			}
+			return erro
+		}
+		fmt.Printf("Dados restaurados do snapshot %s (%s)\n", snapshot.Nome, strings.Join(snapshot.Arquivos, ", "))
+		fmt.Printf("Estado anterior guardado no snapshot %s\n", anterior.Nome)
+		return nil
+	}
+	return fmt.Errorf("comando desconhecido: %s", argumentos[0])
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"recarga-inteligente/internal/certificados"
+	"recarga-inteligente/internal/logger"
+)
+
+// Gera uma CA local e os certificados do servidor e dos pontos de recarga,
+// apenas para desenvolvimento e testes
+func main() {
+	logger := logger.NewLogger(os.Stdout)
+
+	diretorio := flag.String("dir", "certs", "diretorio de saida dos arquivos PEM")
+	totalPontos := flag.Int("pontos", 8, "quantidade de certificados de pontos de recarga (ponto-1 ... ponto-N)")
+	hosts := flag.String("hosts", "localhost,servidor,127.0.0.1", "nomes e IPs do servidor, separados por virgula")
+	dias := flag.Int("dias", 365, "validade dos certificados em dias")
+	flag.Parse()
+
+	validade := time.Duration(*dias) * 24 * time.Hour
+	erro := os.MkdirAll(*diretorio, 0755)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao criar diretorio %s: %v", *diretorio, erro))
+		os.Exit(1)
+	}
+
+	autoridade, certificadoPEM, chavePEM, erro := certificados.GerarAutoridade("recarga-inteligente dev CA", validade)
+	if erro == nil {
+		erro = certificados.Salvar(*diretorio, "ca", certificadoPEM, chavePEM)
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao gerar CA: %v", erro))
+		os.Exit(1)
+	}
+
+	certificadoPEM, chavePEM, erro = autoridade.EmitirServidor("servidor", strings.Split(*hosts, ","), validade)
+	if erro == nil {
+		erro = certificados.Salvar(*diretorio, "servidor", certificadoPEM, chavePEM)
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao gerar certificado do servidor: %v", erro))
+		os.Exit(1)
+	}
+
+	for id := 1; id <= *totalPontos; id++ {
+		nome := certificados.NomePonto(id)
+		certificadoPEM, chavePEM, erro = autoridade.EmitirCliente(nome, validade)
+		if erro == nil {
+			erro = certificados.Salvar(*diretorio, nome, certificadoPEM, chavePEM)
+		}
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao gerar certificado de %s: %v", nome, erro))
+			os.Exit(1)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("CA, servidor e %d pontos de recarga gerados em %s", *totalPontos, *diretorio))
+}
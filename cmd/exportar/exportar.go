@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/exportacao"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+)
+
+const uso = `Uso: exportar [opções]
+
+Exporta as recargas de veiculos.json em CSV ou JSON Lines, com o total de
+cada grupo e o total geral. Pode ser executado com o servidor em
+funcionamento; a mesma exportação está em GET /api/admin/recargas.
+
+Opções:
+  -dados      diretório dos arquivos de dados (padrão: DADOS_DIR ou app/internal/dataJson)
+  -formato    csv ou jsonl (padrão: csv)
+  -agrupar    placa, ponto, dia ou mes (padrão: placa)
+  -de         primeiro dia exportado, AAAA-MM-DD
+  -ate        último dia exportado, AAAA-MM-DD
+  -placa      apenas as recargas desta placa
+  -ponto      apenas as recargas deste ponto
+  -saida      arquivo de saída (padrão: saída padrão)
+`
+
+func main() {
+	diretorio := flag.String("dados", dataJson.DiretorioDadosDoAmbiente(), "diretório dos arquivos de dados")
+	formato := flag.String("formato", exportacao.FormatoCSV, "csv ou jsonl")
+	agrupamento := flag.String("agrupar", exportacao.PorPlaca, "placa, ponto, dia ou mes")
+	de := flag.String("de", "", "primeiro dia exportado")
+	ate := flag.String("ate", "", "último dia exportado")
+	placa := flag.String("placa", "", "placa do veículo")
+	ponto := flag.String("ponto", "", "ID do ponto de recarga")
+	saida := flag.String("saida", "", "arquivo de saída")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, uso) }
+	flag.Parse()
+
+	logger := logger.NewLogger(os.Stderr)
+	if erro := exportar(*diretorio, *formato, *agrupamento, *de, *ate, *placa, *ponto, *saida); erro != nil {
+		logger.Erro(erro.Error())
+		os.Exit(1)
+	}
+}
+
+func exportar(diretorio, formato, agrupamento, de, ate, placa, ponto, saida string) error {
+	filtro, erro := exportacao.NovoFiltro(de, ate, placa, ponto)
+	if erro != nil {
+		return erro
+	}
+	if erro := exportacao.ValidarFormato(formato); erro != nil {
+		return erro
+	}
+	if erro := dataJson.VerificarDiretorioDados(diretorio); erro != nil {
+		return erro
+	}
+
+	veiculos, erro := repositorio.NewRepositorioJSON(filepath.Join(diretorio, dataJson.ArquivoVeiculos)).ListarVeiculos()
+	if erro != nil {
+		return erro
+	}
+	linhas, erro := exportacao.Gerar(veiculos, filtro, agrupamento)
+	if erro != nil {
+		return erro
+	}
+
+	if saida == "" {
+		escritor := bufio.NewWriter(os.Stdout)
+		if erro := exportacao.Escrever(escritor, linhas, formato); erro != nil {
+			return erro
+		}
+		return escritor.Flush()
+	}
+	arquivo, erro := os.Create(saida)
+	if erro != nil {
+		return fmt.Errorf("erro ao criar %s: %v", saida, erro)
+	}
+	escritor := bufio.NewWriter(arquivo)
+	erro = exportacao.Escrever(escritor, linhas, formato)
+	if erro == nil {
+		erro = escritor.Flush()
+	}
+	if erroFechar := arquivo.Close(); erro == nil {
+		erro = erroFechar
+	}
+	if erro != nil {
+		return fmt.Errorf("erro ao gravar %s: %v", saida, erro)
+	}
+	fmt.Fprintf(os.Stderr, "%d recargas exportadas para %s\n", linhas[len(linhas)-1].Recargas, saida)
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"time"
+)
+
+const uso = `Uso: migrate [-dados diretório] [-verificar]
+
+Atualiza veiculos.json e regiao.json para a versão atual do formato. Antes de
+regravar um arquivo, a versão anterior é copiada para
+<arquivo>.v<versão>.<data>.bak, no mesmo diretório. Pare o servidor antes de
+migrar.
+
+Opções:
+  -dados       diretório dos arquivos de dados (padrão: DADOS_DIR ou app/internal/dataJson)
+  -verificar   apenas lista as migrações pendentes, sem alterar os arquivos
+`
+
+func main() {
+	diretorio := flag.String("dados", dataJson.DiretorioDadosDoAmbiente(), "diretório dos arquivos de dados")
+	verificar := flag.Bool("verificar", false, "apenas lista as migrações pendentes")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, uso) }
+	flag.Parse()
+
+	logger := logger.NewLogger(os.Stderr)
+	if erro := dataJson.VerificarDiretorioDados(*diretorio); erro != nil {
+		logger.Erro(erro.Error())
+		os.Exit(1)
+	}
+	falhou := false
+	for _, arquivo := range []string{dataJson.ArquivoVeiculos, dataJson.ArquivoRegiao} {
+		erro := migrarArquivo(filepath.Join(*diretorio, arquivo), arquivo, *verificar)
+		if erro != nil {
+			logger.Erro(erro.Error())
+			falhou = true
+		}
+	}
+	if falhou {
+		os.Exit(1)
+	}
+}
+
+// Migra um arquivo para a versão atual, guardando uma cópia da versão anterior
+func migrarArquivo(caminho string, arquivo string, verificar bool) error {
+	info, erro := os.Stat(caminho)
+	if os.IsNotExist(erro) {
+		fmt.Printf("%s: arquivo ausente, nada a migrar\n", caminho)
+		return nil
+	}
+	if erro != nil {
+		return fmt.Errorf("erro ao abrir %s: %v", caminho, erro)
+	}
+	conteudo, erro := os.ReadFile(caminho)
+	if erro != nil {
+		return fmt.Errorf("erro ao ler %s: %v", caminho, erro)
+	}
+
+	migrado, versao, erro := dataJson.Migrar(arquivo, conteudo)
+	if erro != nil {
+		return fmt.Errorf("%s não migrado: %v", caminho, erro)
+	}
+	atual := dataJson.VersaoAtual(arquivo)
+	if versao == atual {
+		fmt.Printf("%s: já na versão %d\n", caminho, atual)
+		return nil
+	}
+
+	fmt.Printf("%s: versão %d -> %d\n", caminho, versao, atual)
+	for _, migracao := range dataJson.MigracoesPendentes(arquivo, versao) {
+		fmt.Printf("  v%d -> v%d: %s\n", migracao.De, migracao.De+1, migracao.Descricao)
+	}
+	if verificar {
+		return nil
+	}
+
+	copia := fmt.Sprintf("%s.v%d.%s.bak", caminho, versao, time.Now().Format("20060102-150405"))
+	if erro := dataJson.GravarArquivoAtomico(copia, conteudo, info.Mode().Perm()); erro != nil {
+		return fmt.Errorf("erro ao copiar %s para %s, arquivo não migrado: %v", caminho, copia, erro)
+	}
+	if erro := dataJson.GravarArquivoAtomico(caminho, migrado, info.Mode().Perm()); erro != nil {
+		return fmt.Errorf("erro ao gravar %s migrado: %v", caminho, erro)
+	}
+	fmt.Printf("%s: migrado, versão anterior em %s\n", caminho, copia)
+	return nil
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"math/rand"
-	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -18,7 +20,30 @@ var veiculosEmEspera map[string]chan bool
 var filaAtual []string
 var proximoVeiculoSignal = make(chan struct{}, 1)
 
-func processarFila(logger *logger.Logger, conexao net.Conn) {
+// Recargas finalizadas enquanto o servidor estava fora, reenviadas na reconexão
+var recargasPendentes []dataJson.RecargaFinalizada
+
+// Tentativas de reconexão quando a conexão com o servidor cai. A fila é
+// mantida enquanto isso e conciliada pelo servidor na nova identificação.
+const (
+	tentativasReconexao = 30
+	intervaloReconexao  = 2 * time.Second
+)
+
+// Dispatcher da conexão atual, trocado a cada reconexão
+var (
+	dispatcherMutex sync.Mutex
+	dispatcherAtual *tcpIP.Dispatcher
+	iniciarFila     sync.Once
+)
+
+func dispatcherConectado() *tcpIP.Dispatcher {
+	dispatcherMutex.Lock()
+	defer dispatcherMutex.Unlock()
+	return dispatcherAtual
+}
+
+func processarFila(logger *logger.Logger) {
 	for {
 		mutex.Lock()
 		if len(filaAtual) == 0 {
@@ -36,13 +61,8 @@ func processarFila(logger *logger.Logger, conexao net.Conn) {
 		logger.Info(fmt.Sprintf("Processando veículo na fila: %s", veiculoAtual))
 		mutex.Unlock()
 
-		msg := dataJson.Mensagem{
-			Tipo:     "chamando-veiculo",
-			Conteudo: veiculoAtual,
-			Origem:   "ponto-de-recarga",
-		}
-
-		if err := dataJson.SendMessage(conexao, msg); err != nil {
+		chamada := dataJson.ChamandoVeiculo{Placa: veiculoAtual}
+		if err := dispatcherConectado().Send("chamando-veiculo", "ponto-de-recarga", chamada); err != nil {
 			logger.Erro(fmt.Sprintf("Erro ao enviar chamada de veículo: %v", err))
 			time.Sleep(2 * time.Second)
 			continue
@@ -59,6 +79,14 @@ func processarFila(logger *logger.Logger, conexao net.Conn) {
 		timeout := 60 * time.Second // Um minuto para o veículo chegar
 		select {
 		case <-chegou:
+			// O canal também é fechado quando a reserva é cancelada
+			mutex.Lock()
+			cancelada := len(filaAtual) == 0 || filaAtual[0] != veiculoAtual
+			mutex.Unlock()
+			if cancelada {
+				logger.Info(fmt.Sprintf("Reserva de %s cancelada, processando próximo veículo", veiculoAtual))
+				continue
+			}
 			logger.Info(fmt.Sprintf("Veículo %s informou chegada, iniciando carregamento", veiculoAtual))
 			// Continuar com o carregamento
 		case <-time.After(timeout):
@@ -96,138 +124,250 @@ func processarFila(logger *logger.Logger, conexao net.Conn) {
 		mutex.Unlock()
 
 		// Notificar o servidor que a recarga foi concluída
-		msgFinalizada := dataJson.Mensagem{
-			Tipo: "recarga-finalizada",
-			Conteudo: fmt.Sprintf("Veículo %s atendido. Consumo: %.2f kWh, Valor: R$ %.2f",
-				veiculoAtual, consumoTotal, valor),
-			Origem: "ponto-de-recarga",
+		recarga := dataJson.RecargaFinalizada{
+			Placa:      veiculoAtual,
+			ConsumoKwh: consumoTotal,
+			Valor:      valor,
+		}
+		if erro := dispatcherConectado().Send("recarga-finalizada", "ponto-de-recarga", recarga); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao enviar recarga finalizada, reenvio na reconexão: %v", erro))
+			mutex.Lock()
+			recargasPendentes = append(recargasPendentes, recarga)
+			mutex.Unlock()
 		}
-
-		dataJson.SendMessage(conexao, msgFinalizada)
 		// Pequena pausa antes de processar o próximo veículo
 		time.Sleep(1 * time.Second)
 	}
 }
 
-func enviarDisponibilidade(logger *logger.Logger, conexao net.Conn) {
+func enviarDisponibilidade(logger *logger.Logger, dispatcher *tcpIP.Dispatcher, pedido dataJson.Mensagem) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	status := "Situacao atual: "
-	if len(filaAtual) == 0 {
-		status += "sem fila"
-	} else {
-		status += fmt.Sprintf("com %d na fila", len(filaAtual))
-	}
-
-	msg := dataJson.Mensagem{
-		Tipo:     "disponibilidade",
-		Conteudo: status,
-		Origem:   "ponto-de-recarga",
-	}
-	erro := dataJson.SendMessage(conexao, msg)
+	disponibilidade := dataJson.Disponibilidade{TamanhoFila: len(filaAtual)}
+	erro := dispatcher.Reply(pedido, "disponibilidade", "ponto-de-recarga", disponibilidade)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao enviar disponibilidade - %v", erro))
 	}
 }
 
-func IdentificacaoInicial(logger *logger.Logger, conexao net.Conn) {
-	if err := tcpIP.SendIdentification(conexao, "ponto-de-recarga"); err != nil {
+// Identidade do ponto lida de PONTO_ID e PONTO_CREDENCIAL. Com TLS o
+// certificado já identifica o ponto e as variáveis são opcionais.
+func identidadeDoAmbiente() (dataJson.Identificacao, error) {
+	identificacao := dataJson.Identificacao{Credencial: os.Getenv("PONTO_CREDENCIAL")}
+	if valor := os.Getenv("PONTO_ID"); valor != "" {
+		id, err := strconv.Atoi(valor)
+		if err != nil || id <= 0 {
+			return identificacao, fmt.Errorf("PONTO_ID invalido: %q", valor)
+		}
+		identificacao.PontoID = id
+	}
+	return identificacao, nil
+}
+
+func IdentificacaoInicial(logger *logger.Logger, conexao *dataJson.Conn, identificacao dataJson.Identificacao) error {
+	aceita, err := tcpIP.SendIdentification(conexao, "ponto-de-recarga", identificacao)
+	if err != nil {
 		logger.Erro(fmt.Sprintf("Erro ao enviar identificação: %v", err))
+		return err
 	}
+	logger.Info(fmt.Sprintf("Identificação aceita pelo servidor (protocolo v%d)", aceita.Versao))
+	return nil
 }
 
+// Conecta e identifica o ponto, reenvia as recargas pendentes e lê as
+// mensagens do servidor até a conexão cair. Retorna false se não chegou a
+// ser identificado.
+func conectarAoServidor(logger *logger.Logger, tlsConfig *tls.Config, identificacao dataJson.Identificacao) (bool, error) {
+	conexao, err := tcpIP.ConnectToServerTCP("servidor:5000", tlsConfig)
+	if err != nil {
+		logger.Erro("Erro ao conectar com o servidor")
+		return false, err
+	}
+	defer conexao.Close()
+
+	logger.Info("Ponto de Recarga conectado")
+	if err := IdentificacaoInicial(logger, conexao, identificacao); err != nil {
+		return false, err
+	}
+
+	dispatcher := tcpIP.NewDispatcher(conexao, logger)
+	tratador := func(mensagem dataJson.Mensagem) {
+		tratarMensagem(logger, dispatcher, mensagem)
+	}
+	for _, tipo := range []string{"fila-atualizada", "nova-solicitacao", "cancelar-reserva", "veiculo-chegou", "liberar-ponto", "get-disponibilidade", "consultar-fila"} {
+		dispatcher.Subscribe(tipo, tratador)
+	}
+	dispatcherMutex.Lock()
+	dispatcherAtual = dispatcher
+	dispatcherMutex.Unlock()
+	iniciarFila.Do(func() { go processarFila(logger) })
+
+	// As recargas pendentes chegam antes da consulta da fila feita pelo
+	// servidor na identificação, para não voltarem à fila
+	mutex.Lock()
+	pendentes := recargasPendentes
+	recargasPendentes = nil
+	mutex.Unlock()
+	for _, recarga := range pendentes {
+		if erro := dispatcher.Send("recarga-finalizada", "ponto-de-recarga", recarga); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao reenviar recarga finalizada de %s: %v", recarga.Placa, erro))
+			mutex.Lock()
+			recargasPendentes = append(recargasPendentes, recarga)
+			mutex.Unlock()
+		}
+	}
+
+	erro := dispatcher.Run()
+	logger.Erro(fmt.Sprintf("Erro ao ler mensagem do servidor - %v", erro))
+	return true, erro
+}
 
 func main() {
 	veiculosEmEspera = make(map[string]chan bool)
 	logger := logger.NewLogger(os.Stdout)
 
-	conexao, err := tcpIP.ConnectToServerTCP("servidor:5000")
+	//TLS opcional; com TLS o ponto se identifica pelo certificado de cliente
+	tlsConfig, err := tcpIP.ClientTLSConfig(tcpIP.ArquivosTLSDoAmbiente(), "servidor:5000")
 	if err != nil {
-		logger.Erro("Erro ao conectar com o servidor")
+		logger.Erro(fmt.Sprintf("Erro ao configurar TLS: %v", err))
 		return
 	}
-	defer conexao.Close()
 
-	logger.Info("Ponto de Recarga conectado")
-	IdentificacaoInicial(logger, conexao)
+	identificacao, err := identidadeDoAmbiente()
+	if err != nil {
+		logger.Erro(err.Error())
+		return
+	}
 
-	go processarFila(logger, conexao)
+	// A fila continua sendo processada durante as reconexões
+	for tentativa := 1; ; tentativa++ {
+		identificado, erro := conectarAoServidor(logger, tlsConfig, identificacao)
+		var recusa *tcpIP.ErroIdentificacaoRecusada
+		if errors.As(erro, &recusa) && recusa.Recusa.Motivo != dataJson.MotivoPontoIndisponivel {
+			return
+		}
+		if identificado {
+			tentativa = 0
+		}
+		// Sem nenhuma conexão aceita não há fila a preservar
+		if dispatcherConectado() == nil || tentativa >= tentativasReconexao {
+			return
+		}
+		time.Sleep(intervaloReconexao)
+		logger.Info(fmt.Sprintf("Reconectando ao servidor (tentativa %d)...", tentativa+1))
+	}
+}
 
-	for {
-		msg, erro := dataJson.ReceiveMessage(conexao)
+// Trata as mensagens enviadas espontaneamente pelo servidor
+func tratarMensagem(logger *logger.Logger, dispatcher *tcpIP.Dispatcher, mensagem dataJson.Mensagem) {
+	switch mensagem.Tipo {
+	case "fila-atualizada":
+		fila, erro := dataJson.ParseFila(mensagem.Dados)
 		if erro != nil {
-			logger.Erro(fmt.Sprintf("Erro ao ler mensagem do servidor - %v", erro))
+			logger.Erro(fmt.Sprintf("Fila inválida recebida: %v", erro))
 			return
 		}
-		// Processar cada tipo de mensagem em uma goroutine separada para não bloquear o loop principal
-		go func(mensagem dataJson.Mensagem) {
-			switch mensagem.Tipo {
-			case "fila-atualizada":
-				mutex.Lock()
-				filaAtual = dataJson.ParseFila(mensagem.Conteudo)
-				logger.Info("Fila atualizada")
-				mutex.Unlock()
-			case "nova-solicitacao":
-				mutex.Lock()
-				veiculoID := mensagem.Conteudo
-				posicaoFila := len(filaAtual) + 1
-				filaAtual = append(filaAtual, veiculoID)
-				logger.Info(fmt.Sprintf("Veículo %s adicionado à fila.", veiculoID))
-
-				statusMsg := dataJson.Mensagem{
-					Tipo:     "status-fila",
-					Conteudo: fmt.Sprintf("%d", posicaoFila), // Posição na fila (1 = próximo, >1 = esperar)
-					Origem:   "ponto-de-recarga",
-				}
-				mutex.Unlock()
-				// Enviar o status da fila para o servidor
-				dataJson.SendMessage(conexao, statusMsg)
-			case "veiculo-chegou":
-				placaVeiculo := mensagem.Conteudo
-				logger.Info(fmt.Sprintf("Servidor informou chegada do veículo: %s", placaVeiculo))
-
-				mutex.Lock()
-				// Verificar se este veículo está em nossa fila
-				encontrado := false
-				for i, id := range filaAtual {
-					if id == placaVeiculo {
-						encontrado = true
-						// Processar apenas se for o primeiro da fila
-						if i == 0 {
-							// Verificar se o veículo está no mapa de espera
-							if ch, ok := veiculosEmEspera[placaVeiculo]; ok {
-								mutex.Unlock()
-								close(ch) // Sinalizar que chegou
-								logger.Info(fmt.Sprintf("Veículo %s informou chegada", placaVeiculo))
-							} else {
-								mutex.Unlock()
-								logger.Erro(fmt.Sprintf("Veículo %s está na fila mas não tem canal de espera", placaVeiculo))
-							}
-						} else {
-							mutex.Unlock()
-							logger.Erro(fmt.Sprintf("Veículo %s informou chegada, mas não é o primeiro da fila (posição %d)", placaVeiculo, i+1))
-						}
-						break
+		mutex.Lock()
+		filaAtual = fila
+		logger.Info("Fila atualizada")
+		mutex.Unlock()
+	case "nova-solicitacao":
+		var solicitacao dataJson.NovaSolicitacao
+		if erro := mensagem.DecodeDados(&solicitacao); erro != nil {
+			logger.Erro(fmt.Sprintf("Solicitação inválida recebida: %v", erro))
+			return
+		}
+		mutex.Lock()
+		veiculoID := solicitacao.Placa
+		posicaoFila := len(filaAtual) + 1
+		filaAtual = append(filaAtual, veiculoID)
+		logger.Info(fmt.Sprintf("Veículo %s adicionado à fila.", veiculoID))
+
+		// Posição na fila (1 = próximo, >1 = esperar)
+		status := dataJson.StatusFila{Posicao: posicaoFila}
+		mutex.Unlock()
+		// Enviar o status da fila para o servidor
+		dispatcher.Reply(mensagem, "status-fila", "ponto-de-recarga", status)
+	case "cancelar-reserva":
+		var cancelamento dataJson.CancelarReserva
+		if erro := mensagem.DecodeDados(&cancelamento); erro != nil {
+			logger.Erro(fmt.Sprintf("Cancelamento inválido recebido: %v", erro))
+			return
+		}
+		mutex.Lock()
+		novaFila := []string{}
+		for _, placa := range filaAtual {
+			if placa != cancelamento.Placa {
+				novaFila = append(novaFila, placa)
+			}
+		}
+		filaAtual = novaFila
+		// Libera a espera caso o veículo já tenha sido chamado
+		if ch, ok := veiculosEmEspera[cancelamento.Placa]; ok {
+			delete(veiculosEmEspera, cancelamento.Placa)
+			close(ch)
+		}
+		mutex.Unlock()
+		logger.Info(fmt.Sprintf("Reserva do veículo %s cancelada, removido da fila", cancelamento.Placa))
+	case "veiculo-chegou":
+		var chegada dataJson.VeiculoChegou
+		if erro := mensagem.DecodeDados(&chegada); erro != nil {
+			logger.Erro(fmt.Sprintf("Chegada inválida recebida: %v", erro))
+			return
+		}
+		placaVeiculo := chegada.Placa
+		logger.Info(fmt.Sprintf("Servidor informou chegada do veículo: %s", placaVeiculo))
+
+		mutex.Lock()
+		// Verificar se este veículo está em nossa fila
+		encontrado := false
+		for i, id := range filaAtual {
+			if id == placaVeiculo {
+				encontrado = true
+				// Processar apenas se for o primeiro da fila
+				if i == 0 {
+					// Verificar se o veículo está no mapa de espera
+					if ch, ok := veiculosEmEspera[placaVeiculo]; ok {
+						delete(veiculosEmEspera, placaVeiculo)
+						mutex.Unlock()
+						close(ch) // Sinalizar que chegou
+						logger.Info(fmt.Sprintf("Veículo %s informou chegada", placaVeiculo))
+					} else {
+						mutex.Unlock()
+						logger.Erro(fmt.Sprintf("Veículo %s está na fila mas não tem canal de espera", placaVeiculo))
 					}
-				}
-				if !encontrado {
+				} else {
 					mutex.Unlock()
-					logger.Erro(fmt.Sprintf("Veículo %s informou chegada, mas não está na fila", placaVeiculo))
+					logger.Erro(fmt.Sprintf("Veículo %s informou chegada, mas não é o primeiro da fila (posição %d)", placaVeiculo, i+1))
 				}
-			case "liberar-ponto":
-				// Sinalizar imediatamente para o loop de processamento
-				select {
-				case proximoVeiculoSignal <- struct{}{}:
-					logger.Info("Sinal para processar próximo veículo enviado")
-				default:
-					// Canal já tem um sinal, então não precisa enviar outro
-				}
-			case "get-disponibilidade":
-				enviarDisponibilidade(logger, conexao)
-				logger.Info("Disponibilidade atual enviada ao servidor")
-			default:
+				break
 			}
-		}(msg)
+		}
+		if !encontrado {
+			mutex.Unlock()
+			logger.Erro(fmt.Sprintf("Veículo %s informou chegada, mas não está na fila", placaVeiculo))
+		}
+	case "liberar-ponto":
+		// Sinalizar imediatamente para o loop de processamento
+		select {
+		case proximoVeiculoSignal <- struct{}{}:
+			logger.Info("Sinal para processar próximo veículo enviado")
+		default:
+			// Canal já tem um sinal, então não precisa enviar outro
+		}
+	case "get-disponibilidade":
+		enviarDisponibilidade(logger, dispatcher, mensagem)
+		logger.Info("Disponibilidade atual enviada ao servidor")
+	case "consultar-fila":
+		// Um operador está inspecionando a fila
+		mutex.Lock()
+		fila := dataJson.FilaPonto{Placas: append([]string{}, filaAtual...)}
+		mutex.Unlock()
+		erro := dispatcher.Reply(mensagem, "fila-ponto", "ponto-de-recarga", fila)
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao enviar fila ao servidor - %v", erro))
+		}
+	default:
 	}
 }
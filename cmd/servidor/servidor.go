@@ -1,18 +1,132 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
+	"recarga-inteligente/internal/auditoria"
+	"recarga-inteligente/internal/backup"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/handler"
+	"recarga-inteligente/internal/httpAPI"
 	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
 	"recarga-inteligente/internal/store"
 	"recarga-inteligente/internal/tcpIP"
 )
 
 func main() {
+	diretorioDados := flag.String("dados", dataJson.DiretorioDadosDoAmbiente(), "diretório dos arquivos de dados (regiao.json, veiculos.json e diário de eventos)")
+	flag.Parse()
+
 	logger := logger.NewLogger(os.Stdout)
+
+	//Todos os arquivos de dados ficam no diretorio indicado em -dados ou DADOS_DIR
+	if erro := dataJson.VerificarDiretorioDados(*diretorioDados); erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar diretorio de dados: %v", erro))
+		return
+	}
+	dataJson.ConfigurarDiretorioDados(*diretorioDados)
+	logger.Info(fmt.Sprintf("Diretorio de dados: %s", *diretorioDados))
+
+	//Snapshots periodicos de regiao.json e veiculos.json, configurados em BACKUP_DIR, BACKUP_INTERVALO e BACKUP_RETER
+	configBackup, erro := backup.ConfigDoAmbiente(*diretorioDados)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar backups: %v", erro))
+		return
+	}
+	if configBackup.Intervalo > 0 {
+		logger.Info(fmt.Sprintf("Snapshots dos dados a cada %v em %s, mantendo os %d mais recentes", configBackup.Intervalo, configBackup.Diretorio, configBackup.Retencao))
+		go backup.Agendar(logger, *diretorioDados, configBackup)
+	}
+
+	//A regiao e os pontos cadastrados ficam em memoria e sao recarregados quando regiao.json muda
+	regiao, erro := dataJson.GetRegiao()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao carregar %s: %v", dataJson.ArquivoRegiao, erro))
+		return
+	}
+	logger.Info(fmt.Sprintf("Regiao carregada com %d pontos de recarga", len(regiao.PontosDeRecarga)))
+	intervaloRegiao, erro := handler.IntervaloRegiaoDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar recarregamento da regiao: %v", erro))
+		return
+	}
 	connectionStore := store.NewConnectionStore()
+	go handler.MonitorarRegiao(logger, connectionStore, intervaloRegiao)
+
+	//TLS opcional, configurado pelas variaveis TLS_CERT, TLS_KEY e TLS_CA
+	tlsConfig, erro := tcpIP.ServerTLSConfig(tcpIP.ArquivosTLSDoAmbiente())
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar TLS: %v", erro))
+		return
+	}
+
+	//Heartbeat para remover conexoes que cairam sem aviso
+	configHeartbeat, erro := handler.ConfigHeartbeatDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar heartbeat: %v", erro))
+		return
+	}
+	go handler.MonitorarConexoes(logger, connectionStore, configHeartbeat)
+
+	//Sessoes permitem que veiculos reconectados recuperem reserva e notificacoes
+	validadeSessao, erro := handler.ValidadeSessaoDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar sessoes: %v", erro))
+		return
+	}
+	go handler.MonitorarSessoes(logger, connectionStore, validadeSessao)
+
+	//Limites de taxa por conexao e por placa, configurados em LIMITE_MENSAGENS e LIMITE_INFRACOES
+	configLimites, erro := handler.ConfigLimitesDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar limites de mensagens: %v", erro))
+		return
+	}
+	handler.ConfigurarLimites(configLimites)
+
+	//Cada operador se autentica com a propria credencial, cujo hash esta em OPERADORES, e tem as acoes auditadas
+	operadores, erro := handler.OperadoresDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar operadores: %v", erro))
+		return
+	}
+	registroAuditoria, erro := auditoria.AbrirDoAmbiente()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao configurar auditoria: %v", erro))
+		return
+	}
+	defer registroAuditoria.Close()
+	handler.ConfigurarOperador(operadores, registroAuditoria)
+
+	//Cadastro dos veiculos e historico de recargas, compartilhado pelo protocolo TCP e pela API HTTP
+	veiculos := repositorio.NewRepositorioJSON(dataJson.CaminhoDados(dataJson.ArquivoVeiculos))
+
+	//Reservas e filas sao reconstruidas a partir do diario de eventos
+	diario, reproducao, erro := eventos.Abrir(dataJson.CaminhoDados(dataJson.ArquivoEventos))
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao abrir diario de eventos: %v", erro))
+		return
+	}
+	defer diario.Close()
+	if reproducao.LinhaIncompleta {
+		logger.Erro("Ultima linha do diario de eventos estava incompleta e foi descartada")
+	}
+	logger.Info(fmt.Sprintf("Diario de eventos: snapshot ate o evento %d, %d eventos reaplicados", reproducao.SeqSnapshot, reproducao.Eventos))
+	handler.ConfigurarDiario(diario)
+	handler.RestaurarEstado(logger, connectionStore, diario.Estado())
+
+	//API HTTP para clientes que nao falam o protocolo TCP, na porta HTTP_PORTA
+	portaHTTP := os.Getenv("HTTP_PORTA")
+	if portaHTTP == "" {
+		portaHTTP = ":8080"
+	}
+	go httpAPI.StartServerHTTP(portaHTTP, tlsConfig, connectionStore, veiculos, logger)
 
 	//Inicia o servidor TCP na porta 5000
-	erro := tcpIP.StartServerTCP(":5000", connectionStore, logger)
+	erro = tcpIP.StartServerTCP(":5000", tlsConfig, connectionStore, veiculos, logger)
 	if erro != nil {
 		logger.Erro("Erro ao iniciar servidor TCP em StartServerTCP")
 		return
@@ -2,59 +2,54 @@ package manageVeiculo
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
 	"os"
 	"recarga-inteligente/internal/coordenadas"
 	"recarga-inteligente/internal/dataJson"
 	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/tcpIP"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func EnviarLocalizacao(logger *logger.Logger, conexao net.Conn) bool {
-	dadosRegiao, _, erro := dataJson.ReceiveDadosRegiao(conexao)
+// Envia a localização atual dentro da área recebida e retorna o ranking de pontos
+func EnviarLocalizacao(logger *logger.Logger, dispatcher *tcpIP.Dispatcher, pedido dataJson.Mensagem) (dataJson.Mensagem, bool) {
+	var dadosRegiao dataJson.DadosRegiao
+	erro := pedido.DecodeDados(&dadosRegiao)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao receber dados da regiao - %v", erro))
-		return false
+		return dataJson.Mensagem{}, false
 	}
 	localizacaoAtual := coordenadas.GetLocalizacaoVeiculo(dadosRegiao.Area)
-	msg_localizacao := dataJson.Mensagem{
-		Tipo:     "localizacao",
-		Conteudo: fmt.Sprintf("%f,%f", localizacaoAtual.Latitude, localizacaoAtual.Longitude),
-		Origem:   "veiculo",
-	}
-	erro = dataJson.SendMessage(conexao, msg_localizacao)
+	fmt.Println("Localização enviada, aguardando ranking de pontos...")
+	resposta, erro := dispatcher.Request("localizacao", "veiculo", localizacaoAtual)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao enviar localizacao - %v", erro))
-		return false
+		return dataJson.Mensagem{}, false
 	}
-	fmt.Println("Localização enviada, aguardando ranking de pontos...")
-	return true
+	return resposta, true
 }
 
-func processarRankingPontos(logger *logger.Logger, conexao net.Conn, placa string) {
-	// Esperar a resposta com o ranking
-	resposta, erro := dataJson.ReceiveMessage(conexao)
-	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao receber ranking: %v", erro))
+func processarRankingPontos(logger *logger.Logger, sessao *Sessao, resposta dataJson.Mensagem) {
+	if resposta.Tipo != "ranking-pontos" {
+		logger.Erro(fmt.Sprintf("Tipo de resposta inesperado: %s", resposta.Tipo))
 		return
 	}
 
-	if resposta.Tipo != "ranking-pontos" {
-		logger.Erro(fmt.Sprintf("Tipo de resposta inesperado: %s", resposta.Tipo))
+	var ranking dataJson.RankingPontos
+	erro := resposta.DecodeDados(&ranking)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao ler ranking: %v", erro))
 		return
 	}
 
 	// Limpar a tela e mostrar o ranking formatado de maneira mais limpa
-	linhas := strings.Split(resposta.Conteudo, "\n")
 	fmt.Println("\n----- RANKING DE PONTOS DE RECARGA -----")
-	for _, linha := range linhas {
-		if strings.TrimSpace(linha) != "" {
-			fmt.Println(linha)
-		}
+	for i, ponto := range ranking.Pontos {
+		fmt.Printf("%d. Ponto ID: %d, Distância: %.2f km, Fila: %d veículos\n",
+			i+1, ponto.ID, ponto.DistanciaKm, ponto.Fila)
 	}
 	fmt.Println("-----------------------------------------")
 
@@ -70,91 +65,71 @@ func processarRankingPontos(logger *logger.Logger, conexao net.Conn, placa strin
 		return
 	}
 
-	// Extrair o ID do ponto da linha escolhida
-	if indice <= 0 || indice > len(linhas)-1 {
+	// Obter o ID do ponto da opção escolhida
+	if indice > len(ranking.Pontos) {
 		fmt.Println("Escolha fora do range de opções disponíveis.")
 		return
 	}
+	pontoID := ranking.Pontos[indice-1].ID
 
-	var numeroOpcao int
-	var pontoID int
-	_, err := fmt.Sscanf(linhas[indice-1], "%d. Ponto ID: %d", &numeroOpcao, &pontoID)
-	if err != nil {
-		logger.Erro(fmt.Sprintf("Erro ao obter ID do ponto: %v", err))
-		fmt.Println("Erro ao processar sua escolha. Tente novamente.")
-		return
-	}
-
-	// Enviar solicitação de reserva
-	msg := dataJson.Mensagem{
-		Tipo:     "solicitar-reserva",
-		Conteudo: fmt.Sprintf("%d", pontoID),
-		Origem:   "veiculo",
+	// Inscrever as notificações antes de reservar, pois a vez pode chegar logo após a confirmação
+	notificacoes := make(chan dataJson.Mensagem, 8)
+	encaminhar := func(mensagem dataJson.Mensagem) {
+		select {
+		case notificacoes <- mensagem:
+		default:
+		}
 	}
-
-	erro = dataJson.SendMessage(conexao, msg)
-	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao enviar solicitação de reserva: %v", erro))
-		fmt.Println("Erro de comunicação. Tente novamente.")
-		return
+	tiposNotificacao := []string{"posicao-fila", "sua-vez", "recarga-iniciada", "recarga-finalizada", "reserva-cancelada"}
+	for _, tipo := range tiposNotificacao {
+		sessao.Subscribe(tipo, encaminhar)
 	}
+	defer func() {
+		for _, tipo := range tiposNotificacao {
+			sessao.Unsubscribe(tipo)
+		}
+	}()
 
 	fmt.Printf("\nReserva solicitada para o ponto ID %d. Aguardando confirmação...\n", pontoID)
 
-	// Aguardar confirmação
-	confirmacao, erro := dataJson.ReceiveMessage(conexao)
+	// Enviar solicitação de reserva e aguardar confirmação
+	confirmacao, erro := sessao.Dispatcher().Request("solicitar-reserva", "veiculo", dataJson.SolicitarReserva{PontoID: pontoID})
 	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao receber confirmação: %v", erro))
-		fmt.Println("Erro ao receber confirmação. Tente novamente.")
+		logger.Erro(fmt.Sprintf("Erro ao solicitar reserva: %v", erro))
+		var limite *tcpIP.ErroLimiteExcedido
+		if errors.As(erro, &limite) {
+			fmt.Println("Muitas solicitações de reserva. Aguarde e tente novamente.")
+			return
+		}
+		fmt.Println("Erro de comunicação. Tente novamente.")
 		return
 	}
 
 	// Processar a resposta do servidor de forma limpa
 	fmt.Println("\n----- STATUS DA RESERVA -----")
-	if confirmacao.Tipo == "reserva-confirmada" || confirmacao.Tipo == "sua-vez" {
-		// Se for mensagem de confirmação de reserva
-		if confirmacao.Tipo == "reserva-confirmada" {
-			fmt.Println(" " + confirmacao.Conteudo)
-			// confirma a reserva e aguarda a vez na fila
-			if strings.Contains(confirmacao.Conteudo, "Você é o próximo") {
-				fmt.Println("Aguardando autorização para iniciar deslocamento...")
-			} else if strings.Contains(confirmacao.Conteudo, "fila") {
-				fmt.Println("Aguardando sua vez na fila...")
-			}
-		}
-
-		// Se já for a vez (sem passar pela fila)
-		if confirmacao.Tipo == "sua-vez" {
-			fmt.Println("É sua vez! Autorizado a se deslocar ao ponto de recarga.")
-			fmt.Println("Iniciando deslocamento até o ponto de recarga...")
-			time.Sleep(10 * time.Second) // Simulando deslocamento
-
-			// Informar ao servidor que chegou
-			msgChegada := dataJson.Mensagem{
-				Tipo:     "veiculo-chegou",
-				Conteudo: placa,
-				Origem:   "veiculo",
-			}
-			dataJson.SendMessage(conexao, msgChegada)
-			fmt.Println("Chegou ao ponto de recarga, aguardando início do carregamento...")
+	if confirmacao.Tipo == "reserva-confirmada" {
+		var reserva dataJson.ReservaConfirmada
+		confirmacao.DecodeDados(&reserva)
+		// confirma a reserva e aguarda a vez na fila
+		if reserva.Posicao <= 1 {
+			fmt.Printf(" Reserva confirmada para ponto ID %d. Você é o próximo a ser atendido!\n", reserva.PontoID)
+			fmt.Println("Aguardando autorização para iniciar deslocamento...")
+		} else {
+			fmt.Printf(" Reserva confirmada para ponto ID %d. Você está na posição %d da fila, aguarde sua vez.\n", reserva.PontoID, reserva.Posicao)
+			fmt.Println("Aguardando sua vez na fila...")
 		}
 
-		// Loop para receber mensagens do servidor enquanto aguarda
-		recargaConcluida := make(chan struct{})
-		erroRecarga := make(chan error)
-
-		go func() {
-			for {
-				mensagem, erro := dataJson.ReceiveMessage(conexao)
-				if erro != nil {
-					erroRecarga <- erro
-					return
-				}
-
+		// Loop para receber notificações do servidor enquanto aguarda
+		timeout := time.After(5 * time.Minute)
+		for {
+			select {
+			case mensagem := <-notificacoes:
 				switch mensagem.Tipo {
 				case "posicao-fila":
 					// Mostrar posição na fila
-					fmt.Println(" " + mensagem.Conteudo)
+					var posicao dataJson.PosicaoFila
+					mensagem.DecodeDados(&posicao)
+					fmt.Printf(" Atualização: Você está na fila do ponto ID %d.\n", posicao.PontoID)
 
 				case "sua-vez":
 					// Agora é a vez do veículo - deve iniciar deslocamento
@@ -163,43 +138,46 @@ func processarRankingPontos(logger *logger.Logger, conexao net.Conn, placa strin
 					time.Sleep(10 * time.Second) // Simulando deslocamento
 
 					// Informar ao servidor que chegou
-					msgChegada := dataJson.Mensagem{
-						Tipo:     "veiculo-chegou",
-						Conteudo: placa,
-						Origem:   "veiculo",
-					}
-					dataJson.SendMessage(conexao, msgChegada)
+					sessao.Dispatcher().Send("veiculo-chegou", "veiculo", dataJson.VeiculoChegou{Placa: sessao.Placa})
 					fmt.Println("Chegou ao ponto de recarga, aguardando início do carregamento...")
 
 				case "recarga-iniciada":
 					// Só agora inicia-se o carregamento de fato
 					fmt.Println("Iniciando carregamento...")
-					fmt.Println(" " + mensagem.Conteudo)
 
 				case "recarga-finalizada":
-					fmt.Println("" + mensagem.Conteudo)
+					var recarga dataJson.RecargaFinalizada
+					mensagem.DecodeDados(&recarga)
+					fmt.Printf("Veículo %s atendido. Consumo: %.2f kWh, Valor: R$ %.2f\n",
+						recarga.Placa, recarga.ConsumoKwh, recarga.Valor)
 					fmt.Println("Recarga concluída! Retornando ao menu principal...")
-					close(recargaConcluida)
 					return
 
-				default:
-					fmt.Println("Mensagem recebida: " + mensagem.Conteudo)
+				case "reserva-cancelada":
+					var cancelamento dataJson.ReservaCancelada
+					mensagem.DecodeDados(&cancelamento)
+					fmt.Printf("Sua reserva no ponto ID %d foi cancelada pela operação. Retornando ao menu principal...\n", cancelamento.PontoID)
+					return
 				}
-			}
-		}()
 
-		select {
-		case <-recargaConcluida:
-			return
-		case err := <-erroRecarga:
-			logger.Erro(fmt.Sprintf("Erro durante processo de recarga: %v", err))
-			return
-		case <-time.After(5 * time.Minute):
-			logger.Erro("Timeout aguardando conclusão da recarga")
-			return
+			case <-sessao.Dispatcher().Done():
+				// A reserva continua no servidor enquanto a sessão puder ser retomada
+				fmt.Println("Conexão com o servidor perdida, tentando retomar a sessão...")
+				if erro := sessao.Reconectar(); erro != nil {
+					logger.Erro(fmt.Sprintf("Erro durante processo de recarga: conexão encerrada - %v", erro))
+					return
+				}
+				fmt.Println("Sessão retomada, reserva mantida.")
+
+			case <-timeout:
+				logger.Erro("Timeout aguardando conclusão da recarga")
+				return
+			}
 		}
 	} else if confirmacao.Tipo == "reserva-falhou" {
-		fmt.Println(" " + confirmacao.Conteudo)
+		var falha dataJson.ReservaFalhou
+		confirmacao.DecodeDados(&falha)
+		fmt.Println(" " + textoFalhaReserva(falha))
 		fmt.Println("Retornando ao menu principal...")
 		return
 	} else {
@@ -210,102 +188,93 @@ func processarRankingPontos(logger *logger.Logger, conexao net.Conn, placa strin
 	}
 }
 
-func IdentificacaoInicial(logger *logger.Logger, conexao net.Conn) string {
+// Identifica o veículo junto ao servidor, negociando o protocolo, e retorna a
+// placa e o token da sessão. Deve ser chamada antes do Dispatcher começar a
+// ler a conexão.
+func IdentificacaoInicial(logger *logger.Logger, conexao *dataJson.Conn) (string, string) {
 	leitor := bufio.NewReader(os.Stdin)
 	placa := ""
+	token := ""
 	placaValida := false
 
 	for !placaValida {
-		fmt.Println("Por favor, informe a placa do veículo (6-8 caracteres): ")
+		fmt.Println("Por favor, informe a placa do veículo (ABC-1234 ou ABC1D23): ")
 		input, _ := leitor.ReadString('\n')
-		placa = strings.TrimSpace(input)
 
-		// Validar formato da placa
-		if len(placa) < 6 || len(placa) > 8 {
-			fmt.Println("Placa inválida! A placa deve ter entre 6 e 8 caracteres.")
+		// Validar formato da placa; o servidor faz a mesma verificação
+		placaNormalizada, erro := dataJson.NormalizarPlaca(input)
+		if erro != nil {
+			fmt.Println("Placa inválida! Use o formato ABC-1234 ou o Mercosul ABC1D23.")
 			continue
 		}
-
-		// Enviar solicitação ao servidor para verificar se a placa está disponível
-		msg := dataJson.Mensagem{
-			Tipo:     "verificar-placa",
-			Conteudo: placa,
-			Origem:   "veiculo",
-		}
-
-		erro := dataJson.SendMessage(conexao, msg)
-		if erro != nil {
-			logger.Erro(fmt.Sprintf("Erro ao verificar placa: %v", erro))
-			return ""
+		placa = placaNormalizada
+
+		fmt.Println("Informe a senha do veículo (no primeiro acesso ela será cadastrada): ")
+		input, _ = leitor.ReadString('\n')
+		senha := strings.TrimSpace(input)
+
+		// Enviar a identificação; o servidor recusa placas já em uso e senhas erradas
+		aceita, erro := tcpIP.SendIdentification(conexao, "veiculo", dataJson.Identificacao{Placa: placa, Senha: senha})
+		var recusa *tcpIP.ErroIdentificacaoRecusada
+		if errors.As(erro, &recusa) {
+			switch recusa.Recusa.Motivo {
+			case dataJson.MotivoPlacaInvalida:
+				fmt.Println("Placa inválida! Use o formato ABC-1234 ou o Mercosul ABC1D23.")
+				continue
+			case dataJson.MotivoPlacaEmUso:
+				fmt.Println("Esta placa já está em uso por outro veículo!")
+				continue
+			case dataJson.MotivoSenhaInvalida:
+				fmt.Printf("Senha inválida! No primeiro acesso a senha deve ter ao menos %d caracteres.\n", dataJson.TamanhoMinimoSenha)
+				continue
+			case dataJson.MotivoVeiculoBloqueado:
+				fmt.Printf("Veículo bloqueado por excesso de tentativas até %s.\n", recusa.Recusa.BloqueadoAte)
+				continue
+			case dataJson.MotivoSenhaPendente:
+				fmt.Println("Esta placa foi cadastrada antes das senhas; peça ao operador para cadastrar a senha.")
+				continue
+			}
 		}
-
-		// Esperar resposta do servidor
-		resposta, erro := dataJson.ReceiveMessage(conexao)
 		if erro != nil {
-			logger.Erro(fmt.Sprintf("Erro ao receber resposta de verificação de placa: %v", erro))
-			return ""
+			logger.Erro(fmt.Sprintf("Erro ao enviar identificacao: %v", erro))
+			return "", ""
 		}
 
-		if resposta.Tipo == "placa-disponivel" {
-			placaValida = true
-		} else if resposta.Tipo == "placa-indisponivel" {
-			fmt.Println("Esta placa já está em uso por outro veículo!")
-		} else {
-			logger.Erro(fmt.Sprintf("Resposta inesperada do servidor: %s", resposta.Tipo))
-			return ""
-		}
+		logger.Info(fmt.Sprintf("Identificação aceita pelo servidor (protocolo v%d)", aceita.Versao))
+		token = aceita.Sessao
+		placaValida = true
 	}
 
-	// Agora que sabemos que a placa é válida, enviar a identificação final
-	msg := dataJson.Mensagem{
-		Tipo:     "identificacao",
-		Conteudo: fmt.Sprintf("veiculo conectado placa %s", placa),
-		Origem:   "veiculo",
-	}
-
-	erro := dataJson.SendMessage(conexao, msg)
-	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao enviar identificacao: %v", erro))
-		return ""
-	}
-
-	return placa
+	return placa, token
 }
 
-func ConsultarHistorico(leitor *bufio.Reader, logger *logger.Logger, conexao net.Conn, placa string) {
-	msgConsulta := dataJson.Mensagem{
-		Tipo:     "consultar-historico",
-		Conteudo: placa,
-		Origem:   "veiculo",
-	}
-
-	erro := dataJson.SendMessage(conexao, msgConsulta)
+func ConsultarHistorico(leitor *bufio.Reader, logger *logger.Logger, dispatcher *tcpIP.Dispatcher, placa string) {
+	// Solicitar o histórico e aguardar resposta do servidor
+	resposta, erro := dispatcher.Request("consultar-historico", "veiculo", nil)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao solicitar histórico: %v", erro))
 		fmt.Println("Erro ao consultar pagamentos. Tente novamente mais tarde.")
-	}
-
-	// Aguardar resposta do servidor
-	resposta, erro := dataJson.ReceiveMessage(conexao)
-	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao receber histórico: %v", erro))
-		fmt.Println("Erro ao consultar pagamentos. Tente novamente mais tarde.")
+		return
 	}
 
 	if resposta.Tipo == "historico-erro" {
-		fmt.Println("" + resposta.Conteudo)
+		fmt.Println("Erro ao buscar histórico de recargas")
+		return
 	}
 
 	if resposta.Tipo != "historico-recargas" {
 		logger.Erro(fmt.Sprintf("Tipo de resposta inesperado: %s", resposta.Tipo))
 		fmt.Println("Resposta inesperada do servidor. Tente novamente mais tarde.")
+		return
 	}
 
-	var recargas []dataJson.Recarga
-	erro = json.Unmarshal([]byte(resposta.Conteudo), &recargas)
+	var historico dataJson.HistoricoRecargas
+	erro = resposta.DecodeDados(&historico)
+	recargas := historico.Recargas
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao deserializar histórico: %v", erro))
 		fmt.Println("Erro ao processar histórico recebido. Tente novamente mais tarde.")
+		return
 	}
 
 	// Exibir o histórico para o usuário
@@ -334,23 +303,12 @@ func ConsultarHistorico(leitor *bufio.Reader, logger *logger.Logger, conexao net
 
 		switch opcaoP {
 		case "1":
-			msgLimpar := dataJson.Mensagem{
-				Tipo:     "limpar-historico",
-				Conteudo: placa,
-				Origem:   "veiculo",
-			}
-
-			erro := dataJson.SendMessage(conexao, msgLimpar)
+			// Solicitar o pagamento e esperar confirmação do servidor
+			resp, erro := dispatcher.Request("limpar-historico", "veiculo", nil)
 			if erro != nil {
 				logger.Erro(fmt.Sprintf("Erro ao solicitar limpeza do histórico: %v", erro))
 				fmt.Println("Erro ao efetuar pagamento. Tente novamente mais tarde.")
-			}
-
-			// Esperar confirmação do servidor
-			resp, erro := dataJson.ReceiveMessage(conexao)
-			if erro != nil {
-				logger.Erro(fmt.Sprintf("Erro ao receber confirmação de pagamento: %v", erro))
-				fmt.Println("Erro ao confirmar pagamento. Tente novamente.")
+				return
 			}
 			if resp.Tipo == "pagamento-confirmado" {
 				fmt.Println("Pagamento efetuado com sucesso!")
@@ -365,10 +323,13 @@ func ConsultarHistorico(leitor *bufio.Reader, logger *logger.Logger, conexao net
 	}
 }
 
-func MenuVeiculo(logger *logger.Logger, conexao net.Conn) {
+// Exibe o menu do veículo. conectar abre uma nova conexão com o servidor e é
+// usada para retomar a sessão se a conexão cair durante uma recarga.
+func MenuVeiculo(logger *logger.Logger, conexao *dataJson.Conn, conectar func() (*dataJson.Conn, error)) {
 	leitor := bufio.NewReader(os.Stdin)
 	on := true
-	placa := IdentificacaoInicial(logger, conexao)
+
+	placa, token := IdentificacaoInicial(logger, conexao)
 
 	// Verificar se a identificação falhou
 	if placa == "" {
@@ -376,6 +337,9 @@ func MenuVeiculo(logger *logger.Logger, conexao net.Conn) {
 		return
 	}
 
+	// A partir daqui o dispatcher da sessão passa a ser o único leitor da conexão
+	sessao := NovaSessao(logger, conectar, conexao, placa, token)
+
 	fmt.Printf("Veículo com placa %s registrado com sucesso!\n", placa)
 
 	for on {
@@ -389,13 +353,13 @@ func MenuVeiculo(logger *logger.Logger, conexao net.Conn) {
 
 		switch opcao {
 		case "1":
-			SolicitarRecarga(logger, conexao, placa)
+			SolicitarRecarga(logger, sessao)
 
 		case "2":
-			ConsultarHistorico(leitor, logger, conexao, placa)
+			ConsultarHistorico(leitor, logger, sessao.Dispatcher(), placa)
 		case "3":
 			fmt.Println("Saindo...")
-			conexao.Close()
+			sessao.Close()
 			on = false
 		default:
 			fmt.Println("Opcao invalida. Tente novamente.")
@@ -403,20 +367,9 @@ func MenuVeiculo(logger *logger.Logger, conexao net.Conn) {
 	}
 }
 
-func SolicitarRecarga(logger *logger.Logger, conexao net.Conn, placa string) {
-	solicitacao := dataJson.Mensagem{
-		Tipo:     "get-recarga",
-		Conteudo: "Ola Servidor! Quero recarregar",
-		Origem:   "veiculo",
-	}
-	erro := dataJson.SendMessage(conexao, solicitacao)
-	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao solicitar recarga: %v", erro))
-		return
-	}
-
-	// Aguardar resposta do servidor solicitando localização
-	resposta, erro := dataJson.ReceiveMessage(conexao)
+func SolicitarRecarga(logger *logger.Logger, sessao *Sessao) {
+	// Solicitar recarga e aguardar o servidor pedir a localização
+	resposta, erro := sessao.Dispatcher().Request("get-recarga", "veiculo", nil)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao obter resposta da solicitacao de recarga: %v", erro))
 		return
@@ -424,13 +377,28 @@ func SolicitarRecarga(logger *logger.Logger, conexao net.Conn, placa string) {
 
 	if resposta.Tipo == "get-localizacao" {
 		// Enviar localização
-		if !EnviarLocalizacao(logger, conexao) {
+		ranking, ok := EnviarLocalizacao(logger, sessao.Dispatcher(), resposta)
+		if !ok {
 			return
 		}
 
 		// Processar o ranking e fazer reserva
-		processarRankingPontos(logger, conexao, placa)
+		processarRankingPontos(logger, sessao, ranking)
 	} else {
 		logger.Erro(fmt.Sprintf("Resposta inesperada do servidor: %s", resposta.Tipo))
 	}
 }
+
+// Texto exibido ao usuário para cada motivo de falha na reserva
+func textoFalhaReserva(falha dataJson.ReservaFalhou) string {
+	switch falha.Motivo {
+	case dataJson.MotivoPontoNaoEncontrado:
+		return fmt.Sprintf("Ponto ID %d não encontrado", falha.PontoID)
+	case dataJson.MotivoFalhaComunicacao:
+		return fmt.Sprintf("Falha ao comunicar com o ponto ID %d", falha.PontoID)
+	case dataJson.MotivoPedidoInvalido:
+		return "Solicitação de reserva inválida"
+	default:
+		return "Não foi possível concluir a reserva"
+	}
+}
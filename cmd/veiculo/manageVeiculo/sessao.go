@@ -0,0 +1,126 @@
+package manageVeiculo
+
+import (
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/tcpIP"
+	"sync"
+	"time"
+)
+
+// Tentativas de reconexão antes de desistir da sessão
+const (
+	tentativasReconexao = 5
+	intervaloReconexao  = 2 * time.Second
+)
+
+// Sessão do veículo com o servidor. Quando a conexão cai, Reconectar abre uma
+// nova conexão, retoma a sessão com o token recebido na identificação e
+// reinscreve os tratadores de notificação no novo Dispatcher.
+type Sessao struct {
+	logger     *logger.Logger
+	conectar   func() (*dataJson.Conn, error)
+	Placa      string
+	token      string
+	mutex      sync.Mutex
+	conexao    *dataJson.Conn
+	dispatcher *tcpIP.Dispatcher
+	inscricoes map[string]func(dataJson.Mensagem)
+}
+
+func NovaSessao(logger *logger.Logger, conectar func() (*dataJson.Conn, error), conexao *dataJson.Conn, placa string, token string) *Sessao {
+	sessao := &Sessao{
+		logger:     logger,
+		conectar:   conectar,
+		Placa:      placa,
+		token:      token,
+		conexao:    conexao,
+		inscricoes: make(map[string]func(dataJson.Mensagem)),
+	}
+	sessao.dispatcher = tcpIP.NewDispatcher(conexao, logger)
+	go sessao.dispatcher.Run()
+	return sessao
+}
+
+// Dispatcher da conexão atual
+func (sessao *Sessao) Dispatcher() *tcpIP.Dispatcher {
+	sessao.mutex.Lock()
+	defer sessao.mutex.Unlock()
+	return sessao.dispatcher
+}
+
+// Inscreve um tratador que continua valendo após uma reconexão
+func (sessao *Sessao) Subscribe(tipo string, handler func(dataJson.Mensagem)) {
+	sessao.mutex.Lock()
+	defer sessao.mutex.Unlock()
+	sessao.inscricoes[tipo] = handler
+	sessao.dispatcher.Subscribe(tipo, handler)
+}
+
+func (sessao *Sessao) Unsubscribe(tipo string) {
+	sessao.mutex.Lock()
+	defer sessao.mutex.Unlock()
+	delete(sessao.inscricoes, tipo)
+	sessao.dispatcher.Unsubscribe(tipo)
+}
+
+// Reabre a conexão e retoma a sessão no servidor. Retorna erro se o servidor
+// não tiver emitido token, se a sessão tiver expirado ou se não for possível
+// reconectar.
+func (sessao *Sessao) Reconectar() error {
+	if sessao.token == "" {
+		return fmt.Errorf("servidor não ofereceu sessão retomável")
+	}
+
+	var erro error
+	for tentativa := 1; tentativa <= tentativasReconexao; tentativa++ {
+		sessao.logger.Info(fmt.Sprintf("Reconectando ao servidor (tentativa %d)...", tentativa))
+		erro = sessao.retomar()
+		if erro == nil {
+			return nil
+		}
+		sessao.logger.Erro(fmt.Sprintf("Falha ao reconectar: %v", erro))
+		time.Sleep(intervaloReconexao)
+	}
+	return erro
+}
+
+func (sessao *Sessao) retomar() error {
+	conexao, erro := sessao.conectar()
+	if erro != nil {
+		return erro
+	}
+
+	aceita, erro := tcpIP.SendIdentification(conexao, "veiculo", dataJson.Identificacao{Placa: sessao.Placa, Sessao: sessao.token})
+	if erro != nil {
+		conexao.Close()
+		return erro
+	}
+	if !aceita.Retomada {
+		// O servidor abriu uma sessão nova: a reserva anterior foi perdida
+		conexao.Close()
+		return fmt.Errorf("sessão expirada no servidor")
+	}
+
+	// Os tratadores precisam estar inscritos antes da leitura, pois as
+	// notificações perdidas chegam logo após a aceitação
+	dispatcher := tcpIP.NewDispatcher(conexao, sessao.logger)
+	sessao.mutex.Lock()
+	for tipo, handler := range sessao.inscricoes {
+		dispatcher.Subscribe(tipo, handler)
+	}
+	sessao.conexao = conexao
+	sessao.dispatcher = dispatcher
+	sessao.mutex.Unlock()
+
+	go dispatcher.Run()
+	sessao.logger.Info("Sessão retomada com o servidor")
+	return nil
+}
+
+func (sessao *Sessao) Close() error {
+	sessao.mutex.Lock()
+	defer sessao.mutex.Unlock()
+	return sessao.conexao.Close()
+}
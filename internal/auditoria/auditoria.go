@@ -0,0 +1,72 @@
+package auditoria
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Variavel de ambiente com o arquivo do log de auditoria
+const EnvArquivoAuditoria = "AUDITORIA_ARQUIVO"
+
+const arquivoPadrao = "auditoria.log"
+
+// Uma acao de operador registrada na auditoria
+type Registro struct {
+	Data      time.Time `json:"data"`
+	Operador  string    `json:"operador"`
+	Endereco  string    `json:"endereco"`
+	Acao      string    `json:"acao"`
+	Alvo      string    `json:"alvo,omitempty"`
+	Resultado string    `json:"resultado"` // "ok" ou o motivo da falha
+}
+
+// Log de auditoria em JSON, um registro por linha, aberto apenas para acrescentar
+type Auditoria struct {
+	mutex   sync.Mutex
+	arquivo *os.File
+}
+
+func Abrir(caminho string) (*Auditoria, error) {
+	arquivo, erro := os.OpenFile(caminho, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao abrir log de auditoria %s: %v", caminho, erro)
+	}
+	return &Auditoria{arquivo: arquivo}, nil
+}
+
+// Abre o log de auditoria indicado em AUDITORIA_ARQUIVO, ou auditoria.log
+func AbrirDoAmbiente() (*Auditoria, error) {
+	caminho := os.Getenv(EnvArquivoAuditoria)
+	if caminho == "" {
+		caminho = arquivoPadrao
+	}
+	return Abrir(caminho)
+}
+
+// Grava o registro e o sincroniza com o disco antes de retornar
+func (auditoria *Auditoria) Registrar(registro Registro) error {
+	if registro.Data.IsZero() {
+		registro.Data = time.Now()
+	}
+	linha, erro := json.Marshal(registro)
+	if erro != nil {
+		return erro
+	}
+	linha = append(linha, '\n')
+
+	auditoria.mutex.Lock()
+	defer auditoria.mutex.Unlock()
+	if _, erro := auditoria.arquivo.Write(linha); erro != nil {
+		return erro
+	}
+	return auditoria.arquivo.Sync()
+}
+
+func (auditoria *Auditoria) Close() error {
+	auditoria.mutex.Lock()
+	defer auditoria.mutex.Unlock()
+	return auditoria.arquivo.Close()
+}
@@ -0,0 +1,309 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Variaveis de ambiente dos snapshots do diretório de dados
+const (
+	EnvDiretorioBackup = "BACKUP_DIR"
+	EnvIntervaloBackup = "BACKUP_INTERVALO"
+	EnvRetencaoBackup  = "BACKUP_RETER"
+)
+
+const (
+	subdiretorioPadrao = "backups"
+	intervaloPadrao    = time.Hour
+	retencaoPadrao     = 24
+)
+
+// Formato do nome de cada snapshot, a data em que foi criado
+const LayoutNome = "20060102-150405"
+
+// Arquivos copiados em cada snapshot. O diário de eventos guarda apenas as
+// reservas e filas em andamento e não é restaurado.
+var Arquivos = []string{dataJson.ArquivoRegiao, dataJson.ArquivoVeiculos}
+
+// O snapshot não foi encontrado no diretório de backups
+var ErrSnapshotNaoEncontrado = errors.New("snapshot não encontrado")
+
+type Config struct {
+	Diretorio string        // onde os snapshots são criados
+	Intervalo time.Duration // entre snapshots; zero desativa o agendamento
+	Retencao  int           // quantidade de snapshots mantidos
+}
+
+// Um snapshot do diretório de dados: um diretório com a cópia dos arquivos
+// que existiam no momento em que foi criado
+type Snapshot struct {
+	Nome     string
+	Data     time.Time
+	Caminho  string
+	Arquivos []string
+}
+
+// Diretório indicado em BACKUP_DIR, ou backups dentro do diretório de dados
+func DiretorioDoAmbiente(diretorioDados string) string {
+	if diretorio := os.Getenv(EnvDiretorioBackup); diretorio != "" {
+		return diretorio
+	}
+	return filepath.Join(diretorioDados, subdiretorioPadrao)
+}
+
+// Le a configuração dos snapshots do ambiente. BACKUP_INTERVALO=0 desativa
+// os snapshots agendados.
+func ConfigDoAmbiente(diretorioDados string) (Config, error) {
+	config := Config{
+		Diretorio: DiretorioDoAmbiente(diretorioDados),
+		Intervalo: intervaloPadrao,
+		Retencao:  retencaoPadrao,
+	}
+	if valor := os.Getenv(EnvIntervaloBackup); valor != "" {
+		intervalo, erro := time.ParseDuration(valor)
+		if valor == "0" {
+			intervalo, erro = 0, nil
+		}
+		if erro != nil || intervalo < 0 {
+			return config, fmt.Errorf("%s invalido: %q", EnvIntervaloBackup, valor)
+		}
+		config.Intervalo = intervalo
+	}
+	if valor := os.Getenv(EnvRetencaoBackup); valor != "" {
+		retencao, erro := strconv.Atoi(valor)
+		if erro != nil || retencao <= 0 {
+			return config, fmt.Errorf("%s invalido: %q", EnvRetencaoBackup, valor)
+		}
+		config.Retencao = retencao
+	}
+	return config, nil
+}
+
+// Cria snapshots do diretório de dados a cada intervalo, começando por um na
+// inicialização, e remove os mais antigos além da retenção
+func Agendar(logger *logger.Logger, diretorioDados string, config Config) {
+	ticker := time.NewTicker(config.Intervalo)
+	defer ticker.Stop()
+
+	for {
+		snapshot, criado, erro := Criar(diretorioDados, config.Diretorio, time.Now())
+		switch {
+		case erro != nil:
+			logger.Erro(fmt.Sprintf("Erro ao criar snapshot dos dados: %v", erro))
+		case criado:
+			logger.Info(fmt.Sprintf("Snapshot dos dados criado em %s", snapshot.Caminho))
+		}
+		removidos, erro := Rotacionar(config.Diretorio, config.Retencao)
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao remover snapshots antigos: %v", erro))
+		}
+		if len(removidos) > 0 {
+			logger.Info(fmt.Sprintf("Snapshots antigos removidos: %v", removidos))
+		}
+		<-ticker.C
+	}
+}
+
+// Copia os arquivos de dados para um novo snapshot com o nome da data
+// informada. Se nenhum arquivo mudou desde o último snapshot, nada é criado e
+// o último é retornado com false. O snapshot é montado em um diretório
+// temporário e renomeado ao final, de forma que uma queda não deixa um
+// snapshot incompleto.
+func Criar(diretorioDados string, diretorioBackup string, data time.Time) (Snapshot, bool, error) {
+	conteudos := make(map[string][]byte)
+	for _, arquivo := range Arquivos {
+		conteudo, erro := os.ReadFile(filepath.Join(diretorioDados, arquivo))
+		if os.IsNotExist(erro) {
+			continue
+		}
+		if erro != nil {
+			return Snapshot{}, false, fmt.Errorf("erro ao ler %s: %v", arquivo, erro)
+		}
+		conteudos[arquivo] = conteudo
+	}
+
+	snapshots, erro := Listar(diretorioBackup)
+	if erro != nil {
+		return Snapshot{}, false, erro
+	}
+	if len(snapshots) > 0 {
+		ultimo := snapshots[len(snapshots)-1]
+		if igual, erro := mesmoConteudo(ultimo, conteudos); erro != nil || igual {
+			return ultimo, false, erro
+		}
+	}
+
+	nome := data.Format(LayoutNome)
+	caminho := filepath.Join(diretorioBackup, nome)
+	if _, erro := os.Stat(caminho); erro == nil {
+		return Snapshot{}, false, fmt.Errorf("snapshot %s já existe", nome)
+	}
+	if erro := os.MkdirAll(diretorioBackup, 0755); erro != nil {
+		return Snapshot{}, false, fmt.Errorf("erro ao criar diretório de backups %s: %v", diretorioBackup, erro)
+	}
+	temporario, erro := os.MkdirTemp(diretorioBackup, "."+nome+".*.tmp")
+	if erro != nil {
+		return Snapshot{}, false, fmt.Errorf("erro ao criar snapshot %s: %v", nome, erro)
+	}
+	defer os.RemoveAll(temporario)
+
+	snapshot := Snapshot{Nome: nome, Data: data, Caminho: caminho}
+	for _, arquivo := range Arquivos {
+		conteudo, existe := conteudos[arquivo]
+		if !existe {
+			continue
+		}
+		if erro := dataJson.GravarArquivoAtomico(filepath.Join(temporario, arquivo), conteudo, 0644); erro != nil {
+			return Snapshot{}, false, fmt.Errorf("erro ao copiar %s para o snapshot %s: %v", arquivo, nome, erro)
+		}
+		snapshot.Arquivos = append(snapshot.Arquivos, arquivo)
+	}
+	if erro := os.Rename(temporario, caminho); erro != nil {
+		return Snapshot{}, false, fmt.Errorf("erro ao criar snapshot %s: %v", nome, erro)
+	}
+	return snapshot, true, nil
+}
+
+// Confere se o snapshot tem exatamente os arquivos e conteúdos informados
+func mesmoConteudo(snapshot Snapshot, conteudos map[string][]byte) (bool, error) {
+	if len(snapshot.Arquivos) != len(conteudos) {
+		return false, nil
+	}
+	for _, arquivo := range snapshot.Arquivos {
+		atual, existe := conteudos[arquivo]
+		if !existe {
+			return false, nil
+		}
+		copia, erro := os.ReadFile(filepath.Join(snapshot.Caminho, arquivo))
+		if erro != nil {
+			return false, fmt.Errorf("erro ao ler %s do snapshot %s: %v", arquivo, snapshot.Nome, erro)
+		}
+		if !bytes.Equal(atual, copia) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Snapshots do diretório de backups, do mais antigo ao mais recente.
+// Diretórios temporários e nomes fora do formato são ignorados.
+func Listar(diretorioBackup string) ([]Snapshot, error) {
+	entradas, erro := os.ReadDir(diretorioBackup)
+	if os.IsNotExist(erro) {
+		return nil, nil
+	}
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao listar backups em %s: %v", diretorioBackup, erro)
+	}
+
+	var snapshots []Snapshot
+	for _, entrada := range entradas {
+		data, erro := time.ParseInLocation(LayoutNome, entrada.Name(), time.Local)
+		if !entrada.IsDir() || erro != nil {
+			continue
+		}
+		snapshot := Snapshot{Nome: entrada.Name(), Data: data, Caminho: filepath.Join(diretorioBackup, entrada.Name())}
+		for _, arquivo := range Arquivos {
+			if _, erro := os.Stat(filepath.Join(snapshot.Caminho, arquivo)); erro == nil {
+				snapshot.Arquivos = append(snapshot.Arquivos, arquivo)
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	// O nome tem a data em ordem de ano a segundo
+	slices.SortFunc(snapshots, func(a, b Snapshot) int { return strings.Compare(a.Nome, b.Nome) })
+	return snapshots, nil
+}
+
+// Remove os snapshots mais antigos, mantendo os reter mais recentes.
+// Retorna os nomes dos removidos.
+func Rotacionar(diretorioBackup string, reter int) ([]string, error) {
+	snapshots, erro := Listar(diretorioBackup)
+	if erro != nil || len(snapshots) <= reter {
+		return nil, erro
+	}
+	var removidos []string
+	for _, snapshot := range snapshots[:len(snapshots)-reter] {
+		if erro := os.RemoveAll(snapshot.Caminho); erro != nil {
+			return removidos, fmt.Errorf("erro ao remover snapshot %s: %v", snapshot.Nome, erro)
+		}
+		removidos = append(removidos, snapshot.Nome)
+	}
+	return removidos, nil
+}
+
+// Busca o snapshot pelo nome; "ultimo" indica o mais recente
+func Buscar(diretorioBackup string, nome string) (Snapshot, error) {
+	snapshots, erro := Listar(diretorioBackup)
+	if erro != nil {
+		return Snapshot{}, erro
+	}
+	if nome == "ultimo" && len(snapshots) > 0 {
+		return snapshots[len(snapshots)-1], nil
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Nome == nome {
+			return snapshot, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("%w: %s em %s", ErrSnapshotNaoEncontrado, nome, diretorioBackup)
+}
+
+// Lê os arquivos do snapshot e confere que cada um seria aceito pelo servidor
+func Validar(snapshot Snapshot) (map[string][]byte, error) {
+	if len(snapshot.Arquivos) == 0 {
+		return nil, fmt.Errorf("snapshot %s vazio", snapshot.Nome)
+	}
+	conteudos := make(map[string][]byte)
+	for _, arquivo := range snapshot.Arquivos {
+		conteudo, erro := os.ReadFile(filepath.Join(snapshot.Caminho, arquivo))
+		if erro != nil {
+			return nil, fmt.Errorf("erro ao ler %s do snapshot %s: %v", arquivo, snapshot.Nome, erro)
+		}
+		if erro := dataJson.ValidarArquivoDados(arquivo, conteudo); erro != nil {
+			return nil, fmt.Errorf("%s inválido no snapshot %s: %w", arquivo, snapshot.Nome, erro)
+		}
+		conteudos[arquivo] = conteudo
+	}
+	return conteudos, nil
+}
+
+// Volta o diretório de dados ao snapshot informado. Todos os arquivos do
+// snapshot são validados antes de qualquer alteração, e o estado atual é
+// guardado em um novo snapshot, retornado para que a restauração possa ser
+// desfeita. Cada arquivo é substituído de forma atômica; arquivos que não
+// existiam no snapshot são removidos.
+func Restaurar(diretorioDados string, diretorioBackup string, snapshot Snapshot, data time.Time) (Snapshot, error) {
+	conteudos, erro := Validar(snapshot)
+	if erro != nil {
+		return Snapshot{}, erro
+	}
+	anterior, _, erro := Criar(diretorioDados, diretorioBackup, data)
+	if erro != nil {
+		return Snapshot{}, fmt.Errorf("erro ao guardar o estado atual, nada foi restaurado: %v", erro)
+	}
+
+	for _, arquivo := range Arquivos {
+		caminho := filepath.Join(diretorioDados, arquivo)
+		conteudo, existe := conteudos[arquivo]
+		if !existe {
+			if erro := os.Remove(caminho); erro != nil && !os.IsNotExist(erro) {
+				return anterior, fmt.Errorf("erro ao remover %s: %v", caminho, erro)
+			}
+			continue
+		}
+		if erro := dataJson.GravarArquivoAtomico(caminho, conteudo, 0644); erro != nil {
+			return anterior, fmt.Errorf("erro ao restaurar %s: %v", caminho, erro)
+		}
+	}
+	return anterior, nil
+}
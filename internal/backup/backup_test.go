@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"testing"
+	"time"
+)
+
+const (
+	regiao   = `{"versao": 1, "pontos-de-recarga": [{"id": 1}]}`
+	veiculos = `{"versao": 1, "veiculos": [{"placa": "ABC1234", "recargas": [{"data": "2025-03-02 08:00:00", "ponto_id": 1, "valor": 30}]}]}`
+)
+
+func gravar(t *testing.T, diretorio string, arquivo string, conteudo string) {
+	t.Helper()
+	if erro := os.WriteFile(filepath.Join(diretorio, arquivo), []byte(conteudo), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+}
+
+func ler(t *testing.T, diretorio string, arquivo string) string {
+	t.Helper()
+	conteudo, erro := os.ReadFile(filepath.Join(diretorio, arquivo))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	return string(conteudo)
+}
+
+func TestCriarERotacionar(t *testing.T) {
+	dados, backups := t.TempDir(), filepath.Join(t.TempDir(), "backups")
+	gravar(t, dados, dataJson.ArquivoRegiao, regiao)
+	inicio := time.Date(2025, 3, 2, 10, 0, 0, 0, time.Local)
+
+	primeiro, criado, erro := Criar(dados, backups, inicio)
+	if erro != nil || !criado || primeiro.Nome != "20250302-100000" || len(primeiro.Arquivos) != 1 {
+		t.Fatalf("primeiro snapshot: %+v %v %v", primeiro, criado, erro)
+	}
+	// Sem alterações nos dados nenhum snapshot novo é criado
+	if mesmo, criado, erro := Criar(dados, backups, inicio.Add(time.Hour)); erro != nil || criado || mesmo.Nome != primeiro.Nome {
+		t.Fatalf("snapshot repetido: %+v %v %v", mesmo, criado, erro)
+	}
+
+	for i := 1; i <= 3; i++ {
+		gravar(t, dados, dataJson.ArquivoRegiao, fmt.Sprintf(`{"versao": 1, "pontos-de-recarga": [{"id": %d}]}`, i+1))
+		if _, criado, erro := Criar(dados, backups, inicio.Add(time.Duration(i)*time.Hour)); erro != nil || !criado {
+			t.Fatalf("snapshot %d: %v %v", i, criado, erro)
+		}
+	}
+	removidos, erro := Rotacionar(backups, 2)
+	if erro != nil || len(removidos) != 2 || removidos[0] != primeiro.Nome {
+		t.Fatalf("rotacao: %v %v", removidos, erro)
+	}
+	if snapshots, _ := Listar(backups); len(snapshots) != 2 || snapshots[1].Nome != "20250302-130000" {
+		t.Fatalf("snapshots mantidos: %+v", snapshots)
+	}
+}
+
+func TestRestaurar(t *testing.T) {
+	dados, backups := t.TempDir(), t.TempDir()
+	gravar(t, dados, dataJson.ArquivoRegiao, regiao)
+	gravar(t, dados, dataJson.ArquivoVeiculos, veiculos)
+	inicio := time.Date(2025, 3, 2, 10, 0, 0, 0, time.Local)
+	antes, _, erro := Criar(dados, backups, inicio)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+
+	// O histórico foi alterado depois do snapshot
+	alterado := `{"versao": 1, "veiculos": [{"placa": "ABC1234"}]}`
+	gravar(t, dados, dataJson.ArquivoVeiculos, alterado)
+
+	anterior, erro := Restaurar(dados, backups, antes, inicio.Add(time.Hour))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if ler(t, dados, dataJson.ArquivoVeiculos) != veiculos {
+		t.Fatal("veiculos.json nao restaurado")
+	}
+	// O estado substituído fica guardado para desfazer a restauração
+	if anterior.Nome != "20250302-110000" || ler(t, anterior.Caminho, dataJson.ArquivoVeiculos) != alterado {
+		t.Fatalf("estado anterior nao guardado: %+v", anterior)
+	}
+
+	if _, erro := Buscar(backups, "20240101-000000"); !errors.Is(erro, ErrSnapshotNaoEncontrado) {
+		t.Fatalf("esperado ErrSnapshotNaoEncontrado, recebido %v", erro)
+	}
+	if ultimo, erro := Buscar(backups, "ultimo"); erro != nil || ultimo.Nome != anterior.Nome {
+		t.Fatalf("ultimo snapshot: %+v %v", ultimo, erro)
+	}
+}
+
+// Um snapshot que o servidor não conseguiria ler não substitui nenhum arquivo
+func TestRestaurarSnapshotInvalido(t *testing.T) {
+	dados, backups := t.TempDir(), t.TempDir()
+	gravar(t, dados, dataJson.ArquivoRegiao, regiao)
+	gravar(t, dados, dataJson.ArquivoVeiculos, veiculos)
+	snapshot, _, erro := Criar(dados, backups, time.Date(2025, 3, 2, 10, 0, 0, 0, time.Local))
+	if erro != nil {
+		t.Fatal(erro)
+	}
+
+	for _, invalido := range []string{
+		`{"versao": 1, "veiculos": [{"placa": "ABC1234"`,
+		`{"versao": 99, "veiculos": []}`,
+		`{"versao": 1, "veiculos": {"placa": "ABC1234"}}`,
+	} {
+		gravar(t, snapshot.Caminho, dataJson.ArquivoVeiculos, invalido)
+		if _, erro := Restaurar(dados, backups, snapshot, time.Now()); erro == nil {
+			t.Fatalf("snapshot invalido restaurado: %s", invalido)
+		}
+	}
+	gravar(t, snapshot.Caminho, dataJson.ArquivoVeiculos, veiculos)
+	gravar(t, snapshot.Caminho, dataJson.ArquivoRegiao, `{"pontos-de-recarga": [{"id": 2}, {"id": 2}]}`)
+	if _, erro := Restaurar(dados, backups, snapshot, time.Now()); erro == nil {
+		t.Fatal("regiao com ponto repetido restaurada")
+	}
+
+	if ler(t, dados, dataJson.ArquivoRegiao) != regiao || ler(t, dados, dataJson.ArquivoVeiculos) != veiculos {
+		t.Fatal("dados alterados por restauracao recusada")
+	}
+	if snapshots, _ := Listar(backups); len(snapshots) != 1 {
+		t.Fatalf("snapshot criado por restauracao recusada: %+v", snapshots)
+	}
+}
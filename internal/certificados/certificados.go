@@ -0,0 +1,146 @@
+package certificados
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefixo do Common Name dos certificados de pontos de recarga: "ponto-<ID>"
+const prefixoPonto = "ponto-"
+
+// Nome (Common Name) do certificado do ponto de recarga com o ID informado
+func NomePonto(id int) string {
+	return prefixoPonto + strconv.Itoa(id)
+}
+
+// Extrai o ID do ponto de recarga do Common Name de um certificado
+func PontoIDDoNome(nome string) (int, bool) {
+	if !strings.HasPrefix(nome, prefixoPonto) {
+		return 0, false
+	}
+	id, erro := strconv.Atoi(strings.TrimPrefix(nome, prefixoPonto))
+	if erro != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// Certificado e chave privada prontos para assinar outros certificados
+type Autoridade struct {
+	Certificado *x509.Certificate
+	Chave       *ecdsa.PrivateKey
+}
+
+// Gera uma autoridade certificadora autoassinada para uso local
+func GerarAutoridade(nome string, validade time.Duration) (Autoridade, []byte, []byte, error) {
+	chave, erro := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if erro != nil {
+		return Autoridade{}, nil, nil, erro
+	}
+	modelo, erro := novoModelo(nome, validade)
+	if erro != nil {
+		return Autoridade{}, nil, nil, erro
+	}
+	modelo.IsCA = true
+	modelo.BasicConstraintsValid = true
+	modelo.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, erro := x509.CreateCertificate(rand.Reader, modelo, modelo, &chave.PublicKey, chave)
+	if erro != nil {
+		return Autoridade{}, nil, nil, fmt.Errorf("erro ao criar certificado da CA: %v", erro)
+	}
+	certificado, erro := x509.ParseCertificate(der)
+	if erro != nil {
+		return Autoridade{}, nil, nil, erro
+	}
+	certificadoPEM, chavePEM, erro := codificarPEM(der, chave)
+	if erro != nil {
+		return Autoridade{}, nil, nil, erro
+	}
+	return Autoridade{Certificado: certificado, Chave: chave}, certificadoPEM, chavePEM, nil
+}
+
+// Emite um certificado de servidor valido para os hosts (nomes ou IPs) informados
+func (autoridade Autoridade) EmitirServidor(nome string, hosts []string, validade time.Duration) ([]byte, []byte, error) {
+	modelo, erro := novoModelo(nome, validade)
+	if erro != nil {
+		return nil, nil, erro
+	}
+	modelo.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			modelo.IPAddresses = append(modelo.IPAddresses, ip)
+		} else {
+			modelo.DNSNames = append(modelo.DNSNames, host)
+		}
+	}
+	return autoridade.emitir(modelo)
+}
+
+// Emite um certificado de cliente, usado pelos pontos de recarga
+func (autoridade Autoridade) EmitirCliente(nome string, validade time.Duration) ([]byte, []byte, error) {
+	modelo, erro := novoModelo(nome, validade)
+	if erro != nil {
+		return nil, nil, erro
+	}
+	modelo.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	return autoridade.emitir(modelo)
+}
+
+func (autoridade Autoridade) emitir(modelo *x509.Certificate) ([]byte, []byte, error) {
+	chave, erro := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if erro != nil {
+		return nil, nil, erro
+	}
+	modelo.KeyUsage = x509.KeyUsageDigitalSignature
+	der, erro := x509.CreateCertificate(rand.Reader, modelo, autoridade.Certificado, &chave.PublicKey, autoridade.Chave)
+	if erro != nil {
+		return nil, nil, fmt.Errorf("erro ao emitir certificado %s: %v", modelo.Subject.CommonName, erro)
+	}
+	return codificarPEM(der, chave)
+}
+
+// Grava o certificado e a chave em <diretorio>/<nome>.pem e <diretorio>/<nome>-key.pem
+func Salvar(diretorio string, nome string, certificadoPEM []byte, chavePEM []byte) error {
+	erro := os.WriteFile(filepath.Join(diretorio, nome+".pem"), certificadoPEM, 0644)
+	if erro != nil {
+		return erro
+	}
+	return os.WriteFile(filepath.Join(diretorio, nome+"-key.pem"), chavePEM, 0600)
+}
+
+func novoModelo(nome string, validade time.Duration) (*x509.Certificate, error) {
+	serial, erro := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if erro != nil {
+		return nil, erro
+	}
+	agora := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: nome, Organization: []string{"recarga-inteligente"}},
+		NotBefore:    agora.Add(-time.Hour),
+		NotAfter:     agora.Add(validade),
+	}, nil
+}
+
+func codificarPEM(der []byte, chave *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	chaveDER, erro := x509.MarshalPKCS8PrivateKey(chave)
+	if erro != nil {
+		return nil, nil, erro
+	}
+	certificadoPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	chavePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: chaveDER})
+	return certificadoPEM, chavePEM, nil
+}
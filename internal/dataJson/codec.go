@@ -0,0 +1,361 @@
+package dataJson
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Codec converte uma Mensagem no conteudo de um quadro e vice-versa.
+// O enquadramento (tamanho de cada quadro) e responsabilidade de Conn.
+type Codec interface {
+	Nome() string
+	Encode(msg Mensagem) ([]byte, error)
+	Decode(quadro []byte) (Mensagem, error)
+}
+
+// Nomes dos codecs, anunciados como recursos na identificacao
+const (
+	CodecJSON    = "codec-json"
+	CodecBinario = "codec-binario"
+)
+
+// Retorna o codec escolhido para o protocolo negociado
+func CodecDoProtocolo(protocolo Protocolo) Codec {
+	if protocolo.TemRecurso(CodecBinario) {
+		return BinaryCodec{}
+	}
+	return JSONCodec{}
+}
+
+// Payload de cada tipo de mensagem. Tipos mapeados para nil nao carregam dados.
+var tiposPayload = map[string]reflect.Type{
+	"identificacao":          reflect.TypeFor[Identificacao](),
+	"identificacao-aceita":   reflect.TypeFor[IdentificacaoAceita](),
+	"identificacao-recusada": reflect.TypeFor[IdentificacaoRecusada](),
+	"verificar-placa":        reflect.TypeFor[VerificarPlaca](),
+	"placa-disponivel":       nil,
+	"placa-indisponivel":     nil,
+	"placa-invalida":         nil,
+	"get-recarga":            nil,
+	"get-localizacao":        reflect.TypeFor[DadosRegiao](),
+	"localizacao":            reflect.TypeFor[Localizacao](),
+	"ranking-pontos":         reflect.TypeFor[RankingPontos](),
+	"solicitar-reserva":      reflect.TypeFor[SolicitarReserva](),
+	"reserva-confirmada":     reflect.TypeFor[ReservaConfirmada](),
+	"reserva-falhou":         reflect.TypeFor[ReservaFalhou](),
+	"cancelar-reserva":       reflect.TypeFor[CancelarReserva](),
+	"posicao-fila":           reflect.TypeFor[PosicaoFila](),
+	"sua-vez":                reflect.TypeFor[SuaVez](),
+	"veiculo-chegou":         reflect.TypeFor[VeiculoChegou](),
+	"recarga-iniciada":       nil,
+	"recarga-finalizada":     reflect.TypeFor[RecargaFinalizada](),
+	"consultar-historico":    nil,
+	"historico-recargas":     reflect.TypeFor[HistoricoRecargas](),
+	"historico-erro":         nil,
+	"limpar-historico":       nil,
+	"pagamento-confirmado":   nil,
+	"erro-pagamento":         nil,
+	"chamando-veiculo":       reflect.TypeFor[ChamandoVeiculo](),
+	"nova-solicitacao":       reflect.TypeFor[NovaSolicitacao](),
+	"status-fila":            reflect.TypeFor[StatusFila](),
+	"get-disponibilidade":    nil,
+	"disponibilidade":        reflect.TypeFor[Disponibilidade](),
+	"atualizar-fila":         reflect.TypeFor[Fila](),
+	"fila-atualizada":        reflect.TypeFor[Fila](),
+	"liberar-ponto":          nil,
+	"reserva-cancelada":      reflect.TypeFor[ReservaCancelada](),
+	"listar-conexoes":        nil,
+	"lista-conexoes":         reflect.TypeFor[ListaConexoes](),
+	"consultar-fila":         reflect.TypeFor[PedidoFila](),
+	"fila-ponto":             reflect.TypeFor[FilaPonto](),
+	"editar-fila":            reflect.TypeFor[PedidoFila](),
+	"forcar-liberacao":       reflect.TypeFor[ForcarLiberacao](),
+	"desconectar-cliente":    reflect.TypeFor[DesconectarCliente](),
+	"cadastrar-senha":        reflect.TypeFor[CadastrarSenha](),
+	"compactar-diario":       nil,
+	"diario-compactado":      reflect.TypeFor[DiarioCompactado](),
+	"operacao-concluida":     nil,
+	"operacao-falhou":        reflect.TypeFor[OperacaoFalhou](),
+	"limite-excedido":        reflect.TypeFor[LimiteExcedido](),
+	"pedido-invalido":        reflect.TypeFor[PedidoInvalido](),
+	"ping":                   nil,
+	"pong":                   nil,
+}
+
+// Retorna os tipos de mensagem conhecidos e o tipo Go do payload de cada um
+func TiposPayload() map[string]reflect.Type {
+	copia := make(map[string]reflect.Type, len(tiposPayload))
+	for tipo, payload := range tiposPayload {
+		copia[tipo] = payload
+	}
+	return copia
+}
+
+// JSONCodec e o codec padrao, usado ate o fim da identificacao
+type JSONCodec struct{}
+
+func (JSONCodec) Nome() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Encode(msg Mensagem) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (JSONCodec) Decode(quadro []byte) (Mensagem, error) {
+	var msg Mensagem
+	erro := json.Unmarshal(quadro, &msg)
+	return msg, erro
+}
+
+// Formato dos dados dentro de um quadro binario
+const (
+	dadosAusentes byte = iota
+	dadosBinarios
+	dadosJSON
+)
+
+// BinaryCodec codifica o envelope com varints e o payload campo a campo, na
+// ordem de declaracao da struct registrada em tiposPayload. Tipos sem payload
+// registrado, ou com payload que nao pode ser codificado, seguem em JSON.
+// A ordem dos campos faz parte do formato: mudancas nas structs exigem uma
+// nova versao do protocolo.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Nome() string {
+	return CodecBinario
+}
+
+func (BinaryCodec) Encode(msg Mensagem) ([]byte, error) {
+	quadro := binary.AppendVarint(nil, int64(msg.Versao))
+	quadro = binary.AppendUvarint(quadro, msg.ID)
+	quadro = binary.AppendUvarint(quadro, msg.ReplyTo)
+	quadro = appendString(quadro, msg.Tipo)
+	quadro = appendString(quadro, msg.Origem)
+
+	if len(msg.Dados) == 0 {
+		return append(quadro, dadosAusentes), nil
+	}
+
+	if tipoPayload := tiposPayload[msg.Tipo]; tipoPayload != nil {
+		valor := reflect.New(tipoPayload)
+		if json.Unmarshal(msg.Dados, valor.Interface()) == nil {
+			comPayload, erro := appendValor(append(quadro, dadosBinarios), valor.Elem())
+			if erro == nil {
+				return comPayload, nil
+			}
+		}
+	}
+
+	quadro = append(quadro, dadosJSON)
+	return appendBytes(quadro, msg.Dados), nil
+}
+
+func (BinaryCodec) Decode(quadro []byte) (Mensagem, error) {
+	var msg Mensagem
+	leitor := &leitorBinario{dados: quadro}
+
+	msg.Versao = int(leitor.varint())
+	msg.ID = leitor.uvarint()
+	msg.ReplyTo = leitor.uvarint()
+	msg.Tipo = leitor.string()
+	msg.Origem = leitor.string()
+
+	switch leitor.byte() {
+	case dadosAusentes:
+	case dadosBinarios:
+		tipoPayload := tiposPayload[msg.Tipo]
+		if tipoPayload == nil {
+			return msg, fmt.Errorf("payload binario para tipo sem registro: %s", msg.Tipo)
+		}
+		valor := reflect.New(tipoPayload)
+		leitor.valor(valor.Elem())
+		if leitor.erro != nil {
+			return msg, leitor.erro
+		}
+		dados, erro := json.Marshal(valor.Interface())
+		if erro != nil {
+			return msg, erro
+		}
+		msg.Dados = dados
+	case dadosJSON:
+		msg.Dados = json.RawMessage(leitor.bytes())
+	default:
+		return msg, fmt.Errorf("formato de dados desconhecido no quadro binario")
+	}
+
+	if leitor.erro != nil {
+		return msg, leitor.erro
+	}
+	if len(leitor.dados) != 0 {
+		return msg, fmt.Errorf("%d bytes sobrando no quadro binario", len(leitor.dados))
+	}
+	return msg, nil
+}
+
+func appendString(destino []byte, texto string) []byte {
+	destino = binary.AppendUvarint(destino, uint64(len(texto)))
+	return append(destino, texto...)
+}
+
+func appendBytes(destino []byte, dados []byte) []byte {
+	destino = binary.AppendUvarint(destino, uint64(len(dados)))
+	return append(destino, dados...)
+}
+
+func appendValor(destino []byte, valor reflect.Value) ([]byte, error) {
+	switch valor.Kind() {
+	case reflect.Bool:
+		if valor.Bool() {
+			return append(destino, 1), nil
+		}
+		return append(destino, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(destino, valor.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(destino, valor.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(destino, math.Float64bits(valor.Float())), nil
+	case reflect.String:
+		return appendString(destino, valor.String()), nil
+	case reflect.Slice:
+		// 0 representa slice nil; caso contrario, tamanho + 1
+		if valor.IsNil() {
+			return binary.AppendUvarint(destino, 0), nil
+		}
+		destino = binary.AppendUvarint(destino, uint64(valor.Len())+1)
+		for i := 0; i < valor.Len(); i++ {
+			var erro error
+			destino, erro = appendValor(destino, valor.Index(i))
+			if erro != nil {
+				return nil, erro
+			}
+		}
+		return destino, nil
+	case reflect.Struct:
+		for i := 0; i < valor.NumField(); i++ {
+			if !valor.Type().Field(i).IsExported() {
+				continue
+			}
+			var erro error
+			destino, erro = appendValor(destino, valor.Field(i))
+			if erro != nil {
+				return nil, erro
+			}
+		}
+		return destino, nil
+	default:
+		return nil, fmt.Errorf("tipo nao suportado pelo codec binario: %s", valor.Type())
+	}
+}
+
+var errQuadroCurto = errors.New("quadro binario truncado")
+
+// Le valores de um quadro binario, guardando o primeiro erro encontrado
+type leitorBinario struct {
+	dados []byte
+	erro  error
+}
+
+func (leitor *leitorBinario) falhar(erro error) {
+	if leitor.erro == nil {
+		leitor.erro = erro
+	}
+	leitor.dados = nil
+}
+
+func (leitor *leitorBinario) byte() byte {
+	if len(leitor.dados) < 1 {
+		leitor.falhar(errQuadroCurto)
+		return 0
+	}
+	valor := leitor.dados[0]
+	leitor.dados = leitor.dados[1:]
+	return valor
+}
+
+func (leitor *leitorBinario) varint() int64 {
+	valor, n := binary.Varint(leitor.dados)
+	if n <= 0 {
+		leitor.falhar(errQuadroCurto)
+		return 0
+	}
+	leitor.dados = leitor.dados[n:]
+	return valor
+}
+
+func (leitor *leitorBinario) uvarint() uint64 {
+	valor, n := binary.Uvarint(leitor.dados)
+	if n <= 0 {
+		leitor.falhar(errQuadroCurto)
+		return 0
+	}
+	leitor.dados = leitor.dados[n:]
+	return valor
+}
+
+func (leitor *leitorBinario) bytes() []byte {
+	tamanho := leitor.uvarint()
+	if tamanho > uint64(len(leitor.dados)) {
+		leitor.falhar(errQuadroCurto)
+		return nil
+	}
+	valor := leitor.dados[:tamanho]
+	leitor.dados = leitor.dados[tamanho:]
+	return valor
+}
+
+func (leitor *leitorBinario) string() string {
+	return string(leitor.bytes())
+}
+
+func (leitor *leitorBinario) valor(valor reflect.Value) {
+	if leitor.erro != nil {
+		return
+	}
+	switch valor.Kind() {
+	case reflect.Bool:
+		valor.SetBool(leitor.byte() != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		valor.SetInt(leitor.varint())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		valor.SetUint(leitor.uvarint())
+	case reflect.Float32, reflect.Float64:
+		if len(leitor.dados) < 8 {
+			leitor.falhar(errQuadroCurto)
+			return
+		}
+		valor.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(leitor.dados)))
+		leitor.dados = leitor.dados[8:]
+	case reflect.String:
+		valor.SetString(leitor.string())
+	case reflect.Slice:
+		tamanho := leitor.uvarint()
+		if tamanho == 0 {
+			return
+		}
+		// Cada elemento ocupa ao menos um byte, o que limita o tamanho declarado
+		if tamanho-1 > uint64(len(leitor.dados)) {
+			leitor.falhar(errQuadroCurto)
+			return
+		}
+		slice := reflect.MakeSlice(valor.Type(), int(tamanho-1), int(tamanho-1))
+		for i := 0; i < slice.Len() && leitor.erro == nil; i++ {
+			leitor.valor(slice.Index(i))
+		}
+		valor.Set(slice)
+	case reflect.Struct:
+		for i := 0; i < valor.NumField() && leitor.erro == nil; i++ {
+			if !valor.Type().Field(i).IsExported() {
+				continue
+			}
+			leitor.valor(valor.Field(i))
+		}
+	default:
+		leitor.falhar(fmt.Errorf("tipo nao suportado pelo codec binario: %s", valor.Type()))
+	}
+}
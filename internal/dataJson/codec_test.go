@@ -0,0 +1,206 @@
+package dataJson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Preenche todos os campos exportados com valores diferentes de zero
+func preencher(valor reflect.Value, semente int) {
+	switch valor.Kind() {
+	case reflect.Bool:
+		valor.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		valor.SetInt(int64(-semente - 1))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		valor.SetUint(uint64(semente + 300))
+	case reflect.Float32, reflect.Float64:
+		valor.SetFloat(float64(semente) - 12.625)
+	case reflect.String:
+		valor.SetString(fmt.Sprintf("valor-%d-ção", semente))
+	case reflect.Slice:
+		slice := reflect.MakeSlice(valor.Type(), 2, 2)
+		for i := 0; i < slice.Len(); i++ {
+			preencher(slice.Index(i), semente+i+1)
+		}
+		valor.Set(slice)
+	case reflect.Struct:
+		for i := 0; i < valor.NumField(); i++ {
+			if valor.Type().Field(i).IsExported() {
+				preencher(valor.Field(i), semente+i)
+			}
+		}
+	}
+}
+
+func tiposOrdenados() []string {
+	tipos := make([]string, 0, len(tiposPayload))
+	for tipo := range tiposPayload {
+		tipos = append(tipos, tipo)
+	}
+	sort.Strings(tipos)
+	return tipos
+}
+
+// Monta uma mensagem de exemplo para o tipo, com payload totalmente preenchido
+func mensagemExemplo(t testing.TB, tipo string) Mensagem {
+	t.Helper()
+	var dados any
+	if tipoPayload := tiposPayload[tipo]; tipoPayload != nil {
+		valor := reflect.New(tipoPayload)
+		preencher(valor.Elem(), len(tipo))
+		dados = valor.Interface()
+	}
+	msg, erro := NewMensagem(tipo, "servidor", dados)
+	if erro != nil {
+		t.Fatalf("NewMensagem(%s): %v", tipo, erro)
+	}
+	msg.ID = 1 << 40
+	msg.ReplyTo = 7
+	return msg
+}
+
+func conferirMensagem(t *testing.T, codec Codec, esperada, recebida Mensagem) {
+	t.Helper()
+	if recebida.Versao != esperada.Versao || recebida.ID != esperada.ID || recebida.ReplyTo != esperada.ReplyTo ||
+		recebida.Tipo != esperada.Tipo || recebida.Origem != esperada.Origem {
+		t.Fatalf("%s: envelope diferente: esperado %+v, recebido %+v", codec.Nome(), esperada, recebida)
+	}
+
+	tipoPayload := tiposPayload[esperada.Tipo]
+	if tipoPayload == nil {
+		if !bytes.Equal(recebida.Dados, esperada.Dados) {
+			t.Fatalf("%s: dados diferentes em %s: %s", codec.Nome(), esperada.Tipo, recebida.Dados)
+		}
+		return
+	}
+
+	original := reflect.New(tipoPayload)
+	decodificado := reflect.New(tipoPayload)
+	// Os exemplos usam valores negativos para exercitar os varints, então o
+	// payload é decodificado sem a validação de DecodeDados
+	if erro := json.Unmarshal(esperada.Dados, original.Interface()); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := json.Unmarshal(recebida.Dados, decodificado.Interface()); erro != nil {
+		t.Fatalf("%s: %v", codec.Nome(), erro)
+	}
+	if !reflect.DeepEqual(original.Interface(), decodificado.Interface()) {
+		t.Fatalf("%s: payload diferente em %s:\nesperado %+v\nrecebido %+v",
+			codec.Nome(), esperada.Tipo, original.Elem(), decodificado.Elem())
+	}
+}
+
+func TestCodecsRoundTripTodosOsTipos(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+		for _, tipo := range tiposOrdenados() {
+			t.Run(codec.Nome()+"/"+tipo, func(t *testing.T) {
+				msg := mensagemExemplo(t, tipo)
+				quadro, erro := codec.Encode(msg)
+				if erro != nil {
+					t.Fatalf("Encode: %v", erro)
+				}
+				recebida, erro := codec.Decode(quadro)
+				if erro != nil {
+					t.Fatalf("Decode: %v", erro)
+				}
+				conferirMensagem(t, codec, msg, recebida)
+			})
+		}
+	}
+}
+
+func TestBinaryCodecUsaPayloadBinario(t *testing.T) {
+	for _, tipo := range tiposOrdenados() {
+		if tiposPayload[tipo] == nil {
+			continue
+		}
+		msg := mensagemExemplo(t, tipo)
+		binario, erro := BinaryCodec{}.Encode(msg)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		texto, _ := JSONCodec{}.Encode(msg)
+		if len(binario) >= len(texto) {
+			t.Errorf("%s: quadro binario (%d bytes) nao e menor que o JSON (%d bytes)", tipo, len(binario), len(texto))
+		}
+	}
+}
+
+func TestBinaryCodecSlicesVaziasENulas(t *testing.T) {
+	for _, dados := range []any{Fila{}, Fila{Placas: []string{}}, RankingPontos{Pontos: []PontoRankeado{}}} {
+		msg, _ := NewMensagem("fila-atualizada", "servidor", dados)
+		if _, ehRanking := dados.(RankingPontos); ehRanking {
+			msg.Tipo = "ranking-pontos"
+		}
+		quadro, erro := BinaryCodec{}.Encode(msg)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		recebida, erro := BinaryCodec{}.Decode(quadro)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		if !bytes.Equal(recebida.Dados, msg.Dados) {
+			t.Errorf("esperado %s, recebido %s", msg.Dados, recebida.Dados)
+		}
+	}
+}
+
+func TestBinaryCodecTipoDesconhecidoSegueEmJSON(t *testing.T) {
+	msg := Mensagem{Versao: VersaoPayload, ID: 3, Tipo: "tipo-futuro", Origem: "veiculo", Dados: json.RawMessage(`{"x":[1,2]}`)}
+	quadro, erro := BinaryCodec{}.Encode(msg)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	recebida, erro := BinaryCodec{}.Decode(quadro)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if !reflect.DeepEqual(recebida, msg) {
+		t.Fatalf("esperado %+v, recebido %+v", msg, recebida)
+	}
+}
+
+func TestBinaryCodecQuadroTruncado(t *testing.T) {
+	msg := mensagemExemplo(t, "historico-recargas")
+	quadro, erro := BinaryCodec{}.Encode(msg)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	for tamanho := 0; tamanho < len(quadro); tamanho++ {
+		if _, erro := (BinaryCodec{}).Decode(quadro[:tamanho]); erro == nil {
+			t.Fatalf("quadro com %d de %d bytes decodificado sem erro", tamanho, len(quadro))
+		}
+	}
+}
+
+func TestConnTrocaDeCodec(t *testing.T) {
+	ladoA, ladoB := net.Pipe()
+	connA, connB := NewConn(ladoA), NewConn(ladoB)
+	defer connA.Close()
+	defer connB.Close()
+
+	connA.SetCodec(BinaryCodec{})
+	connB.SetCodec(BinaryCodec{})
+
+	for _, tipo := range tiposOrdenados() {
+		msg := mensagemExemplo(t, tipo)
+		erros := make(chan error, 1)
+		go func() { erros <- SendMessage(connA, msg) }()
+
+		recebida, erro := ReceiveMessage(connB)
+		if erro != nil {
+			t.Fatalf("%s: %v", tipo, erro)
+		}
+		if erro := <-erros; erro != nil {
+			t.Fatalf("%s: %v", tipo, erro)
+		}
+		conferirMensagem(t, connB.Codec(), msg, recebida)
+	}
+}
@@ -0,0 +1,176 @@
+package dataJson
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Tamanho do cabecalho de cada quadro: 4 bytes (big-endian) com o tamanho do conteudo
+const tamanhoCabecalho = 4
+
+// Maior quadro aceito, em qualquer transporte. Um quadro maior indica um
+// cliente defeituoso ou malicioso, e a conexao deve ser encerrada.
+const TamanhoMaximoQuadro = 256 << 10
+
+var ErrQuadroGrande = fmt.Errorf("quadro maior que %d bytes", TamanhoMaximoQuadro)
+
+// Transporte entrega e recebe quadros completos, cada um com uma mensagem
+// codificada. Permite que o servidor trate da mesma forma clientes conectados
+// por TCP ou por outros meios, como WebSocket.
+type Transporte interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(dados []byte) error
+	// Estado TLS da conexao, ou nil se ela nao usa TLS
+	EstadoTLS() *tls.ConnectionState
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// Conn encapsula uma conexao durante toda a sua vida, mantendo um unico
+// leitor e um unico escritor sobre o seu Transporte. O conteudo de cada
+// quadro e codificado pelo Codec da conexao, JSON ate que a identificacao
+// negocie outro.
+type Conn struct {
+	transporte   Transporte
+	mutexLeitura sync.Mutex
+	mutexEscrita sync.Mutex
+	ultimoID     atomic.Uint64
+	mutexCodec   sync.Mutex
+	codec        Codec
+}
+
+// Cria uma Conn sobre uma conexao TCP, em que cada mensagem trafega em um
+// quadro prefixado pelo seu tamanho
+func NewConn(conexao net.Conn) *Conn {
+	return NewConnTransporte(&transporteTCP{
+		conexao: conexao,
+		leitor:  bufio.NewReader(conexao),
+	})
+}
+
+func NewConnTransporte(transporte Transporte) *Conn {
+	return &Conn{
+		transporte: transporte,
+		codec:      JSONCodec{},
+	}
+}
+
+func (conn *Conn) Codec() Codec {
+	conn.mutexCodec.Lock()
+	defer conn.mutexCodec.Unlock()
+	return conn.codec
+}
+
+// Troca o codec usado nos proximos quadros lidos e escritos
+func (conn *Conn) SetCodec(codec Codec) {
+	conn.mutexCodec.Lock()
+	defer conn.mutexCodec.Unlock()
+	conn.codec = codec
+}
+
+// Le o proximo quadro completo da conexao
+func (conn *Conn) ReadFrame() ([]byte, error) {
+	conn.mutexLeitura.Lock()
+	defer conn.mutexLeitura.Unlock()
+	return conn.transporte.ReadFrame()
+}
+
+// Escreve um quadro completo, evitando que mensagens enviadas por goroutines
+// diferentes se misturem
+func (conn *Conn) WriteFrame(dados []byte) error {
+	conn.mutexEscrita.Lock()
+	defer conn.mutexEscrita.Unlock()
+	return conn.transporte.WriteFrame(dados)
+}
+
+// Gera o proximo ID de mensagem desta conexao
+func (conn *Conn) NextID() uint64 {
+	return conn.ultimoID.Add(1)
+}
+
+// Retorna o Common Name do certificado verificado apresentado pelo outro
+// lado da conexao, ou false se a conexao nao usa TLS ou nao houve certificado
+func (conn *Conn) IdentidadeTLS() (string, bool) {
+	estado := conn.transporte.EstadoTLS()
+	if estado == nil {
+		return "", false
+	}
+	cadeias := estado.VerifiedChains
+	if len(cadeias) == 0 || len(cadeias[0]) == 0 {
+		return "", false
+	}
+	return cadeias[0][0].Subject.CommonName, true
+}
+
+// Indica se a conexao usa TLS
+func (conn *Conn) TLS() bool {
+	return conn.transporte.EstadoTLS() != nil
+}
+
+func (conn *Conn) RemoteAddr() net.Addr {
+	return conn.transporte.RemoteAddr()
+}
+
+func (conn *Conn) Close() error {
+	return conn.transporte.Close()
+}
+
+// Transporte TCP: cada quadro e prefixado pelo seu tamanho, de modo que
+// mensagens enviadas em sequencia nao se perdem entre leituras
+type transporteTCP struct {
+	conexao net.Conn
+	leitor  *bufio.Reader
+}
+
+func (transporte *transporteTCP) ReadFrame() ([]byte, error) {
+	var cabecalho [tamanhoCabecalho]byte
+	if _, erro := io.ReadFull(transporte.leitor, cabecalho[:]); erro != nil {
+		return nil, erro
+	}
+
+	tamanho := binary.BigEndian.Uint32(cabecalho[:])
+	if tamanho > TamanhoMaximoQuadro {
+		return nil, ErrQuadroGrande
+	}
+	quadro := make([]byte, tamanho)
+	if _, erro := io.ReadFull(transporte.leitor, quadro); erro != nil {
+		return nil, fmt.Errorf("quadro incompleto: %w", erro)
+	}
+	return quadro, nil
+}
+
+// Escreve cabecalho e conteudo em uma unica escrita
+func (transporte *transporteTCP) WriteFrame(dados []byte) error {
+	if len(dados) > TamanhoMaximoQuadro {
+		return ErrQuadroGrande
+	}
+	quadro := make([]byte, tamanhoCabecalho+len(dados))
+	binary.BigEndian.PutUint32(quadro, uint32(len(dados)))
+	copy(quadro[tamanhoCabecalho:], dados)
+
+	_, erro := transporte.conexao.Write(quadro)
+	return erro
+}
+
+func (transporte *transporteTCP) EstadoTLS() *tls.ConnectionState {
+	conexaoTLS, ehTLS := transporte.conexao.(*tls.Conn)
+	if !ehTLS {
+		return nil
+	}
+	estado := conexaoTLS.ConnectionState()
+	return &estado
+}
+
+func (transporte *transporteTCP) RemoteAddr() net.Addr {
+	return transporte.conexao.RemoteAddr()
+}
+
+func (transporte *transporteTCP) Close() error {
+	return transporte.conexao.Close()
+}
@@ -0,0 +1,39 @@
+package dataJson
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCredencialDoPonto(t *testing.T) {
+	soma := sha256.Sum256([]byte("segredo-do-ponto"))
+	hash := hex.EncodeToString(soma[:])
+
+	casos := []struct {
+		nome       string
+		hash       string
+		credencial string
+		aceita     bool
+	}{
+		{"credencial certa", hash, "segredo-do-ponto", true},
+		{"hash em maiusculas", strings.ToUpper(hash), "segredo-do-ponto", true},
+		{"credencial errada", hash, "segredo-do-ponto2", false},
+		{"credencial vazia", hash, "", false},
+		// Pontos sem credencial cadastrada não são aceitos
+		{"sem hash", "", "segredo-do-ponto", false},
+		{"sem hash e sem credencial", "", "", false},
+		{"credencial igual ao hash", hash, hash, false},
+		{"hash truncado", hash[:32], "segredo-do-ponto", false},
+		{"hash invalido", "zz", "segredo-do-ponto", false},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			ponto := Ponto{ID: 1, Credencial: caso.hash}
+			if aceita := ponto.CredencialValida(caso.credencial); aceita != caso.aceita {
+				t.Fatalf("CredencialValida(%q) = %v, esperado %v", caso.credencial, aceita, caso.aceita)
+			}
+		})
+	}
+}
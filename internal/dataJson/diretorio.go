@@ -0,0 +1,89 @@
+package dataJson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Variavel de ambiente com o diretório dos arquivos de dados
+const EnvDiretorioDados = "DADOS_DIR"
+
+// Arquivos guardados no diretório de dados
+const (
+	ArquivoRegiao   = "regiao.json"
+	ArquivoVeiculos = "veiculos.json"
+	ArquivoEventos  = "eventos.jsonl"
+)
+
+var diretorioPadrao = filepath.Join("app", "internal", "dataJson")
+
+// Diretório de onde todos os arquivos de dados são lidos e onde são
+// gravados, definido em ConfigurarDiretorioDados antes de iniciar o servidor
+var diretorioDados = diretorioPadrao
+
+func ConfigurarDiretorioDados(diretorio string) {
+	diretorioDados = diretorio
+}
+
+func DiretorioDados() string {
+	return diretorioDados
+}
+
+// Caminho do arquivo dentro do diretório de dados
+func CaminhoDados(arquivo string) string {
+	return filepath.Join(diretorioDados, arquivo)
+}
+
+// Diretório indicado em DADOS_DIR, ou app/internal/dataJson
+func DiretorioDadosDoAmbiente() string {
+	if diretorio := os.Getenv(EnvDiretorioDados); diretorio != "" {
+		return diretorio
+	}
+	return diretorioPadrao
+}
+
+// Confere que o diretório existe e aceita gravações, criando e removendo um
+// arquivo temporário nele
+func VerificarDiretorioDados(diretorio string) error {
+	info, erro := os.Stat(diretorio)
+	if erro != nil {
+		return fmt.Errorf("diretório de dados %s inacessível: %v", diretorio, erro)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("diretório de dados %s não é um diretório", diretorio)
+	}
+	temporario, erro := os.CreateTemp(diretorio, ".verificacao-*.tmp")
+	if erro != nil {
+		return fmt.Errorf("diretório de dados %s não aceita gravações: %v", diretorio, erro)
+	}
+	temporario.Close()
+	return os.Remove(temporario.Name())
+}
+
+// Confere que o conteúdo de regiao.json ou veiculos.json seria aceito pelo
+// servidor: a versão é suportada e, após as migrações, o JSON decodifica no
+// formato do arquivo. Em regiao.json os IDs dos pontos também são conferidos.
+func ValidarArquivoDados(arquivo string, conteudo []byte) error {
+	migrado, _, erro := Migrar(arquivo, conteudo)
+	if erro != nil {
+		return erro
+	}
+	switch arquivo {
+	case ArquivoRegiao:
+		var dados DadosRegiao
+		if erro := json.Unmarshal(migrado, &dados); erro != nil {
+			return fmt.Errorf("erro ao ler %s: %v", arquivo, erro)
+		}
+		_, erro = indexarPontos(dados)
+		return erro
+	case ArquivoVeiculos:
+		var dados DadosVeiculos
+		if erro := json.Unmarshal(migrado, &dados); erro != nil {
+			return fmt.Errorf("erro ao ler %s: %v", arquivo, erro)
+		}
+		return nil
+	}
+	return fmt.Errorf("arquivo de dados desconhecido: %s", arquivo)
+}
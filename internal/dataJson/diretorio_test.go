@@ -0,0 +1,26 @@
+package dataJson
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerificarDiretorioDados(t *testing.T) {
+	diretorio := t.TempDir()
+	if erro := VerificarDiretorioDados(diretorio); erro != nil {
+		t.Fatal(erro)
+	}
+	if restantes, _ := os.ReadDir(diretorio); len(restantes) != 0 {
+		t.Fatalf("arquivo de verificacao deixado no diretorio: %v", restantes)
+	}
+
+	if VerificarDiretorioDados(filepath.Join(diretorio, "inexistente")) == nil {
+		t.Fatal("diretorio inexistente aceito")
+	}
+	arquivo := filepath.Join(diretorio, ArquivoRegiao)
+	os.WriteFile(arquivo, []byte("{}"), 0644)
+	if VerificarDiretorioDados(arquivo) == nil {
+		t.Fatal("arquivo aceito como diretorio de dados")
+	}
+}
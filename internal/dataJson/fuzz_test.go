@@ -0,0 +1,105 @@
+package dataJson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Conexao em memoria que le os quadros de dados
+func connEmMemoria(dados []byte, codec Codec) *Conn {
+	conexao := NewConnTransporte(&transporteTCP{leitor: bufio.NewReader(bytes.NewReader(dados))})
+	conexao.SetCodec(codec)
+	return conexao
+}
+
+func enquadrar(quadro []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(quadro))), quadro...)
+}
+
+func FuzzReceiveMessage(f *testing.F) {
+	for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+		for _, tipo := range tiposOrdenados() {
+			quadro, erro := codec.Encode(mensagemExemplo(f, tipo))
+			if erro != nil {
+				f.Fatal(erro)
+			}
+			f.Add(enquadrar(quadro))
+		}
+	}
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff}) // quadro maior que TamanhoMaximoQuadro
+	f.Add(enquadrar([]byte(`{"versao":1,"tipo":"localizacao","dados":{"latitude":"NaN"}}`)))
+
+	f.Fuzz(func(t *testing.T, dados []byte) {
+		for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+			conexao := connEmMemoria(dados, codec)
+			for {
+				msg, erro := ReceiveMessage(conexao)
+				if erro != nil {
+					break
+				}
+				// Payloads aceitos pelo codec passam por DecodeDados sem pânico, e os
+				// que passam na validação sobrevivem a uma nova codificação
+				tipoPayload := tiposPayload[msg.Tipo]
+				if tipoPayload == nil || len(msg.Dados) == 0 {
+					continue
+				}
+				valor := reflect.New(tipoPayload)
+				if msg.DecodeDados(valor.Interface()) != nil {
+					continue
+				}
+				reenviada, erro := NewMensagem(msg.Tipo, msg.Origem, valor.Interface())
+				if erro != nil {
+					t.Fatalf("payload valido de %s nao pode ser serializado: %v", msg.Tipo, erro)
+				}
+				if _, erro := codec.Encode(reenviada); erro != nil {
+					t.Fatalf("%s: payload valido de %s nao pode ser codificado: %v", codec.Nome(), msg.Tipo, erro)
+				}
+			}
+		}
+	})
+}
+
+func FuzzParseFila(f *testing.F) {
+	f.Add([]byte(`{"placas":["ABC1234","DEF1G23"]}`))
+	f.Add([]byte(`{"placas":[]}`))
+	f.Add([]byte(`{"placas":[""]}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"placas":"ABC1234"}`))
+
+	f.Fuzz(func(t *testing.T, dados []byte) {
+		placas, erro := ParseFila(dados)
+		if erro != nil {
+			return
+		}
+		if len(placas) > tamanhoMaximoLista {
+			t.Fatalf("fila com %d placas aceita", len(placas))
+		}
+		for _, placa := range placas {
+			if placa == "" || len(placa) > tamanhoMaximoPlaca {
+				t.Fatalf("placa %q aceita na fila", placa)
+			}
+		}
+	})
+}
+
+func TestTodosOsPayloadsSaoValidados(t *testing.T) {
+	for tipo, tipoPayload := range tiposPayload {
+		if tipoPayload == nil {
+			continue
+		}
+		if _, ok := reflect.New(tipoPayload).Interface().(validavel); !ok {
+			t.Errorf("payload de %s (%s) nao implementa Validar", tipo, tipoPayload)
+		}
+	}
+}
+
+func TestQuadroGrandeRecusado(t *testing.T) {
+	conexao := connEmMemoria(binary.BigEndian.AppendUint32(nil, TamanhoMaximoQuadro+1), JSONCodec{})
+	if _, erro := ReceiveMessage(conexao); !errors.Is(erro, ErrQuadroGrande) {
+		t.Fatalf("esperado ErrQuadroGrande, recebido %v", erro)
+	}
+}
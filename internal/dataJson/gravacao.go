@@ -0,0 +1,57 @@
+package dataJson
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Grava o conteúdo em um arquivo temporário no mesmo diretório e o renomeia
+// sobre o destino, de forma que uma queda no meio da gravação deixa o
+// arquivo anterior intacto. O arquivo e o diretório são sincronizados com o
+// disco antes de retornar.
+func GravarArquivoAtomico(caminho string, conteudo []byte, permissao os.FileMode) error {
+	diretorio := filepath.Dir(caminho)
+	temporario, erro := os.CreateTemp(diretorio, "."+filepath.Base(caminho)+".*.tmp")
+	if erro != nil {
+		return erro
+	}
+	gravado := false
+	defer func() {
+		if !gravado {
+			temporario.Close()
+			os.Remove(temporario.Name())
+		}
+	}()
+
+	if _, erro := temporario.Write(conteudo); erro != nil {
+		return erro
+	}
+	if erro := temporario.Chmod(permissao); erro != nil {
+		return erro
+	}
+	if erro := temporario.Sync(); erro != nil {
+		return erro
+	}
+	if erro := temporario.Close(); erro != nil {
+		return erro
+	}
+	if erro := os.Rename(temporario.Name(), caminho); erro != nil {
+		return erro
+	}
+	gravado = true
+	return sincronizarDiretorio(diretorio)
+}
+
+// Sincroniza o diretório para que a renomeação sobreviva a uma queda
+func sincronizarDiretorio(diretorio string) error {
+	arquivo, erro := os.Open(diretorio)
+	if erro != nil {
+		return erro
+	}
+	defer arquivo.Close()
+	if erro := arquivo.Sync(); erro != nil {
+		return fmt.Errorf("erro ao sincronizar %s: %v", diretorio, erro)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package dataJson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// O arquivo foi gravado por uma versão mais nova do servidor e não é lido,
+// para não perder os campos que esta versão desconhece
+var ErrVersaoDesconhecida = errors.New("versão do arquivo de dados mais nova que a suportada")
+
+// Uma migração leva o conteúdo de um arquivo de dados da versão De para a
+// versão De+1, alterando o JSON decodificado. Os números chegam como
+// json.Number.
+type Migracao struct {
+	De        int
+	Descricao string
+	Aplicar   func(dados map[string]any) error
+}
+
+// Migrações de cada arquivo de dados, em ordem. A versão atual de um arquivo
+// é o número de migrações registradas para ele; os arquivos sem o campo
+// "versao" são da versão 0. Uma mudança no formato de Recarga, por exemplo,
+// entra como uma nova migração de veiculos.json que preenche o novo campo
+// nos registros existentes.
+var migracoes = map[string][]Migracao{
+	ArquivoVeiculos: {
+		{De: 0, Descricao: "adiciona o campo versao", Aplicar: semAlteracao},
+		{De: 1, Descricao: "marca as recargas existentes como não pagas", Aplicar: recargasNaoPagas},
+	},
+	ArquivoRegiao: {
+		{De: 0, Descricao: "adiciona o campo versao", Aplicar: semAlteracao},
+	},
+}
+
+func semAlteracao(map[string]any) error {
+	return nil
+}
+
+// Até a versão 1 o pagamento apagava as recargas, então as que ficaram no
+// arquivo ainda não foram pagas
+func recargasNaoPagas(dados map[string]any) error {
+	veiculos, _ := dados["veiculos"].([]any)
+	for _, veiculo := range veiculos {
+		campos, ok := veiculo.(map[string]any)
+		if !ok {
+			return fmt.Errorf("veículo inválido: %v", veiculo)
+		}
+		recargas, _ := campos["recargas"].([]any)
+		for _, recarga := range recargas {
+			camposRecarga, ok := recarga.(map[string]any)
+			if !ok {
+				return fmt.Errorf("recarga inválida do veículo %v: %v", campos["placa"], recarga)
+			}
+			camposRecarga["pago"] = false
+		}
+	}
+	return nil
+}
+
+// Versão gravada nos arquivos de dados por esta versão do servidor
+func VersaoAtual(arquivo string) int {
+	return len(migracoes[arquivo])
+}
+
+// Migrações registradas para o arquivo, da versão informada até a atual
+func MigracoesPendentes(arquivo string, versao int) []Migracao {
+	if versao >= VersaoAtual(arquivo) {
+		return nil
+	}
+	return migracoes[arquivo][versao:]
+}
+
+// Aplica ao conteúdo do arquivo as migrações que faltam para a versão
+// atual. Retorna o conteúdo migrado, com o campo versao atualizado, e a
+// versão em que o arquivo estava. Arquivos já na versão atual são
+// devolvidos sem alteração.
+func Migrar(arquivo string, conteudo []byte) ([]byte, int, error) {
+	dados := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(conteudo))
+	decoder.UseNumber()
+	if erro := decoder.Decode(&dados); erro != nil {
+		return nil, 0, fmt.Errorf("erro ao ler %s: %v", arquivo, erro)
+	}
+
+	versao := 0
+	if valor, existe := dados["versao"]; existe {
+		numero, ok := valor.(json.Number)
+		lida, erro := numero.Int64()
+		if !ok || erro != nil || lida < 0 {
+			return nil, 0, fmt.Errorf("campo versao inválido em %s: %v", arquivo, valor)
+		}
+		versao = int(lida)
+	}
+	atual := VersaoAtual(arquivo)
+	if versao > atual {
+		return nil, versao, fmt.Errorf("%w: %s na versão %d, suportada até %d", ErrVersaoDesconhecida, arquivo, versao, atual)
+	}
+	if versao == atual {
+		return conteudo, versao, nil
+	}
+
+	for _, migracao := range MigracoesPendentes(arquivo, versao) {
+		if erro := migracao.Aplicar(dados); erro != nil {
+			return nil, versao, fmt.Errorf("erro ao migrar %s da versão %d (%s): %v", arquivo, migracao.De, migracao.Descricao, erro)
+		}
+	}
+	dados["versao"] = atual
+	migrado, erro := json.MarshalIndent(dados, "", "  ")
+	if erro != nil {
+		return nil, versao, fmt.Errorf("erro ao serializar %s migrado: %v", arquivo, erro)
+	}
+	return append(migrado, '\n'), versao, nil
+}
@@ -0,0 +1,97 @@
+package dataJson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// As migrações de cada arquivo começam na versão 0 e seguem sem lacunas
+func TestMigracoesEmSequencia(t *testing.T) {
+	for arquivo, lista := range migracoes {
+		for i, migracao := range lista {
+			if migracao.De != i || migracao.Aplicar == nil {
+				t.Errorf("%s: migracao %d parte da versao %d", arquivo, i, migracao.De)
+			}
+		}
+	}
+}
+
+func TestMigrarArquivoSemVersao(t *testing.T) {
+	antigo := []byte(`{"veiculos": [{"placa": "ABC1234", "recargas": [{"data": "2025-01-02 10:00:00", "ponto_id": 2, "valor": 30.5}]}]}`)
+	migrado, versao, erro := Migrar(ArquivoVeiculos, antigo)
+	if erro != nil || versao != 0 {
+		t.Fatalf("migracao: versao %d, erro %v", versao, erro)
+	}
+	var dados DadosVeiculos
+	if erro := json.Unmarshal(migrado, &dados); erro != nil {
+		t.Fatal(erro)
+	}
+	if dados.Versao != VersaoAtual(ArquivoVeiculos) || len(dados.Veiculos) != 1 || dados.Veiculos[0].Recargas[0].Valor != 30.5 {
+		t.Fatalf("conteudo migrado inesperado: %+v", dados)
+	}
+
+	// Um arquivo já na versão atual não é alterado
+	if mesmo, versao, erro := Migrar(ArquivoVeiculos, migrado); erro != nil || versao != VersaoAtual(ArquivoVeiculos) || string(mesmo) != string(migrado) {
+		t.Fatalf("arquivo atual alterado: versao %d, erro %v", versao, erro)
+	}
+}
+
+func TestMigrarVersaoMaisNova(t *testing.T) {
+	_, _, erro := Migrar(ArquivoRegiao, []byte(`{"versao": 99, "pontos-de-recarga": []}`))
+	if !errors.Is(erro, ErrVersaoDesconhecida) {
+		t.Fatalf("esperado ErrVersaoDesconhecida, recebido %v", erro)
+	}
+	if _, _, erro := Migrar(ArquivoRegiao, []byte(`{"versao": "1"}`)); erro == nil {
+		t.Fatal("versao em texto aceita")
+	}
+}
+
+// Um novo campo em Recarga entra como migração que preenche os registros antigos
+func TestMigracaoDeCampoNovo(t *testing.T) {
+	anteriores := migracoes[ArquivoVeiculos]
+	t.Cleanup(func() { migracoes[ArquivoVeiculos] = anteriores })
+	migracoes[ArquivoVeiculos] = append(anteriores[:len(anteriores):len(anteriores)], Migracao{
+		De:        len(anteriores),
+		Descricao: "adiciona consumo_kwh às recargas",
+		Aplicar: func(dados map[string]any) error {
+			veiculos, _ := dados["veiculos"].([]any)
+			for _, veiculo := range veiculos {
+				recargas, _ := veiculo.(map[string]any)["recargas"].([]any)
+				for _, recarga := range recargas {
+					recarga.(map[string]any)["consumo_kwh"] = -1
+				}
+			}
+			return nil
+		},
+	})
+
+	atual := len(anteriores)
+	migrado, versao, erro := Migrar(ArquivoVeiculos, []byte(fmt.Sprintf(`{"versao": %d, "veiculos": [{"placa": "ABC1234", "recargas": [{"ponto_id": 2, "valor": 30}]}]}`, atual)))
+	if erro != nil || versao != atual {
+		t.Fatalf("migracao: versao %d, erro %v", versao, erro)
+	}
+	if !strings.Contains(string(migrado), `"consumo_kwh": -1`) || !strings.Contains(string(migrado), fmt.Sprintf(`"versao": %d`, atual+1)) {
+		t.Fatalf("campo novo nao preenchido: %s", migrado)
+	}
+}
+
+// Na versão 1 o pagamento apagava as recargas; as que restaram não foram pagas
+func TestMigracaoRecargasPagas(t *testing.T) {
+	migrado, versao, erro := Migrar(ArquivoVeiculos, []byte(`{"versao": 1, "veiculos": [{"placa": "ABC1234", "recargas": [{"ponto_id": 2, "valor": 30}, {"ponto_id": 3, "valor": 12}]}, {"placa": "DEF5G67"}]}`))
+	if erro != nil || versao != 1 {
+		t.Fatalf("migracao: versao %d, erro %v", versao, erro)
+	}
+	var dados DadosVeiculos
+	if erro := json.Unmarshal(migrado, &dados); erro != nil {
+		t.Fatal(erro)
+	}
+	if dados.Versao != 2 || len(dados.Veiculos[0].Recargas) != 2 || strings.Count(string(migrado), `"pago": false`) != 2 {
+		t.Fatalf("recargas nao marcadas como nao pagas: %s", migrado)
+	}
+	if _, _, erro := Migrar(ArquivoVeiculos, []byte(`{"versao": 1, "veiculos": [{"placa": "ABC1234", "recargas": [30]}]}`)); erro == nil {
+		t.Fatal("recarga invalida migrada")
+	}
+}
@@ -0,0 +1,287 @@
+package dataJson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Versao do esquema dos payloads carregados em Mensagem.Dados
+const VersaoPayload = 1
+
+// Motivos informados em ReservaFalhou
+const (
+	MotivoPontoNaoEncontrado = "ponto-nao-encontrado"
+	MotivoFalhaComunicacao   = "falha-comunicacao"
+	MotivoPedidoInvalido     = "pedido-invalido"
+)
+
+// Motivos informados em OperacaoFalhou, além dos de ReservaFalhou
+const (
+	MotivoSemReserva           = "sem-reserva"
+	MotivoVeiculoNaoEncontrado = "veiculo-nao-encontrado"
+	MotivoFilaDivergente       = "fila-divergente" // a nova fila inclui placas que não estão na fila do ponto
+	MotivoDiarioIndisponivel   = "diario-indisponivel"
+	MotivoFalhaCompactacao     = "falha-compactacao"
+	MotivoSenhaJaCadastrada    = "senha-ja-cadastrada"
+	MotivoFalhaCadastro        = "falha-cadastro"
+)
+
+// identificacao
+type Identificacao struct {
+	Versoes  []int    `json:"versoes"`
+	Recursos []string `json:"recursos,omitempty"`
+	Placa    string   `json:"placa,omitempty"`
+	Sessao   string   `json:"sessao,omitempty"` // token de uma sessao a retomar
+	Senha    string   `json:"senha,omitempty"`  // senha ou PIN do veiculo; cadastrada no primeiro acesso
+	// Identidade do ponto de recarga, conferida com o cadastro em regiao.json
+	PontoID    int    `json:"ponto_id,omitempty"`
+	Credencial string `json:"credencial,omitempty"` // credencial do ponto ou do operador
+	Operador   string `json:"operador,omitempty"`   // nome do operador, registrado na auditoria
+}
+
+// identificacao-aceita
+type IdentificacaoAceita struct {
+	Versao   int      `json:"versao"`
+	Recursos []string `json:"recursos"`
+	Sessao   string   `json:"sessao,omitempty"`   // token para retomar a sessao apos uma queda
+	Retomada bool     `json:"retomada,omitempty"` // a sessao informada na identificacao foi retomada
+}
+
+// Protocolo escolhido pelo servidor
+func (aceita IdentificacaoAceita) Protocolo() Protocolo {
+	return Protocolo{Versao: aceita.Versao, Recursos: aceita.Recursos}
+}
+
+// identificacao-recusada
+type IdentificacaoRecusada struct {
+	Motivo            string `json:"motivo"`
+	VersoesSuportadas []int  `json:"versoes_suportadas,omitempty"`
+	BloqueadoAte      string `json:"bloqueado_ate,omitempty"` // RFC 3339, quando o motivo é veiculo-bloqueado
+}
+
+// verificar-placa
+type VerificarPlaca struct {
+	Placa string `json:"placa"`
+}
+
+type PontoRankeado struct {
+	ID          int     `json:"id"`
+	DistanciaKm float64 `json:"distancia_km"`
+	Fila        int     `json:"fila"`
+}
+
+// ranking-pontos
+type RankingPontos struct {
+	Pontos []PontoRankeado `json:"pontos"`
+}
+
+// solicitar-reserva
+type SolicitarReserva struct {
+	PontoID int `json:"ponto_id"`
+}
+
+// reserva-confirmada
+type ReservaConfirmada struct {
+	PontoID int `json:"ponto_id"`
+	Posicao int `json:"posicao"`
+}
+
+// reserva-falhou
+type ReservaFalhou struct {
+	PontoID int    `json:"ponto_id"`
+	Motivo  string `json:"motivo"`
+}
+
+// sua-vez
+type SuaVez struct {
+	PontoID int `json:"ponto_id"`
+}
+
+// posicao-fila
+type PosicaoFila struct {
+	PontoID int `json:"ponto_id"`
+}
+
+// chamando-veiculo
+type ChamandoVeiculo struct {
+	Placa string `json:"placa"`
+}
+
+// veiculo-chegou
+type VeiculoChegou struct {
+	Placa string `json:"placa"`
+}
+
+// nova-solicitacao
+type NovaSolicitacao struct {
+	Placa string `json:"placa"`
+}
+
+// status-fila
+type StatusFila struct {
+	Posicao int `json:"posicao"`
+}
+
+// disponibilidade
+type Disponibilidade struct {
+	TamanhoFila int `json:"tamanho_fila"`
+}
+
+// atualizar-fila / fila-atualizada
+type Fila struct {
+	Placas []string `json:"placas"`
+}
+
+// cancelar-reserva
+type CancelarReserva struct {
+	Placa string `json:"placa"`
+}
+
+// recarga-finalizada
+type RecargaFinalizada struct {
+	Placa      string  `json:"placa"`
+	PontoID    int     `json:"ponto_id"`
+	ConsumoKwh float64 `json:"consumo_kwh"`
+	Valor      float64 `json:"valor"`
+}
+
+// historico-recargas
+type HistoricoRecargas struct {
+	Recargas []Recarga `json:"recargas"`
+}
+
+// reserva-cancelada, enviada ao veículo quando um operador cancela a reserva
+type ReservaCancelada struct {
+	PontoID int `json:"ponto_id"`
+}
+
+// Mensagens do operador
+
+type ConexaoPonto struct {
+	ID       int    `json:"id"`
+	Endereco string `json:"endereco"`
+}
+
+type ConexaoVeiculo struct {
+	Placa          string `json:"placa"`
+	Endereco       string `json:"endereco"`
+	PontoReservado int    `json:"ponto_reservado,omitempty"`
+}
+
+// lista-conexoes, resposta a listar-conexoes
+type ListaConexoes struct {
+	Pontos   []ConexaoPonto   `json:"pontos"`
+	Veiculos []ConexaoVeiculo `json:"veiculos"`
+}
+
+// consultar-fila / editar-fila, pedidos do operador sobre a fila de um ponto
+type PedidoFila struct {
+	PontoID int      `json:"ponto_id"`
+	Placas  []string `json:"placas"`
+}
+
+// fila-ponto, a fila informada pelo ponto ou repassada ao operador
+type FilaPonto struct {
+	PontoID int      `json:"ponto_id"`
+	Placas  []string `json:"placas"`
+}
+
+// forcar-liberacao
+type ForcarLiberacao struct {
+	PontoID int `json:"ponto_id"`
+}
+
+// desconectar-cliente: informe o ID do ponto ou a placa do veículo
+type DesconectarCliente struct {
+	PontoID int    `json:"ponto_id,omitempty"`
+	Placa   string `json:"placa,omitempty"`
+}
+
+// cadastrar-senha: senha de um veículo cadastrado antes das senhas
+type CadastrarSenha struct {
+	Placa string `json:"placa"`
+	Senha string `json:"senha"`
+}
+
+// diario-compactado, resposta a compactar-diario
+type DiarioCompactado struct {
+	Seq     uint64 `json:"seq"`     // último evento incluído no snapshot
+	Eventos int    `json:"eventos"` // eventos retirados do diário
+}
+
+// operacao-falhou
+type OperacaoFalhou struct {
+	Motivo string `json:"motivo"`
+}
+
+// limite-excedido, resposta a uma mensagem recusada pelo limite de taxa
+type LimiteExcedido struct {
+	Tipo       string `json:"tipo"`         // tipo da mensagem recusada
+	TentarEmMs int64  `json:"tentar_em_ms"` // espera até a próxima mensagem desse tipo ser aceita
+}
+
+// pedido-invalido, resposta a uma mensagem de tipo desconhecido ou com payload invalido
+type PedidoInvalido struct {
+	Tipo   string `json:"tipo,omitempty"`  // tipo da mensagem recusada
+	Campo  string `json:"campo,omitempty"` // campo que não passou na validação
+	Motivo string `json:"motivo"`
+}
+
+// Monta uma mensagem serializando o payload no esquema atual
+func NewMensagem(tipo string, origem string, dados any) (Mensagem, error) {
+	msg := Mensagem{
+		Versao: VersaoPayload,
+		Tipo:   tipo,
+		Origem: origem,
+	}
+	if dados == nil {
+		return msg, nil
+	}
+
+	bruto, erro := json.Marshal(dados)
+	if erro != nil {
+		return msg, fmt.Errorf("erro ao serializar payload de %s: %v", tipo, erro)
+	}
+	msg.Dados = bruto
+	return msg, nil
+}
+
+// Decodifica o payload da mensagem no destino informado e confere os seus
+// campos. Erros de validação podem ser obtidos com errors.As em *ErroValidacao.
+func (msg Mensagem) DecodeDados(destino any) error {
+	if msg.Versao != VersaoPayload {
+		return fmt.Errorf("versao de payload nao suportada em %s: %d", msg.Tipo, msg.Versao)
+	}
+	if len(msg.Dados) == 0 {
+		return fmt.Errorf("mensagem %s sem dados", msg.Tipo)
+	}
+	erro := json.Unmarshal(msg.Dados, destino)
+	if erro != nil {
+		return fmt.Errorf("payload invalido em %s: %v", msg.Tipo, erro)
+	}
+	if payload, ok := destino.(validavel); ok {
+		if erro := payload.Validar(); erro != nil {
+			return fmt.Errorf("payload invalido em %s: %w", msg.Tipo, erro)
+		}
+	}
+	return nil
+}
+
+// Monta e envia uma mensagem com o payload informado
+func SendPayload(conexao *Conn, tipo string, origem string, dados any) error {
+	msg, erro := NewMensagem(tipo, origem, dados)
+	if erro != nil {
+		return erro
+	}
+	return SendMessage(conexao, msg)
+}
+
+// Monta e envia a resposta a uma mensagem recebida, correlacionada pelo ID do pedido
+func SendReply(conexao *Conn, pedido Mensagem, tipo string, origem string, dados any) error {
+	msg, erro := NewMensagem(tipo, origem, dados)
+	if erro != nil {
+		return erro
+	}
+	msg.ReplyTo = pedido.ID
+	return SendMessage(conexao, msg)
+}
@@ -0,0 +1,36 @@
+package dataJson
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrPlacaInvalida = errors.New("placa inválida: use o formato ABC-1234 ou o Mercosul ABC1D23")
+
+// Normaliza a placa para letras maiúsculas sem hífen, aceitando o formato
+// antigo (ABC-1234 ou ABC1234) e o Mercosul (ABC1D23). A placa normalizada é
+// a usada no ConnectionStore e em veiculos.json.
+func NormalizarPlaca(placa string) (string, error) {
+	normalizada := strings.ToUpper(strings.TrimSpace(placa))
+	if len(normalizada) == 8 && normalizada[3] == '-' {
+		normalizada = normalizada[:3] + normalizada[4:]
+	}
+	if len(normalizada) != 7 {
+		return "", ErrPlacaInvalida
+	}
+
+	for i := 0; i < len(normalizada); i++ {
+		c := normalizada[i]
+		letra := c >= 'A' && c <= 'Z'
+		digito := c >= '0' && c <= '9'
+		switch {
+		case i < 3 && !letra:
+			return "", ErrPlacaInvalida
+		case i == 4 && !letra && !digito: // letra no Mercosul, dígito no formato antigo
+			return "", ErrPlacaInvalida
+		case (i == 3 || i > 4) && !digito:
+			return "", ErrPlacaInvalida
+		}
+	}
+	return normalizada, nil
+}
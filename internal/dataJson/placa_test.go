@@ -0,0 +1,45 @@
+package dataJson
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizarPlaca(t *testing.T) {
+	casos := []struct {
+		placa    string
+		esperada string // vazia se a placa deve ser recusada
+	}{
+		{"ABC1234", "ABC1234"},
+		{"ABC-1234", "ABC1234"},
+		{"abc-1234", "ABC1234"},
+		{"  abc1234\n", "ABC1234"},
+		{"ABC1D23", "ABC1D23"},
+		{"abc1d23", "ABC1D23"},
+		{"", ""},
+		{"ABC123", ""},
+		{"ABC12345", ""},
+		{"ABC-1D23", "ABC1D23"},
+		{"ABC--234", ""},
+		{"AB-1234", ""},
+		{"1BC1234", ""},
+		{"ABCD234", ""},
+		{"ABC12D4", ""},
+		{"ABC1DD3", ""},
+		{"ABC 1234", ""},
+		{"ÁBC1234", ""},
+		{"ABC１234", ""},
+	}
+	for _, caso := range casos {
+		normalizada, erro := NormalizarPlaca(caso.placa)
+		if caso.esperada == "" {
+			if !errors.Is(erro, ErrPlacaInvalida) || normalizada != "" {
+				t.Errorf("NormalizarPlaca(%q) = %q, %v; esperado ErrPlacaInvalida", caso.placa, normalizada, erro)
+			}
+			continue
+		}
+		if erro != nil || normalizada != caso.esperada {
+			t.Errorf("NormalizarPlaca(%q) = %q, %v; esperado %q", caso.placa, normalizada, erro, caso.esperada)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dataJson
+
+import "slices"
+
+// Faixa de versoes do protocolo de mensagens implementadas por este codigo
+const (
+	VersaoProtocoloMinima = 1
+	VersaoProtocoloAtual  = 1
+)
+
+// Recursos opcionais anunciados na identificacao
+const (
+	RecursoHistorico = "historico" // consulta e pagamento do historico de recargas
+	RecursoHeartbeat = "heartbeat" // responde "ping" com "pong"
+	RecursoSessao    = "sessao"    // recebe um token para retomar a sessao apos uma queda
+)
+
+// Motivos informados em IdentificacaoRecusada
+const (
+	MotivoVersaoIncompativel    = "versao-incompativel"
+	MotivoPlacaEmUso            = "placa-em-uso"
+	MotivoPontoNaoCadastrado    = "ponto-nao-cadastrado"
+	MotivoIdentificacaoPendente = "identificacao-pendente"
+	MotivoCertificadoAusente    = "certificado-ausente"
+	MotivoCertificadoInvalido   = "certificado-invalido"
+	MotivoPontoIndisponivel     = "ponto-indisponivel"
+	MotivoCredencialInvalida    = "credencial-invalida"
+	MotivoSenhaInvalida         = "senha-invalida"
+	MotivoVeiculoBloqueado      = "veiculo-bloqueado"
+	MotivoSenhaPendente         = "senha-pendente"
+	MotivoAutenticacaoPendente  = "autenticacao-pendente"
+	MotivoPlacaInvalida         = "placa-invalida"
+	MotivoOperadorDesabilitado  = "operador-desabilitado"
+)
+
+// Protocolo negociado para uma conexao
+type Protocolo struct {
+	Versao   int
+	Recursos []string
+}
+
+func (protocolo Protocolo) TemRecurso(recurso string) bool {
+	return slices.Contains(protocolo.Recursos, recurso)
+}
+
+// Versoes que este lado sabe falar, da mais nova para a mais antiga
+func VersoesSuportadas() []int {
+	versoes := make([]int, 0, VersaoProtocoloAtual-VersaoProtocoloMinima+1)
+	for versao := VersaoProtocoloAtual; versao >= VersaoProtocoloMinima; versao-- {
+		versoes = append(versoes, versao)
+	}
+	return versoes
+}
+
+func RecursosSuportados() []string {
+	return []string{RecursoHistorico, RecursoHeartbeat, RecursoSessao, CodecBinario}
+}
+
+// Escolhe a maior versao em comum e os recursos suportados pelos dois lados
+func NegociarProtocolo(versoes []int, recursos []string) (Protocolo, bool) {
+	escolhida := 0
+	for _, versao := range versoes {
+		if versao >= VersaoProtocoloMinima && versao <= VersaoProtocoloAtual && versao > escolhida {
+			escolhida = versao
+		}
+	}
+	if escolhida == 0 {
+		return Protocolo{}, false
+	}
+
+	comuns := []string{}
+	for _, recurso := range RecursosSuportados() {
+		if slices.Contains(recursos, recurso) {
+			comuns = append(comuns, recurso)
+		}
+	}
+	return Protocolo{Versao: escolhida, Recursos: comuns}, true
+}
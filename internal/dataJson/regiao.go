@@ -0,0 +1,174 @@
+package dataJson
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Conteúdo de regiao.json mantido em memória, com os pontos indexados por
+// ID. Cada carregamento gera um novo registro, substituído de uma vez, de
+// forma que as consultas nunca veem uma região pela metade.
+type registroRegiao struct {
+	caminho     string
+	modificacao time.Time
+	tamanho     int64
+	dados       DadosRegiao
+	pontos      map[int]Ponto
+}
+
+var (
+	regiaoAtual atomic.Pointer[registroRegiao]
+	regiaoMutex sync.Mutex // serializa os carregamentos
+	// Versão de regiao.json que falhou ao carregar, para não repetir o erro a
+	// cada verificação enquanto o arquivo não for alterado
+	regiaoFalha struct {
+		modificacao time.Time
+		tamanho     int64
+	}
+)
+
+// Pontos incluídos, retirados ou alterados em um recarregamento de regiao.json
+type AlteracaoRegiao struct {
+	Adicionados []int
+	Retirados   []int
+	Alterados   []int
+}
+
+func (alteracao AlteracaoRegiao) Vazia() bool {
+	return len(alteracao.Adicionados) == 0 && len(alteracao.Retirados) == 0 && len(alteracao.Alterados) == 0
+}
+
+func carregarRegiao(info os.FileInfo) (*registroRegiao, error) {
+	dados, erro := OpenFile(ArquivoRegiao)
+	if erro != nil {
+		return nil, erro
+	}
+	pontos, erro := indexarPontos(dados)
+	if erro != nil {
+		return nil, erro
+	}
+	return &registroRegiao{
+		caminho:     CaminhoDados(ArquivoRegiao),
+		modificacao: info.ModTime(),
+		tamanho:     info.Size(),
+		dados:       dados,
+		pontos:      pontos,
+	}, nil
+}
+
+// Pontos da região por ID, recusando IDs inválidos ou repetidos
+func indexarPontos(dados DadosRegiao) (map[int]Ponto, error) {
+	pontos := make(map[int]Ponto, len(dados.PontosDeRecarga))
+	for _, ponto := range dados.PontosDeRecarga {
+		if ponto.ID <= 0 {
+			return nil, fmt.Errorf("ponto com ID inválido em %s: %d", ArquivoRegiao, ponto.ID)
+		}
+		if _, repetido := pontos[ponto.ID]; repetido {
+			return nil, fmt.Errorf("ponto %d repetido em %s", ponto.ID, ArquivoRegiao)
+		}
+		pontos[ponto.ID] = ponto
+	}
+	return pontos, nil
+}
+
+// Região carregada do diretório de dados atual, lida do arquivo apenas na
+// primeira consulta
+func regiao() (*registroRegiao, error) {
+	if atual := regiaoAtual.Load(); atual != nil && atual.caminho == CaminhoDados(ArquivoRegiao) {
+		return atual, nil
+	}
+	regiaoMutex.Lock()
+	defer regiaoMutex.Unlock()
+	if atual := regiaoAtual.Load(); atual != nil && atual.caminho == CaminhoDados(ArquivoRegiao) {
+		return atual, nil
+	}
+	info, erro := os.Stat(CaminhoDados(ArquivoRegiao))
+	if erro != nil {
+		return nil, fmt.Errorf("Erro ao abrir: %v", erro)
+	}
+	carregada, erro := carregarRegiao(info)
+	if erro != nil {
+		return nil, erro
+	}
+	regiaoAtual.Store(carregada)
+	return carregada, nil
+}
+
+// Relê regiao.json se a data de modificação ou o tamanho mudaram desde o
+// último carregamento. Retorna false se o arquivo não mudou. Se a nova
+// versão não puder ser carregada, a região anterior continua em uso e o
+// erro só é retornado uma vez por versão do arquivo.
+func RecarregarRegiao() (AlteracaoRegiao, bool, error) {
+	regiaoMutex.Lock()
+	defer regiaoMutex.Unlock()
+
+	var alteracao AlteracaoRegiao
+	info, erro := os.Stat(CaminhoDados(ArquivoRegiao))
+	if erro != nil {
+		return alteracao, false, fmt.Errorf("Erro ao abrir: %v", erro)
+	}
+	anterior := regiaoAtual.Load()
+	if anterior != nil && anterior.caminho == CaminhoDados(ArquivoRegiao) &&
+		anterior.modificacao.Equal(info.ModTime()) && anterior.tamanho == info.Size() {
+		return alteracao, false, nil
+	}
+	if regiaoFalha.modificacao.Equal(info.ModTime()) && regiaoFalha.tamanho == info.Size() {
+		return alteracao, false, nil
+	}
+
+	carregada, erro := carregarRegiao(info)
+	if erro != nil {
+		regiaoFalha.modificacao, regiaoFalha.tamanho = info.ModTime(), info.Size()
+		return alteracao, false, erro
+	}
+	regiaoAtual.Store(carregada)
+
+	pontosAnteriores := map[int]Ponto{}
+	if anterior != nil {
+		pontosAnteriores = anterior.pontos
+	}
+	for id, ponto := range carregada.pontos {
+		antigo, existia := pontosAnteriores[id]
+		switch {
+		case !existia:
+			alteracao.Adicionados = append(alteracao.Adicionados, id)
+		case antigo != ponto:
+			alteracao.Alterados = append(alteracao.Alterados, id)
+		}
+	}
+	for id := range pontosAnteriores {
+		if _, existe := carregada.pontos[id]; !existe {
+			alteracao.Retirados = append(alteracao.Retirados, id)
+		}
+	}
+	slices.Sort(alteracao.Adicionados)
+	slices.Sort(alteracao.Retirados)
+	slices.Sort(alteracao.Alterados)
+	return alteracao, true, nil
+}
+
+// Área de cobertura e pontos cadastrados, da região em memória
+func GetRegiao() (DadosRegiao, error) {
+	atual, erro := regiao()
+	if erro != nil {
+		return DadosRegiao{}, erro
+	}
+	dados := atual.dados
+	dados.PontosDeRecarga = slices.Clone(dados.PontosDeRecarga)
+	return dados, nil
+}
+
+// Região para enviar a clientes, sem as credenciais dos pontos. Toda
+// resposta com a região ou a lista de pontos deve usar esta cópia, já que o
+// hash da credencial permite adivinhar credenciais fracas.
+func RegiaoPublica() (DadosRegiao, error) {
+	dados, erro := GetRegiao()
+	for i := range dados.PontosDeRecarga {
+		dados.PontosDeRecarga[i].Credencial = ""
+	}
+	return dados, erro
+}
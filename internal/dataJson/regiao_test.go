@@ -0,0 +1,89 @@
+package dataJson
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Grava regiao.json com uma data de modificação própria, já que duas
+// gravações seguidas podem ficar com a mesma data
+func gravarRegiao(t *testing.T, diretorio string, conteudo string, modificacao time.Time) {
+	t.Helper()
+	caminho := filepath.Join(diretorio, ArquivoRegiao)
+	if erro := os.WriteFile(caminho, []byte(conteudo), 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := os.Chtimes(caminho, modificacao, modificacao); erro != nil {
+		t.Fatal(erro)
+	}
+}
+
+func TestRegiaoRecarregada(t *testing.T) {
+	diretorio := t.TempDir()
+	anterior := DiretorioDados()
+	ConfigurarDiretorioDados(diretorio)
+	t.Cleanup(func() { ConfigurarDiretorioDados(anterior) })
+
+	inicio := time.Now().Add(-time.Hour)
+	gravarRegiao(t, diretorio, `{"pontos-de-recarga": [{"id": 1, "latitude": 1}, {"id": 2, "latitude": 2}]}`, inicio)
+	if ponto, resultado := GetPontoId(2); resultado != 0 || ponto.Latitude != 2 {
+		t.Fatalf("ponto 2: %+v %d", ponto, resultado)
+	}
+	if _, recarregada, erro := RecarregarRegiao(); recarregada || erro != nil {
+		t.Fatalf("regiao sem alteracao recarregada: %v %v", recarregada, erro)
+	}
+
+	gravarRegiao(t, diretorio, `{"pontos-de-recarga": [{"id": 2, "latitude": 5}, {"id": 3, "latitude": 3}]}`, inicio.Add(time.Minute))
+	alteracao, recarregada, erro := RecarregarRegiao()
+	if !recarregada || erro != nil {
+		t.Fatalf("regiao alterada nao recarregada: %v %v", recarregada, erro)
+	}
+	esperada := AlteracaoRegiao{Adicionados: []int{3}, Retirados: []int{1}, Alterados: []int{2}}
+	if !reflect.DeepEqual(alteracao, esperada) {
+		t.Fatalf("alteracao %+v, esperada %+v", alteracao, esperada)
+	}
+	if _, resultado := GetPontoId(1); resultado != 2 {
+		t.Fatal("ponto retirado ainda encontrado")
+	}
+	if ponto, _ := GetPontoId(2); ponto.Latitude != 5 {
+		t.Fatalf("ponto alterado nao atualizado: %+v", ponto)
+	}
+
+	// Uma versão inválida mantém a região anterior e só é informada uma vez
+	gravarRegiao(t, diretorio, `{"pontos-de-recarga": [{"id": 3}, {"id": 3}]}`, inicio.Add(2*time.Minute))
+	if _, recarregada, erro := RecarregarRegiao(); recarregada || erro == nil {
+		t.Fatalf("regiao com ponto repetido aceita: %v %v", recarregada, erro)
+	}
+	if _, recarregada, erro := RecarregarRegiao(); recarregada || erro != nil {
+		t.Fatalf("erro da mesma versao repetido: %v %v", recarregada, erro)
+	}
+	if pontos, _ := GetPontosDeRecargaJson(); len(pontos) != 2 {
+		t.Fatalf("regiao anterior nao foi mantida: %+v", pontos)
+	}
+}
+
+// As credenciais dos pontos não saem na região enviada aos clientes
+func TestRegiaoPublica(t *testing.T) {
+	diretorio := t.TempDir()
+	anterior := DiretorioDados()
+	ConfigurarDiretorioDados(diretorio)
+	t.Cleanup(func() { ConfigurarDiretorioDados(anterior) })
+
+	gravarRegiao(t, diretorio, `{"pontos-de-recarga": [{"id": 1, "credencial": "abc"}, {"id": 2, "credencial": "def"}]}`, time.Now())
+	publica, erro := RegiaoPublica()
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	for _, ponto := range publica.PontosDeRecarga {
+		if ponto.Credencial != "" {
+			t.Fatalf("credencial do ponto %d enviada", ponto.ID)
+		}
+	}
+	// A cópia em memória continua com as credenciais
+	if ponto, _ := GetPontoId(1); ponto.Credencial != "abc" {
+		t.Fatalf("credencial apagada da regiao em memoria: %+v", ponto)
+	}
+}
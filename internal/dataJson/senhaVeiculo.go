@@ -0,0 +1,69 @@
+package dataJson
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Parametros do hash das senhas dos veiculos
+const (
+	iteracoesSenha = 100_000
+	// Hashes lidos do arquivo com mais iterações são recusados, para que um
+	// cadastro adulterado não custe minutos de CPU a cada tentativa
+	iteracoesMaximas = 1_000_000
+	tamanhoSalt      = 16
+	tamanhoHash      = 32
+)
+
+// Tamanho minimo da senha ou PIN de um veiculo
+const TamanhoMinimoSenha = 4
+
+var (
+	ErrSenhaJaCadastrada = errors.New("veículo já possui senha cadastrada")
+	ErrPlacaJaCadastrada = errors.New("placa já cadastrada")
+)
+
+// Senha de um veiculo guardada como hash PBKDF2-SHA256 com salt
+type SenhaVeiculo struct {
+	Salt      string `json:"salt"`
+	Hash      string `json:"hash"`
+	Iteracoes int    `json:"iteracoes"`
+}
+
+func NovaSenhaVeiculo(senha string) (SenhaVeiculo, error) {
+	if len(senha) < TamanhoMinimoSenha {
+		return SenhaVeiculo{}, fmt.Errorf("a senha deve ter ao menos %d caracteres", TamanhoMinimoSenha)
+	}
+	salt := make([]byte, tamanhoSalt)
+	if _, erro := rand.Read(salt); erro != nil {
+		return SenhaVeiculo{}, erro
+	}
+	hash, erro := pbkdf2.Key(sha256.New, senha, salt, iteracoesSenha, tamanhoHash)
+	if erro != nil {
+		return SenhaVeiculo{}, erro
+	}
+	return SenhaVeiculo{
+		Salt:      hex.EncodeToString(salt),
+		Hash:      hex.EncodeToString(hash),
+		Iteracoes: iteracoesSenha,
+	}, nil
+}
+
+// Confere a senha informada com o hash guardado
+func (senhaVeiculo SenhaVeiculo) Confere(senha string) bool {
+	salt, erroSalt := hex.DecodeString(senhaVeiculo.Salt)
+	esperado, erroHash := hex.DecodeString(senhaVeiculo.Hash)
+	if erroSalt != nil || erroHash != nil || senhaVeiculo.Iteracoes <= 0 || senhaVeiculo.Iteracoes > iteracoesMaximas {
+		return false
+	}
+	hash, erro := pbkdf2.Key(sha256.New, senha, salt, senhaVeiculo.Iteracoes, len(esperado))
+	if erro != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, esperado) == 1
+}
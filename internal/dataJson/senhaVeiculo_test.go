@@ -0,0 +1,47 @@
+package dataJson
+
+import "testing"
+
+func TestSenhaVeiculo(t *testing.T) {
+	senha, erro := NovaSenhaVeiculo("1234")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if senha.Iteracoes != iteracoesSenha || len(senha.Salt) != 2*tamanhoSalt || len(senha.Hash) != 2*tamanhoHash {
+		t.Fatalf("parametros do hash: %+v", senha)
+	}
+	if outra, _ := NovaSenhaVeiculo("1234"); outra.Salt == senha.Salt || outra.Hash == senha.Hash {
+		t.Fatal("salt repetido entre dois cadastros")
+	}
+	if _, erro := NovaSenhaVeiculo("123"); erro == nil {
+		t.Fatal("senha curta aceita")
+	}
+
+	// Hash conhecido de "1234" com salt 00 e 1 iteração
+	conhecida := SenhaVeiculo{Salt: "00", Hash: "1235daf46dd612a4f4a98977b005f502caada560b3b2a2e340feb698803e297a", Iteracoes: 1}
+	casos := []struct {
+		nome     string
+		cadastro SenhaVeiculo
+		senha    string
+		confere  bool
+	}{
+		{"senha certa", senha, "1234", true},
+		{"senha errada", senha, "1235", false},
+		{"senha vazia", senha, "", false},
+		{"hash conhecido", conhecida, "1234", true},
+		{"iteracoes diferentes", SenhaVeiculo{Salt: conhecida.Salt, Hash: conhecida.Hash, Iteracoes: 2}, "1234", false},
+		{"salt invalido", SenhaVeiculo{Salt: "zz", Hash: senha.Hash, Iteracoes: senha.Iteracoes}, "1234", false},
+		{"hash invalido", SenhaVeiculo{Salt: senha.Salt, Hash: "zz", Iteracoes: senha.Iteracoes}, "1234", false},
+		{"sem iteracoes", SenhaVeiculo{Salt: senha.Salt, Hash: senha.Hash}, "1234", false},
+		{"iteracoes negativas", SenhaVeiculo{Salt: senha.Salt, Hash: senha.Hash, Iteracoes: -1}, "1234", false},
+		// Um cadastro adulterado não pode prender a CPU do servidor
+		{"iteracoes acima do limite", SenhaVeiculo{Salt: senha.Salt, Hash: senha.Hash, Iteracoes: iteracoesMaximas + 1}, "1234", false},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			if confere := caso.cadastro.Confere(caso.senha); confere != caso.confere {
+				t.Fatalf("Confere(%q) = %v, esperado %v", caso.senha, confere, caso.confere)
+			}
+		})
+	}
+}
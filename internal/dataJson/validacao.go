@@ -0,0 +1,386 @@
+package dataJson
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// Limites dos campos de texto e listas recebidos nos payloads
+const (
+	tamanhoMaximoPlaca  = 16 // a placa é normalizada depois; aqui só se limita o tamanho
+	tamanhoMaximoTexto  = 256
+	tamanhoMaximoMotivo = 64
+	tamanhoMaximoLista  = 1024
+	TamanhoMaximoSenha  = 128
+)
+
+// Motivos informados em ErroValidacao e PedidoInvalido
+const (
+	MotivoCampoAusente     = "ausente"
+	MotivoCampoLongo       = "muito-longo"
+	MotivoForaDoIntervalo  = "fora-do-intervalo"
+	MotivoListaLonga       = "lista-longa"
+	MotivoFormatoInvalido  = "formato-invalido"
+	MotivoForaDaArea       = "fora-da-area"
+	MotivoPayloadInvalido  = "payload-invalido"
+	MotivoTipoDesconhecido = "tipo-desconhecido"
+)
+
+// Erro de um campo do payload que não passou na validação
+type ErroValidacao struct {
+	Campo  string
+	Motivo string
+}
+
+func (erro *ErroValidacao) Error() string {
+	return fmt.Sprintf("campo %s invalido: %s", erro.Campo, erro.Motivo)
+}
+
+// Payloads que conferem os próprios campos; DecodeDados chama Validar após decodificar
+type validavel interface {
+	Validar() error
+}
+
+func invalido(campo string, motivo string) error {
+	return &ErroValidacao{Campo: campo, Motivo: motivo}
+}
+
+func validarTexto(campo string, valor string, obrigatorio bool, tamanhoMaximo int) error {
+	switch {
+	case valor == "" && obrigatorio:
+		return invalido(campo, MotivoCampoAusente)
+	case len(valor) > tamanhoMaximo:
+		return invalido(campo, MotivoCampoLongo)
+	case !utf8.ValidString(valor):
+		return invalido(campo, MotivoFormatoInvalido)
+	}
+	return nil
+}
+
+func validarPlaca(campo string, placa string) error {
+	return validarTexto(campo, placa, true, tamanhoMaximoPlaca)
+}
+
+func validarID(campo string, id int) error {
+	if id <= 0 {
+		return invalido(campo, MotivoForaDoIntervalo)
+	}
+	return nil
+}
+
+func validarNaoNegativo(campo string, valor int) error {
+	if valor < 0 {
+		return invalido(campo, MotivoForaDoIntervalo)
+	}
+	return nil
+}
+
+func validarNumero(campo string, valor float64, minimo float64, maximo float64) error {
+	if math.IsNaN(valor) || valor < minimo || valor > maximo {
+		return invalido(campo, MotivoForaDoIntervalo)
+	}
+	return nil
+}
+
+func validarLista(campo string, tamanho int) error {
+	if tamanho > tamanhoMaximoLista {
+		return invalido(campo, MotivoListaLonga)
+	}
+	return nil
+}
+
+func validarPlacas(campo string, placas []string) error {
+	if erro := validarLista(campo, len(placas)); erro != nil {
+		return erro
+	}
+	for _, placa := range placas {
+		if erro := validarPlaca(campo, placa); erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+func validarRecursos(recursos []string) error {
+	if len(recursos) > 16 {
+		return invalido("recursos", MotivoListaLonga)
+	}
+	for _, recurso := range recursos {
+		if erro := validarTexto("recursos", recurso, true, tamanhoMaximoMotivo); erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+// Retorna o primeiro erro da lista
+func primeiroErro(erros ...error) error {
+	for _, erro := range erros {
+		if erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+func (identificacao Identificacao) Validar() error {
+	if len(identificacao.Versoes) > 16 {
+		return invalido("versoes", MotivoListaLonga)
+	}
+	return primeiroErro(
+		validarRecursos(identificacao.Recursos),
+		validarTexto("placa", identificacao.Placa, false, tamanhoMaximoPlaca),
+		validarTexto("sessao", identificacao.Sessao, false, tamanhoMaximoTexto),
+		validarTexto("senha", identificacao.Senha, false, TamanhoMaximoSenha),
+		validarNaoNegativo("ponto_id", identificacao.PontoID),
+		validarTexto("credencial", identificacao.Credencial, false, tamanhoMaximoTexto),
+		validarTexto("operador", identificacao.Operador, false, tamanhoMaximoMotivo),
+	)
+}
+
+func (aceita IdentificacaoAceita) Validar() error {
+	return primeiroErro(
+		validarID("versao", aceita.Versao),
+		validarRecursos(aceita.Recursos),
+		validarTexto("sessao", aceita.Sessao, false, tamanhoMaximoTexto),
+	)
+}
+
+func (recusa IdentificacaoRecusada) Validar() error {
+	if len(recusa.VersoesSuportadas) > 16 {
+		return invalido("versoes_suportadas", MotivoListaLonga)
+	}
+	if recusa.BloqueadoAte != "" {
+		if _, erro := time.Parse(time.RFC3339, recusa.BloqueadoAte); erro != nil {
+			return invalido("bloqueado_ate", MotivoFormatoInvalido)
+		}
+	}
+	return validarTexto("motivo", recusa.Motivo, true, tamanhoMaximoMotivo)
+}
+
+func (verificacao VerificarPlaca) Validar() error {
+	return validarPlaca("placa", verificacao.Placa)
+}
+
+func (area Area) Validar() error {
+	return primeiroErro(
+		validarNumero("latitude_min", area.Latitude_min, -90, area.Latitude_max),
+		validarNumero("latitude_max", area.Latitude_max, area.Latitude_min, 90),
+		validarNumero("longitude_min", area.Longitude_min, -180, area.Longitude_max),
+		validarNumero("longitude_max", area.Longitude_max, area.Longitude_min, 180),
+	)
+}
+
+// Indica se a localização está dentro da área de cobertura
+func (area Area) Contem(localizacao Localizacao) bool {
+	return localizacao.Latitude >= area.Latitude_min && localizacao.Latitude <= area.Latitude_max &&
+		localizacao.Longitude >= area.Longitude_min && localizacao.Longitude <= area.Longitude_max
+}
+
+func (localizacao Localizacao) Validar() error {
+	return primeiroErro(
+		validarNumero("latitude", localizacao.Latitude, -90, 90),
+		validarNumero("longitude", localizacao.Longitude, -180, 180),
+	)
+}
+
+func (regiao DadosRegiao) Validar() error {
+	if erro := validarLista("pontos-de-recarga", len(regiao.PontosDeRecarga)); erro != nil {
+		return erro
+	}
+	for _, ponto := range regiao.PontosDeRecarga {
+		erro := primeiroErro(
+			validarID("pontos-de-recarga.id", ponto.ID),
+			validarTexto("pontos-de-recarga.credencial", ponto.Credencial, false, tamanhoMaximoTexto),
+			Localizacao{Latitude: ponto.Latitude, Longitude: ponto.Longitude}.Validar(),
+		)
+		if erro != nil {
+			return erro
+		}
+	}
+	return regiao.Area.Validar()
+}
+
+func (ranking RankingPontos) Validar() error {
+	if erro := validarLista("pontos", len(ranking.Pontos)); erro != nil {
+		return erro
+	}
+	for _, ponto := range ranking.Pontos {
+		erro := primeiroErro(
+			validarID("pontos.id", ponto.ID),
+			validarNumero("pontos.distancia_km", ponto.DistanciaKm, 0, math.MaxFloat64),
+			validarNaoNegativo("pontos.fila", ponto.Fila),
+		)
+		if erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+func (pedido SolicitarReserva) Validar() error {
+	return validarID("ponto_id", pedido.PontoID)
+}
+
+func (confirmada ReservaConfirmada) Validar() error {
+	return primeiroErro(
+		validarID("ponto_id", confirmada.PontoID),
+		validarNaoNegativo("posicao", confirmada.Posicao),
+	)
+}
+
+func (falha ReservaFalhou) Validar() error {
+	return primeiroErro(
+		validarNaoNegativo("ponto_id", falha.PontoID),
+		validarTexto("motivo", falha.Motivo, true, tamanhoMaximoMotivo),
+	)
+}
+
+func (cancelamento CancelarReserva) Validar() error {
+	return validarPlaca("placa", cancelamento.Placa)
+}
+
+func (posicao PosicaoFila) Validar() error {
+	return validarID("ponto_id", posicao.PontoID)
+}
+
+func (vez SuaVez) Validar() error {
+	return validarID("ponto_id", vez.PontoID)
+}
+
+func (chegada VeiculoChegou) Validar() error {
+	return validarPlaca("placa", chegada.Placa)
+}
+
+func (recarga RecargaFinalizada) Validar() error {
+	return primeiroErro(
+		validarPlaca("placa", recarga.Placa),
+		validarNaoNegativo("ponto_id", recarga.PontoID),
+		validarNumero("consumo_kwh", recarga.ConsumoKwh, 0, math.MaxFloat64),
+		validarNumero("valor", recarga.Valor, 0, math.MaxFloat64),
+	)
+}
+
+func (historico HistoricoRecargas) Validar() error {
+	for _, recarga := range historico.Recargas {
+		erro := primeiroErro(
+			validarTexto("recargas.data", recarga.Data, false, tamanhoMaximoMotivo),
+			validarNaoNegativo("recargas.ponto_id", recarga.PontoID),
+			validarNumero("recargas.valor", recarga.Valor, 0, math.MaxFloat64),
+		)
+		if erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+func (chamada ChamandoVeiculo) Validar() error {
+	return validarPlaca("placa", chamada.Placa)
+}
+
+func (solicitacao NovaSolicitacao) Validar() error {
+	return validarPlaca("placa", solicitacao.Placa)
+}
+
+func (status StatusFila) Validar() error {
+	return validarNaoNegativo("posicao", status.Posicao)
+}
+
+func (disponibilidade Disponibilidade) Validar() error {
+	return validarNaoNegativo("tamanho_fila", disponibilidade.TamanhoFila)
+}
+
+func (fila Fila) Validar() error {
+	return validarPlacas("placas", fila.Placas)
+}
+
+func (cancelada ReservaCancelada) Validar() error {
+	return validarID("ponto_id", cancelada.PontoID)
+}
+
+func (lista ListaConexoes) Validar() error {
+	for _, ponto := range lista.Pontos {
+		erro := primeiroErro(
+			validarID("pontos.id", ponto.ID),
+			validarTexto("pontos.endereco", ponto.Endereco, false, tamanhoMaximoTexto),
+		)
+		if erro != nil {
+			return erro
+		}
+	}
+	for _, veiculo := range lista.Veiculos {
+		erro := primeiroErro(
+			validarTexto("veiculos.placa", veiculo.Placa, false, tamanhoMaximoPlaca),
+			validarTexto("veiculos.endereco", veiculo.Endereco, false, tamanhoMaximoTexto),
+			validarNaoNegativo("veiculos.ponto_reservado", veiculo.PontoReservado),
+		)
+		if erro != nil {
+			return erro
+		}
+	}
+	return nil
+}
+
+// O operador sempre indica o ponto
+func (pedido PedidoFila) Validar() error {
+	return primeiroErro(
+		validarID("ponto_id", pedido.PontoID),
+		validarPlacas("placas", pedido.Placas),
+	)
+}
+
+// O ponto responde consultar-fila sem informar o próprio ID
+func (fila FilaPonto) Validar() error {
+	return primeiroErro(
+		validarNaoNegativo("ponto_id", fila.PontoID),
+		validarPlacas("placas", fila.Placas),
+	)
+}
+
+func (liberacao ForcarLiberacao) Validar() error {
+	return validarID("ponto_id", liberacao.PontoID)
+}
+
+// Exatamente um dos dois campos deve ser informado
+func (pedido DesconectarCliente) Validar() error {
+	if (pedido.PontoID != 0) == (pedido.Placa != "") {
+		return invalido("ponto_id", MotivoCampoAusente)
+	}
+	if pedido.PontoID != 0 {
+		return validarID("ponto_id", pedido.PontoID)
+	}
+	return validarPlaca("placa", pedido.Placa)
+}
+
+func (cadastro CadastrarSenha) Validar() error {
+	return primeiroErro(
+		validarPlaca("placa", cadastro.Placa),
+		validarTexto("senha", cadastro.Senha, true, TamanhoMaximoSenha),
+	)
+}
+
+func (compactado DiarioCompactado) Validar() error {
+	return validarNaoNegativo("eventos", compactado.Eventos)
+}
+
+func (falha OperacaoFalhou) Validar() error {
+	return validarTexto("motivo", falha.Motivo, true, tamanhoMaximoMotivo)
+}
+
+func (limite LimiteExcedido) Validar() error {
+	return primeiroErro(
+		validarTexto("tipo", limite.Tipo, true, tamanhoMaximoMotivo),
+		validarNumero("tentar_em_ms", float64(limite.TentarEmMs), 0, math.MaxFloat64),
+	)
+}
+
+func (pedido PedidoInvalido) Validar() error {
+	return primeiroErro(
+		validarTexto("tipo", pedido.Tipo, false, tamanhoMaximoMotivo),
+		validarTexto("campo", pedido.Campo, false, tamanhoMaximoMotivo),
+		validarTexto("motivo", pedido.Motivo, true, tamanhoMaximoMotivo),
+	)
+}
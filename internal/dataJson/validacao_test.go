@@ -0,0 +1,40 @@
+package dataJson
+
+import (
+	"errors"
+	"testing"
+)
+
+// O ponto responde consultar-fila sem o próprio ID, mas o operador sempre
+// indica o ponto nos pedidos
+func TestValidacaoDaFila(t *testing.T) {
+	casos := []struct {
+		tipo    string
+		dados   any
+		destino validavel
+		aceito  bool
+	}{
+		{"fila-ponto", FilaPonto{Placas: []string{"ABC1234"}}, &FilaPonto{}, true},
+		{"fila-ponto", FilaPonto{PontoID: 3, Placas: []string{}}, &FilaPonto{}, true},
+		{"fila-ponto", FilaPonto{PontoID: -1}, &FilaPonto{}, false},
+		{"fila-ponto", FilaPonto{Placas: []string{""}}, &FilaPonto{}, false},
+		{"consultar-fila", PedidoFila{PontoID: 3}, &PedidoFila{}, true},
+		{"consultar-fila", PedidoFila{}, &PedidoFila{}, false},
+		{"editar-fila", PedidoFila{PontoID: 3, Placas: []string{"ABC1234"}}, &PedidoFila{}, true},
+		{"editar-fila", PedidoFila{Placas: []string{"ABC1234"}}, &PedidoFila{}, false},
+	}
+	for _, caso := range casos {
+		mensagem, erro := NewMensagem(caso.tipo, "teste", caso.dados)
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		erro = mensagem.DecodeDados(caso.destino)
+		var validacao *ErroValidacao
+		if caso.aceito && erro != nil {
+			t.Errorf("%s %+v recusado: %v", caso.tipo, caso.dados, erro)
+		}
+		if !caso.aceito && !errors.As(erro, &validacao) {
+			t.Errorf("%s %+v aceito: %v", caso.tipo, caso.dados, erro)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package eventos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"strings"
+	"sync"
+	"time"
+)
+
+// O diário ou o snapshot não puderam ser decodificados. Os arquivos são
+// mantidos como estão para serem corrigidos ou restaurados.
+var ErrDiarioCorrompido = errors.New("diário de eventos corrompido")
+
+// Diário de eventos em JSON, um evento por linha, aberto apenas para
+// acrescentar. O estado resultante dos eventos é mantido em memória e
+// gravado no snapshot a cada compactação.
+type Diario struct {
+	mutex   sync.Mutex
+	caminho string
+	arquivo *os.File
+	tamanho int64 // bytes válidos no diário
+	estado  Estado
+	eventos int // eventos gravados desde o último snapshot
+}
+
+// Resultado da leitura do diário na abertura
+type Reproducao struct {
+	SeqSnapshot     uint64 // último evento incluído no snapshot
+	Eventos         int    // eventos do diário aplicados após o snapshot
+	LinhaIncompleta bool   // a última linha, interrompida por uma queda, foi descartada
+}
+
+// Resultado de uma compactação
+type Compactacao struct {
+	Seq     uint64 // último evento incluído no snapshot
+	Eventos int    // eventos retirados do diário
+}
+
+// Arquivo do snapshot, ao lado do diário: eventos.jsonl -> eventos.snapshot.json
+func CaminhoSnapshot(caminho string) string {
+	return strings.TrimSuffix(caminho, filepath.Ext(caminho)) + ".snapshot.json"
+}
+
+// Abre o diário, criando-o se não existir, e reconstrói o estado a partir
+// do snapshot e dos eventos gravados depois dele. Uma última linha
+// incompleta é descartada; qualquer outra linha inválida impede a abertura.
+func Abrir(caminho string) (*Diario, Reproducao, error) {
+	var reproducao Reproducao
+	estado, erro := lerSnapshot(CaminhoSnapshot(caminho))
+	if erro != nil {
+		return nil, reproducao, erro
+	}
+	reproducao.SeqSnapshot = estado.Seq
+
+	arquivo, erro := os.OpenFile(caminho, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if erro != nil {
+		return nil, reproducao, fmt.Errorf("erro ao abrir diário de eventos %s: %v", caminho, erro)
+	}
+	diario := &Diario{caminho: caminho, arquivo: arquivo, estado: estado}
+
+	leitor := bufio.NewReader(arquivo)
+	for numero := 1; ; numero++ {
+		linha, erroLeitura := leitor.ReadBytes('\n')
+		if erroLeitura == io.EOF {
+			if len(linha) > 0 {
+				reproducao.LinhaIncompleta = true
+			}
+			break
+		}
+		if erroLeitura != nil {
+			arquivo.Close()
+			return nil, reproducao, fmt.Errorf("erro ao ler diário de eventos %s: %v", caminho, erroLeitura)
+		}
+		diario.tamanho += int64(len(linha))
+		if len(bytes.TrimSpace(linha)) == 0 {
+			continue
+		}
+
+		var evento Evento
+		if erro := json.Unmarshal(linha, &evento); erro != nil || evento.Seq == 0 || evento.Tipo == "" {
+			arquivo.Close()
+			return nil, reproducao, fmt.Errorf("%w: %s, linha %d", ErrDiarioCorrompido, caminho, numero)
+		}
+		if evento.Seq > diario.estado.Seq {
+			diario.estado.Aplicar(evento)
+			reproducao.Eventos++
+		}
+		diario.eventos++
+	}
+
+	if reproducao.LinhaIncompleta {
+		erro := arquivo.Truncate(diario.tamanho)
+		if erro == nil {
+			erro = arquivo.Sync()
+		}
+		if erro != nil {
+			arquivo.Close()
+			return nil, reproducao, fmt.Errorf("erro ao descartar a linha incompleta de %s: %v", caminho, erro)
+		}
+	}
+	return diario, reproducao, nil
+}
+
+func lerSnapshot(caminho string) (Estado, error) {
+	estado := NovoEstado()
+	conteudo, erro := os.ReadFile(caminho)
+	if os.IsNotExist(erro) {
+		return estado, nil
+	}
+	if erro != nil {
+		return estado, fmt.Errorf("erro ao abrir snapshot %s: %v", caminho, erro)
+	}
+	if erro := json.Unmarshal(conteudo, &estado); erro != nil {
+		return estado, fmt.Errorf("%w: snapshot %s: %v", ErrDiarioCorrompido, caminho, erro)
+	}
+	// Mapas ausentes no snapshot voltam vazios
+	return estado.Copia(), nil
+}
+
+// Grava o evento no diário e o aplica ao estado. O evento só é aplicado
+// depois de sincronizado com o disco.
+func (diario *Diario) Registrar(evento Evento) error {
+	diario.mutex.Lock()
+	defer diario.mutex.Unlock()
+
+	evento.Seq = diario.estado.Seq + 1
+	if evento.Data.IsZero() {
+		evento.Data = time.Now()
+	}
+	linha, erro := json.Marshal(evento)
+	if erro != nil {
+		return erro
+	}
+	linha = append(linha, '\n')
+
+	_, erro = diario.arquivo.Write(linha)
+	if erro == nil {
+		erro = diario.arquivo.Sync()
+	}
+	if erro != nil {
+		// Descarta o que tiver sido gravado para não deixar uma linha pela metade
+		diario.arquivo.Truncate(diario.tamanho)
+		return fmt.Errorf("erro ao gravar evento %s no diário: %v", evento.Tipo, erro)
+	}
+	diario.tamanho += int64(len(linha))
+	diario.estado.Aplicar(evento)
+	diario.eventos++
+	return nil
+}
+
+// Cópia do estado atual
+func (diario *Diario) Estado() Estado {
+	diario.mutex.Lock()
+	defer diario.mutex.Unlock()
+	return diario.estado.Copia()
+}
+
+// Grava o estado atual no snapshot e esvazia o diário. Se houver uma queda
+// entre as duas etapas, os eventos que ficarem no diário já estão no
+// snapshot e são ignorados na próxima abertura.
+func (diario *Diario) Compactar() (Compactacao, error) {
+	diario.mutex.Lock()
+	defer diario.mutex.Unlock()
+
+	compactacao := Compactacao{Seq: diario.estado.Seq, Eventos: diario.eventos}
+	conteudo, erro := json.MarshalIndent(diario.estado, "", "  ")
+	if erro != nil {
+		return compactacao, fmt.Errorf("erro ao serializar snapshot: %v", erro)
+	}
+	snapshot := CaminhoSnapshot(diario.caminho)
+	if erro := dataJson.GravarArquivoAtomico(snapshot, append(conteudo, '\n'), 0600); erro != nil {
+		return compactacao, fmt.Errorf("erro ao gravar snapshot %s: %v", snapshot, erro)
+	}
+
+	erro = diario.arquivo.Truncate(0)
+	if erro == nil {
+		erro = diario.arquivo.Sync()
+	}
+	if erro != nil {
+		return compactacao, fmt.Errorf("snapshot gravado, mas o diário não foi esvaziado: %v", erro)
+	}
+	diario.tamanho = 0
+	diario.eventos = 0
+	return compactacao, nil
+}
+
+func (diario *Diario) Close() error {
+	diario.mutex.Lock()
+	defer diario.mutex.Unlock()
+	return diario.arquivo.Close()
+}
@@ -0,0 +1,164 @@
+package eventos
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func abrirDiario(t *testing.T, caminho string) (*Diario, Reproducao) {
+	t.Helper()
+	diario, reproducao, erro := Abrir(caminho)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	t.Cleanup(func() { diario.Close() })
+	return diario, reproducao
+}
+
+func registrar(t *testing.T, diario *Diario, eventos ...Evento) {
+	t.Helper()
+	for _, evento := range eventos {
+		if erro := diario.Registrar(evento); erro != nil {
+			t.Fatal(erro)
+		}
+	}
+}
+
+// Sequência de uso comum: duas reservas no mesmo ponto, uma recarga
+// completa, um cancelamento e uma reordenação da fila
+var historia = []Evento{
+	{Tipo: VeiculoCadastrado, Placa: "ABC1234"},
+	{Tipo: ReservaCriada, Placa: "ABC1234", PontoID: 1},
+	{Tipo: ReservaCriada, Placa: "DEF5G67", PontoID: 1},
+	{Tipo: ReservaCriada, Placa: "GHI8901", PontoID: 1},
+	{Tipo: ReservaCriada, Placa: "JKL2345", PontoID: 2},
+	{Tipo: RecargaIniciada, Placa: "ABC1234", PontoID: 1},
+	{Tipo: RecargaFinalizada, Placa: "ABC1234", PontoID: 1, ConsumoKwh: 30, Valor: 24},
+	{Tipo: PagamentoEfetuado, Placa: "ABC1234"},
+	{Tipo: ReservaCancelada, Placa: "JKL2345", PontoID: 2},
+	{Tipo: FilaAlterada, PontoID: 1, Placas: []string{"GHI8901", "DEF5G67"}},
+	{Tipo: RecargaIniciada, Placa: "GHI8901", PontoID: 1},
+}
+
+func conferirEstadoDaHistoria(t *testing.T, estado Estado) {
+	t.Helper()
+	if estado.Seq != uint64(len(historia)) {
+		t.Errorf("seq %d, esperado %d", estado.Seq, len(historia))
+	}
+	if !reflect.DeepEqual(estado.Reservas, map[string]int{"DEF5G67": 1, "GHI8901": 1}) {
+		t.Errorf("reservas inesperadas: %v", estado.Reservas)
+	}
+	if !reflect.DeepEqual(estado.Filas, map[int][]string{1: {"GHI8901", "DEF5G67"}}) {
+		t.Errorf("filas inesperadas: %v", estado.Filas)
+	}
+	if !reflect.DeepEqual(estado.EmRecarga, map[string]int{"GHI8901": 1}) {
+		t.Errorf("recargas em andamento inesperadas: %v", estado.EmRecarga)
+	}
+}
+
+func TestEstadoReconstruidoNaAbertura(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "eventos.jsonl")
+	diario, _ := abrirDiario(t, caminho)
+	registrar(t, diario, historia...)
+	conferirEstadoDaHistoria(t, diario.Estado())
+	diario.Close()
+
+	reaberto, reproducao := abrirDiario(t, caminho)
+	if reproducao.Eventos != len(historia) || reproducao.LinhaIncompleta {
+		t.Fatalf("reproducao inesperada: %+v", reproducao)
+	}
+	conferirEstadoDaHistoria(t, reaberto.Estado())
+
+	// Novos eventos continuam a sequência
+	registrar(t, reaberto, Evento{Tipo: ReservaCancelada, Placa: "DEF5G67"})
+	if estado := reaberto.Estado(); estado.Seq != uint64(len(historia))+1 || !slices.Equal(estado.Filas[1], []string{"GHI8901"}) {
+		t.Fatalf("estado apos novo evento: %+v", estado)
+	}
+}
+
+// Uma queda no meio da gravação deixa a última linha incompleta, que é
+// descartada; os eventos anteriores são mantidos
+func TestLinhaIncompletaDescartada(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "eventos.jsonl")
+	diario, _ := abrirDiario(t, caminho)
+	registrar(t, diario, historia...)
+	diario.Close()
+
+	arquivo, erro := os.OpenFile(caminho, os.O_APPEND|os.O_WRONLY, 0)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	arquivo.WriteString(`{"seq":12,"tipo":"reserva-cri`)
+	arquivo.Close()
+
+	reaberto, reproducao := abrirDiario(t, caminho)
+	if !reproducao.LinhaIncompleta || reproducao.Eventos != len(historia) {
+		t.Fatalf("reproducao inesperada: %+v", reproducao)
+	}
+	conferirEstadoDaHistoria(t, reaberto.Estado())
+
+	// O próximo evento começa em uma linha nova
+	registrar(t, reaberto, Evento{Tipo: ReservaCancelada, Placa: "DEF5G67"})
+	reaberto.Close()
+	if _, reproducao := abrirDiario(t, caminho); reproducao.LinhaIncompleta || reproducao.Eventos != len(historia)+1 {
+		t.Fatalf("reproducao apos nova gravacao: %+v", reproducao)
+	}
+}
+
+// Uma linha inválida no meio do diário impede a abertura e o arquivo é mantido
+func TestDiarioCorrompidoMantido(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "eventos.jsonl")
+	conteudo := []byte("{\"seq\":1,\"tipo\":\"reserva-criada\",\"placa\":\"ABC1234\",\"ponto_id\":1}\nnao e json\n" +
+		"{\"seq\":2,\"tipo\":\"reserva-cancelada\",\"placa\":\"ABC1234\"}\n")
+	os.WriteFile(caminho, conteudo, 0600)
+
+	if _, _, erro := Abrir(caminho); !errors.Is(erro, ErrDiarioCorrompido) {
+		t.Fatalf("esperado ErrDiarioCorrompido, recebido %v", erro)
+	}
+	if atual, _ := os.ReadFile(caminho); string(atual) != string(conteudo) {
+		t.Fatalf("diario corrompido foi alterado: %s", atual)
+	}
+}
+
+func TestCompactacao(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "eventos.jsonl")
+	diario, _ := abrirDiario(t, caminho)
+	registrar(t, diario, historia...)
+
+	// Cópia do diário antes da compactação, para simular uma queda entre a
+	// gravação do snapshot e o esvaziamento do diário
+	antes, _ := os.ReadFile(caminho)
+
+	compactacao, erro := diario.Compactar()
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if compactacao.Seq != uint64(len(historia)) || compactacao.Eventos != len(historia) {
+		t.Fatalf("compactacao inesperada: %+v", compactacao)
+	}
+	if info, _ := os.Stat(caminho); info.Size() != 0 {
+		t.Fatalf("diario nao foi esvaziado: %d bytes", info.Size())
+	}
+	registrar(t, diario, Evento{Tipo: ReservaCancelada, Placa: "DEF5G67"})
+	diario.Close()
+
+	reaberto, reproducao := abrirDiario(t, caminho)
+	if reproducao.SeqSnapshot != uint64(len(historia)) || reproducao.Eventos != 1 {
+		t.Fatalf("reproducao apos compactacao: %+v", reproducao)
+	}
+	if estado := reaberto.Estado(); !reflect.DeepEqual(estado.Reservas, map[string]int{"GHI8901": 1}) {
+		t.Fatalf("reservas apos compactacao: %v", estado.Reservas)
+	}
+	reaberto.Close()
+
+	// Eventos que já estão no snapshot não são reaplicados
+	os.WriteFile(caminho, antes, 0600)
+	_, reproducao = abrirDiario(t, caminho)
+	if reproducao.Eventos != 0 {
+		t.Fatalf("eventos do snapshot reaplicados: %+v", reproducao)
+	}
+}
@@ -0,0 +1,101 @@
+package eventos
+
+import (
+	"slices"
+	"time"
+)
+
+// Tipos de evento gravados no diário
+const (
+	VeiculoCadastrado = "veiculo-cadastrado"
+	ReservaCriada     = "reserva-criada"
+	ReservaCancelada  = "reserva-cancelada"
+	FilaAlterada      = "fila-alterada" // fila reordenada por um operador
+	RecargaIniciada   = "recarga-iniciada"
+	RecargaFinalizada = "recarga-finalizada"
+	PagamentoEfetuado = "pagamento-efetuado"
+)
+
+// Um evento de domínio. Seq e Data são preenchidos pelo diário ao gravar.
+type Evento struct {
+	Seq        uint64    `json:"seq"`
+	Data       time.Time `json:"data"`
+	Tipo       string    `json:"tipo"`
+	Placa      string    `json:"placa,omitempty"`
+	PontoID    int       `json:"ponto_id,omitempty"`
+	Placas     []string  `json:"placas,omitempty"` // nova fila, em fila-alterada
+	ConsumoKwh float64   `json:"consumo_kwh,omitempty"`
+	Valor      float64   `json:"valor,omitempty"`
+}
+
+// Estado reconstruído a partir dos eventos: as reservas ativas e as filas dos
+// pontos. O cadastro e o histórico dos veículos continuam em veiculos.json.
+type Estado struct {
+	Seq       uint64           `json:"seq"`        // último evento aplicado
+	Reservas  map[string]int   `json:"reservas"`   // placa -> pontoID
+	Filas     map[int][]string `json:"filas"`      // pontoID -> placas na ordem de atendimento
+	EmRecarga map[string]int   `json:"em_recarga"` // placa -> pontoID em que está recarregando
+}
+
+func NovoEstado() Estado {
+	return Estado{
+		Reservas:  make(map[string]int),
+		Filas:     make(map[int][]string),
+		EmRecarga: make(map[string]int),
+	}
+}
+
+// Aplica o evento ao estado. Eventos já aplicados (Seq menor ou igual ao do
+// estado) são ignorados, de forma que reaplicar o diário após um snapshot
+// não duplica nada.
+func (estado *Estado) Aplicar(evento Evento) {
+	if evento.Seq != 0 && evento.Seq <= estado.Seq {
+		return
+	}
+	switch evento.Tipo {
+	case ReservaCriada:
+		estado.retirar(evento.Placa)
+		estado.Reservas[evento.Placa] = evento.PontoID
+		estado.Filas[evento.PontoID] = append(estado.Filas[evento.PontoID], evento.Placa)
+	case ReservaCancelada, RecargaFinalizada:
+		estado.retirar(evento.Placa)
+	case FilaAlterada:
+		estado.Filas[evento.PontoID] = slices.Clone(evento.Placas)
+		if len(evento.Placas) == 0 {
+			delete(estado.Filas, evento.PontoID)
+		}
+	case RecargaIniciada:
+		estado.EmRecarga[evento.Placa] = evento.PontoID
+	}
+	estado.Seq = max(estado.Seq, evento.Seq)
+}
+
+// Remove a reserva da placa e a retira das filas
+func (estado *Estado) retirar(placa string) {
+	delete(estado.Reservas, placa)
+	delete(estado.EmRecarga, placa)
+	for pontoID, fila := range estado.Filas {
+		fila = slices.DeleteFunc(fila, func(outra string) bool { return outra == placa })
+		if len(fila) == 0 {
+			delete(estado.Filas, pontoID)
+		} else {
+			estado.Filas[pontoID] = fila
+		}
+	}
+}
+
+// Cópia independente do estado
+func (estado Estado) Copia() Estado {
+	copia := NovoEstado()
+	copia.Seq = estado.Seq
+	for placa, pontoID := range estado.Reservas {
+		copia.Reservas[placa] = pontoID
+	}
+	for pontoID, fila := range estado.Filas {
+		copia.Filas[pontoID] = slices.Clone(fila)
+	}
+	for placa, pontoID := range estado.EmRecarga {
+		copia.EmRecarga[placa] = pontoID
+	}
+	return copia
+}
@@ -0,0 +1,275 @@
+package exportacao
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"recarga-inteligente/internal/dataJson"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formatos de saída
+const (
+	FormatoCSV   = "csv"
+	FormatoJSONL = "jsonl"
+)
+
+// Campos pelos quais as recargas são agrupadas para os totais
+const (
+	PorPlaca = "placa"
+	PorPonto = "ponto"
+	PorDia   = "dia"
+	PorMes   = "mes"
+)
+
+// Tipos de linha da exportação
+const (
+	TipoRecarga    = "recarga"
+	TipoTotal      = "total"       // soma das recargas de um grupo
+	TipoTotalGeral = "total-geral" // soma de todas as recargas exportadas
+)
+
+// Formato das datas do filtro; o limite final é inclusivo
+const LayoutFiltro = "2006-01-02"
+
+// Formato em que o repositório grava Recarga.Data
+const layoutRecarga = "2006-01-02 15:04:05"
+
+// Colunas do CSV, na ordem, com os mesmos nomes dos campos das linhas JSON.
+// Novas colunas só devem ser acrescentadas ao final.
+var Colunas = []string{"tipo", "grupo", "placa", "ponto_id", "data", "recargas", "valor", "pago"}
+
+// Uma linha da exportação: uma recarga, o total de um grupo ou o total geral.
+// Nos totais, o campo do agrupamento (placa, ponto_id ou data) repete o grupo
+// e pago indica que todas as recargas somadas já foram pagas.
+type Linha struct {
+	Tipo     string  `json:"tipo"`
+	Grupo    string  `json:"grupo"`
+	Placa    string  `json:"placa"`
+	PontoID  int     `json:"ponto_id"`
+	Data     string  `json:"data"`
+	Recargas int     `json:"recargas"`
+	Valor    float64 `json:"valor"`
+	Pago     bool    `json:"pago"`
+}
+
+// Recargas exportadas. Campos vazios não filtram.
+type Filtro struct {
+	De      time.Time // inclusivo
+	Ate     time.Time // exclusivo
+	Placa   string
+	PontoID int
+}
+
+// Monta o filtro a partir dos valores informados na linha de comando ou na
+// API. As datas são dias no formato 2006-01-02, e o dia final entra na
+// exportação.
+func NovoFiltro(de string, ate string, placa string, ponto string) (Filtro, error) {
+	var filtro Filtro
+	var erro error
+	if de != "" {
+		filtro.De, erro = time.ParseInLocation(LayoutFiltro, de, time.Local)
+		if erro != nil {
+			return filtro, fmt.Errorf("data inicial inválida %q, use AAAA-MM-DD", de)
+		}
+	}
+	if ate != "" {
+		filtro.Ate, erro = time.ParseInLocation(LayoutFiltro, ate, time.Local)
+		if erro != nil {
+			return filtro, fmt.Errorf("data final inválida %q, use AAAA-MM-DD", ate)
+		}
+		filtro.Ate = filtro.Ate.AddDate(0, 0, 1)
+	}
+	if !filtro.De.IsZero() && !filtro.Ate.IsZero() && !filtro.De.Before(filtro.Ate) {
+		return filtro, fmt.Errorf("data inicial %s depois da data final %s", de, ate)
+	}
+	if placa != "" {
+		filtro.Placa, erro = dataJson.NormalizarPlaca(placa)
+		if erro != nil {
+			return filtro, erro
+		}
+	}
+	if ponto != "" {
+		filtro.PontoID, erro = strconv.Atoi(ponto)
+		if erro != nil || filtro.PontoID <= 0 {
+			return filtro, fmt.Errorf("ID de ponto inválido: %q", ponto)
+		}
+	}
+	return filtro, nil
+}
+
+func ValidarFormato(formato string) error {
+	if formato != FormatoCSV && formato != FormatoJSONL {
+		return fmt.Errorf("formato desconhecido %q, use %s ou %s", formato, FormatoCSV, FormatoJSONL)
+	}
+	return nil
+}
+
+func ValidarAgrupamento(agrupamento string) error {
+	switch agrupamento {
+	case PorPlaca, PorPonto, PorDia, PorMes:
+		return nil
+	}
+	return fmt.Errorf("agrupamento desconhecido %q, use %s, %s, %s ou %s", agrupamento, PorPlaca, PorPonto, PorDia, PorMes)
+}
+
+// Content-Type da exportação no formato informado
+func TipoConteudo(formato string) string {
+	if formato == FormatoCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Recarga selecionada, com a data já interpretada
+type selecionada struct {
+	linha Linha
+	data  time.Time
+}
+
+// Seleciona as recargas do filtro e monta as linhas da exportação: as
+// recargas de cada grupo em ordem de data, seguidas do total do grupo, e ao
+// final o total geral. Os grupos seguem a ordem da placa, do ponto ou da data.
+func Gerar(veiculos []dataJson.Veiculo, filtro Filtro, agrupamento string) ([]Linha, error) {
+	if erro := ValidarAgrupamento(agrupamento); erro != nil {
+		return nil, erro
+	}
+
+	var recargas []selecionada
+	for _, veiculo := range veiculos {
+		if filtro.Placa != "" && veiculo.Placa != filtro.Placa {
+			continue
+		}
+		for _, recarga := range veiculo.Recargas {
+			if filtro.PontoID != 0 && recarga.PontoID != filtro.PontoID {
+				continue
+			}
+			data, erro := time.ParseInLocation(layoutRecarga, recarga.Data, time.Local)
+			if erro != nil {
+				return nil, fmt.Errorf("recarga de %s no ponto %d com data inválida %q", veiculo.Placa, recarga.PontoID, recarga.Data)
+			}
+			if (!filtro.De.IsZero() && data.Before(filtro.De)) || (!filtro.Ate.IsZero() && !data.Before(filtro.Ate)) {
+				continue
+			}
+			recargas = append(recargas, selecionada{
+				linha: Linha{
+					Tipo:     TipoRecarga,
+					Grupo:    grupo(agrupamento, veiculo.Placa, recarga.PontoID, data),
+					Placa:    veiculo.Placa,
+					PontoID:  recarga.PontoID,
+					Data:     recarga.Data,
+					Recargas: 1,
+					Valor:    recarga.Valor,
+					Pago:     recarga.Pago,
+				},
+				data: data,
+			})
+		}
+	}
+
+	slices.SortStableFunc(recargas, func(a, b selecionada) int {
+		if agrupamento == PorPonto && a.linha.PontoID != b.linha.PontoID {
+			return a.linha.PontoID - b.linha.PontoID
+		}
+		if ordem := strings.Compare(a.linha.Grupo, b.linha.Grupo); ordem != 0 {
+			return ordem
+		}
+		if ordem := a.data.Compare(b.data); ordem != 0 {
+			return ordem
+		}
+		return strings.Compare(a.linha.Placa, b.linha.Placa)
+	})
+
+	linhas := make([]Linha, 0, len(recargas)+2)
+	geral := Linha{Tipo: TipoTotalGeral, Pago: true}
+	var total *Linha
+	for _, recarga := range recargas {
+		if total != nil && total.Grupo != recarga.linha.Grupo {
+			linhas = append(linhas, arredondarTotal(*total))
+			total = nil
+		}
+		if total == nil {
+			total = &Linha{Tipo: TipoTotal, Grupo: recarga.linha.Grupo, Pago: true}
+			switch agrupamento {
+			case PorPlaca:
+				total.Placa = recarga.linha.Placa
+			case PorPonto:
+				total.PontoID = recarga.linha.PontoID
+			default:
+				total.Data = recarga.linha.Grupo
+			}
+		}
+		linhas = append(linhas, recarga.linha)
+		total.Recargas++
+		total.Valor += recarga.linha.Valor
+		total.Pago = total.Pago && recarga.linha.Pago
+		geral.Recargas++
+		geral.Valor += recarga.linha.Valor
+		geral.Pago = geral.Pago && recarga.linha.Pago
+	}
+	if total != nil {
+		linhas = append(linhas, arredondarTotal(*total))
+	}
+	return append(linhas, arredondarTotal(geral)), nil
+}
+
+func grupo(agrupamento string, placa string, pontoID int, data time.Time) string {
+	switch agrupamento {
+	case PorPlaca:
+		return placa
+	case PorPonto:
+		return strconv.Itoa(pontoID)
+	case PorDia:
+		return data.Format("2006-01-02")
+	default:
+		return data.Format("2006-01")
+	}
+}
+
+// Somas de valores em ponto flutuante acumulam resíduos; os totais saem em centavos
+func arredondarTotal(total Linha) Linha {
+	total.Valor = math.Round(total.Valor*100) / 100
+	return total
+}
+
+// Escreve as linhas no formato informado. O CSV começa pelo cabeçalho com
+// Colunas; em JSON Lines cada linha é um objeto com os mesmos campos.
+func Escrever(w io.Writer, linhas []Linha, formato string) error {
+	switch formato {
+	case FormatoCSV:
+		escritor := csv.NewWriter(w)
+		escritor.Write(Colunas)
+		for _, linha := range linhas {
+			pontoID := ""
+			if linha.PontoID != 0 {
+				pontoID = strconv.Itoa(linha.PontoID)
+			}
+			escritor.Write([]string{
+				linha.Tipo,
+				linha.Grupo,
+				linha.Placa,
+				pontoID,
+				linha.Data,
+				strconv.Itoa(linha.Recargas),
+				strconv.FormatFloat(linha.Valor, 'f', 2, 64),
+				strconv.FormatBool(linha.Pago),
+			})
+		}
+		escritor.Flush()
+		return escritor.Error()
+	case FormatoJSONL:
+		encoder := json.NewEncoder(w)
+		for _, linha := range linhas {
+			if erro := encoder.Encode(linha); erro != nil {
+				return erro
+			}
+		}
+		return nil
+	}
+	return ValidarFormato(formato)
+}
@@ -0,0 +1,119 @@
+package exportacao
+
+import (
+	"bytes"
+	"encoding/json"
+	"recarga-inteligente/internal/dataJson"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var veiculos = []dataJson.Veiculo{
+	{Placa: "DEF5G67", Recargas: []dataJson.Recarga{
+		{Data: "2025-03-01 09:00:00", PontoID: 10, Valor: 0.1, Pago: true},
+		{Data: "2025-03-02 18:30:00", PontoID: 2, Valor: 0.2},
+	}},
+	{Placa: "ABC1234", Recargas: []dataJson.Recarga{
+		{Data: "2025-03-02 08:00:00", PontoID: 2, Valor: 30},
+		{Data: "2025-02-28 23:59:59", PontoID: 10, Valor: 12.5, Pago: true},
+	}},
+	{Placa: "GHI9012"},
+}
+
+func TestGerarAgrupado(t *testing.T) {
+	linhas, erro := Gerar(veiculos, Filtro{}, PorPonto)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	var resumo []string
+	for _, linha := range linhas {
+		resumo = append(resumo, linha.Tipo+" "+linha.Grupo+" "+linha.Placa)
+	}
+	esperado := []string{
+		"recarga 2 ABC1234", "recarga 2 DEF5G67", "total 2 ",
+		"recarga 10 ABC1234", "recarga 10 DEF5G67", "total 10 ",
+		"total-geral  ",
+	}
+	if !reflect.DeepEqual(resumo, esperado) {
+		t.Fatalf("linhas %q, esperadas %q", resumo, esperado)
+	}
+	// As recargas pagas também são exportadas; o total só é pago se todas forem
+	if total := linhas[5]; total.PontoID != 10 || total.Recargas != 2 || total.Valor != 12.6 || !total.Pago {
+		t.Fatalf("total do ponto 10: %+v", total)
+	}
+	if total := linhas[2]; total.Pago {
+		t.Fatalf("total do ponto 2 sem recargas pagas: %+v", total)
+	}
+	if geral := linhas[6]; geral.Recargas != 4 || geral.Valor != 42.8 || geral.Pago {
+		t.Fatalf("total geral: %+v", geral)
+	}
+}
+
+func TestFiltro(t *testing.T) {
+	filtro, erro := NovoFiltro("2025-03-01", "2025-03-02", "abc-1234", "")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	linhas, erro := Gerar(veiculos, filtro, PorDia)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	// O dia final entra inteiro na exportação
+	if len(linhas) != 3 || linhas[0].Data != "2025-03-02 08:00:00" || linhas[1].Data != "2025-03-02" || linhas[2].Valor != 30 {
+		t.Fatalf("linhas inesperadas: %+v", linhas)
+	}
+
+	filtro, _ = NovoFiltro("", "", "", "7")
+	if linhas, _ := Gerar(veiculos, filtro, PorPlaca); len(linhas) != 1 || linhas[0].Tipo != TipoTotalGeral || linhas[0].Recargas != 0 {
+		t.Fatalf("exportacao sem recargas: %+v", linhas)
+	}
+
+	for _, invalido := range [][4]string{
+		{"01/03/2025", "", "", ""},
+		{"2025-03-02", "2025-03-01", "", ""},
+		{"", "", "AB", ""},
+		{"", "", "", "0"},
+	} {
+		if _, erro := NovoFiltro(invalido[0], invalido[1], invalido[2], invalido[3]); erro == nil {
+			t.Errorf("filtro invalido aceito: %q", invalido)
+		}
+	}
+}
+
+func TestEscrever(t *testing.T) {
+	linhas, _ := Gerar(veiculos[:1], Filtro{}, PorPlaca)
+
+	var csv bytes.Buffer
+	if erro := Escrever(&csv, linhas, FormatoCSV); erro != nil {
+		t.Fatal(erro)
+	}
+	esperado := "tipo,grupo,placa,ponto_id,data,recargas,valor,pago\n" +
+		"recarga,DEF5G67,DEF5G67,10,2025-03-01 09:00:00,1,0.10,true\n" +
+		"recarga,DEF5G67,DEF5G67,2,2025-03-02 18:30:00,1,0.20,false\n" +
+		"total,DEF5G67,DEF5G67,,,2,0.30,false\n" +
+		"total-geral,,,,,2,0.30,false\n"
+	if csv.String() != esperado {
+		t.Fatalf("csv:\n%s\nesperado:\n%s", csv.String(), esperado)
+	}
+
+	var jsonl bytes.Buffer
+	if erro := Escrever(&jsonl, linhas, FormatoJSONL); erro != nil {
+		t.Fatal(erro)
+	}
+	objetos := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	if len(objetos) != len(linhas) {
+		t.Fatalf("%d linhas JSON, esperadas %d", len(objetos), len(linhas))
+	}
+	var campos map[string]any
+	if erro := json.Unmarshal([]byte(objetos[2]), &campos); erro != nil {
+		t.Fatal(erro)
+	}
+	if len(campos) != len(Colunas) || campos["valor"] != 0.3 {
+		t.Fatalf("linha JSON inesperada: %v", campos)
+	}
+
+	if Escrever(&jsonl, linhas, "xlsx") == nil {
+		t.Fatal("formato desconhecido aceito")
+	}
+}
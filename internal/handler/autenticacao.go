@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"time"
+)
+
+var (
+	ErrSenhaInvalida        = errors.New("senha inválida")
+	ErrVeiculoNaoCadastrado = errors.New("veículo não cadastrado")
+	// A placa já existia antes das senhas; a senha é cadastrada pelo operador
+	ErrSenhaPendente = errors.New("veículo sem senha cadastrada")
+)
+
+// Erro devolvido enquanto a placa estiver bloqueada por falhas seguidas
+type ErroVeiculoBloqueado struct {
+	Ate time.Time
+}
+
+func (erro *ErroVeiculoBloqueado) Error() string {
+	return fmt.Sprintf("veículo bloqueado até %s por falhas de autenticação", erro.Ate.Format(time.RFC3339))
+}
+
+// Confere a senha do veículo com o cadastro do veículo, bloqueando a
+// placa após falhas seguidas. Usada pelo protocolo TCP e pela API HTTP.
+func AutenticarVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, placa string, senha string) error {
+	if ate, bloqueado := connectionStore.BloqueioAutenticacao(placa); bloqueado {
+		return &ErroVeiculoBloqueado{Ate: ate}
+	}
+
+	veiculo, existe, erro := veiculos.ObterVeiculo(placa)
+	if erro != nil {
+		return fmt.Errorf("erro ao ler cadastro do veículo %s: %v", placa, erro)
+	}
+	if !existe {
+		return ErrVeiculoNaoCadastrado
+	}
+	if veiculo.Senha == nil {
+		return ErrSenhaPendente
+	}
+
+	if !veiculo.Senha.Confere(senha) {
+		ate := connectionStore.RegistrarFalhaAutenticacao(placa)
+		if !ate.IsZero() {
+			logger.Erro(fmt.Sprintf("Veículo %s bloqueado até %s após falhas de autenticação", placa, ate.Format(time.RFC3339)))
+			return &ErroVeiculoBloqueado{Ate: ate}
+		}
+		return ErrSenhaInvalida
+	}
+	connectionStore.LimparFalhasAutenticacao(placa)
+	return nil
+}
+
+// Autentica o veículo na identificação. No primeiro acesso de uma placa que
+// ainda não existe no cadastro a senha informada é cadastrada; placas já
+// cadastradas sem senha são recusadas até o operador cadastrar a senha. Em
+// caso de falha a identificação é recusada, mas a conexão continua aberta
+// para uma nova tentativa.
+func autenticarIdentificacao(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, conexao *dataJson.Conn, mensagem dataJson.Mensagem, identificacao dataJson.Identificacao) bool {
+	placa := identificacao.Placa
+	recusa := dataJson.IdentificacaoRecusada{}
+
+	erro := AutenticarVeiculo(logger, connectionStore, veiculos, placa, identificacao.Senha)
+	if errors.Is(erro, ErrVeiculoNaoCadastrado) {
+		erro = cadastrarVeiculo(veiculos, placa, identificacao.Senha)
+		if erro == nil {
+			logger.Info(fmt.Sprintf("Senha do veículo %s cadastrada", placa))
+			RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.VeiculoCadastrado, Placa: placa})
+		}
+	}
+
+	var bloqueio *ErroVeiculoBloqueado
+	switch {
+	case erro == nil:
+		connectionStore.MarcarAutenticado(conexao)
+		return true
+	case errors.As(erro, &bloqueio):
+		recusa.Motivo = dataJson.MotivoVeiculoBloqueado
+		recusa.BloqueadoAte = bloqueio.Ate.Format(time.RFC3339)
+	case errors.Is(erro, ErrSenhaInvalida):
+		recusa.Motivo = dataJson.MotivoSenhaInvalida
+	case errors.Is(erro, ErrSenhaPendente):
+		recusa.Motivo = dataJson.MotivoSenhaPendente
+	default:
+		recusa.Motivo = dataJson.MotivoAutenticacaoPendente
+	}
+
+	logger.Erro(fmt.Sprintf("Autenticação do veículo %s recusada: (%s) %v", placa, conexao.RemoteAddr(), erro))
+	dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", recusa)
+	return false
+}
+
+func cadastrarVeiculo(veiculos repositorio.VehicleRepository, placa string, senha string) error {
+	hash, erro := dataJson.NovaSenhaVeiculo(senha)
+	if erro != nil {
+		return fmt.Errorf("%w: %v", ErrSenhaInvalida, erro)
+	}
+	erro = veiculos.CadastrarVeiculo(placa, hash)
+	if errors.Is(erro, dataJson.ErrPlacaJaCadastrada) {
+		// Outra conexão cadastrou a placa primeiro
+		return ErrSenhaInvalida
+	}
+	return erro
+}
+
+// Recusa a mensagem se a conexão não for de um veículo autenticado
+func exigirAutenticacao(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) bool {
+	if connectionStore.VeiculoAutenticado(conexao) {
+		return true
+	}
+	logger.Erro(fmt.Sprintf("Mensagem %s recebida de veículo não autenticado: %s", mensagem.Tipo, conexao.RemoteAddr()))
+	dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+		Motivo: dataJson.MotivoAutenticacaoPendente,
+	})
+	return false
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"strings"
+	"testing"
+)
+
+// Só placas novas cadastram a senha no primeiro acesso; as gravadas antes
+// das senhas esperam o operador
+func TestCadastroDeSenha(t *testing.T) {
+	veiculos := repositorio.NewRepositorioMemoria()
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+	if erro := veiculos.SalvarVeiculo("ABC1234"); erro != nil {
+		t.Fatal(erro)
+	}
+
+	identificar := func(placa string, senha string) bool {
+		conexao, _ := conexaoEmMemoria(t)
+		mensagem, _ := dataJson.NewMensagem("identificacao", "veiculo", nil)
+		return autenticarIdentificacao(logger, connectionStore, veiculos, conexao, mensagem, dataJson.Identificacao{Placa: placa, Senha: senha})
+	}
+
+	if !identificar("DEF5G67", "1234") {
+		t.Fatal("placa nova recusada no primeiro acesso")
+	}
+	if identificar("DEF5G67", "4321") {
+		t.Fatal("senha errada aceita depois do cadastro")
+	}
+	if identificar("ABC1234", "1234") {
+		t.Fatal("placa existente cadastrou a senha no primeiro acesso")
+	}
+	if erro := AutenticarVeiculo(logger, connectionStore, veiculos, "ABC1234", "1234"); !errors.Is(erro, ErrSenhaPendente) {
+		t.Fatalf("esperado ErrSenhaPendente, recebido %v", erro)
+	}
+
+	cadastro := func(placa string, senha string) (string, any) {
+		mensagem, erro := dataJson.NewMensagem("cadastrar-senha", "operador", dataJson.CadastrarSenha{Placa: placa, Senha: senha})
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		alvo, _, resposta := cadastrarSenhaOperador(logger, connectionStore, veiculos, mensagem)
+		return alvo, resposta
+	}
+	if _, resposta := cadastro("ABC1234", "12"); resposta != (dataJson.OperacaoFalhou{Motivo: dataJson.MotivoSenhaInvalida}) {
+		t.Fatalf("senha curta cadastrada: %+v", resposta)
+	}
+	if alvo, resposta := cadastro("abc-1234", "segredo"); alvo != "ABC1234" || resposta != nil {
+		t.Fatalf("cadastro pelo operador: %q %+v", alvo, resposta)
+	}
+	if _, resposta := cadastro("ABC1234", "outra"); resposta != (dataJson.OperacaoFalhou{Motivo: dataJson.MotivoSenhaJaCadastrada}) {
+		t.Fatalf("senha substituida pelo operador: %+v", resposta)
+	}
+	if !identificar("ABC1234", "segredo") {
+		t.Fatal("senha cadastrada pelo operador recusada")
+	}
+}
+
+func TestBloqueioDeAutenticacao(t *testing.T) {
+	veiculos := repositorio.NewRepositorioMemoria()
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+	senha, erro := dataJson.NovaSenhaVeiculo("1234")
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	if erro := veiculos.CadastrarVeiculo("ABC1234", senha); erro != nil {
+		t.Fatal(erro)
+	}
+
+	var bloqueio *ErroVeiculoBloqueado
+	tentativas := []struct {
+		placa    string
+		senha    string
+		esperado func(error) bool
+	}{
+		{"ABC1234", "1234", func(erro error) bool { return erro == nil }},
+		{"ZZZ9999", "1234", func(erro error) bool { return errors.Is(erro, ErrVeiculoNaoCadastrado) }},
+		{"ABC1234", "0000", func(erro error) bool { return errors.Is(erro, ErrSenhaInvalida) }},
+		// O acerto zera as falhas contadas
+		{"ABC1234", "1234", func(erro error) bool { return erro == nil }},
+		{"ABC1234", "0001", func(erro error) bool { return errors.Is(erro, ErrSenhaInvalida) }},
+		{"ABC1234", "0002", func(erro error) bool { return errors.Is(erro, ErrSenhaInvalida) }},
+		{"ABC1234", "0003", func(erro error) bool { return errors.Is(erro, ErrSenhaInvalida) }},
+		{"ABC1234", "0004", func(erro error) bool { return errors.Is(erro, ErrSenhaInvalida) }},
+		{"ABC1234", "0005", func(erro error) bool { return errors.As(erro, &bloqueio) }},
+		// Bloqueada, nem a senha certa é aceita
+		{"ABC1234", "1234", func(erro error) bool { return errors.As(erro, &bloqueio) }},
+	}
+	for i, tentativa := range tentativas {
+		erro := AutenticarVeiculo(logger, connectionStore, veiculos, tentativa.placa, tentativa.senha)
+		if !tentativa.esperado(erro) {
+			t.Fatalf("tentativa %d (%s, %s): erro inesperado %v", i, tentativa.placa, tentativa.senha, erro)
+		}
+	}
+}
+
+// Reserva e chegada exigem veículo autenticado, e a chegada só vale para a
+// placa da própria conexão
+func TestPedidosDoVeiculoExigemAutenticacao(t *testing.T) {
+	connectionStore := store.NewConnectionStore()
+	pendente, _ := conexaoEmMemoria(t)
+	connectionStore.AddVeiculo(pendente, "ABC1234")
+	autenticado := conexaoIdentificada(t, connectionStore, "veiculo")
+
+	casos := []struct {
+		nome     string
+		conexao  *dataJson.Conn
+		tipo     string
+		dados    any
+		esperado string
+	}{
+		{"reserva sem autenticacao", pendente, "solicitar-reserva", dataJson.SolicitarReserva{PontoID: 1}, "não autenticado"},
+		{"chegada sem autenticacao", pendente, "veiculo-chegou", dataJson.VeiculoChegou{Placa: "ABC1234"}, "não autenticado"},
+		{"chegada de outra placa", autenticado, "veiculo-chegou", dataJson.VeiculoChegou{Placa: "ABC1234"}, "Chegada informada com placa"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			var saida bytes.Buffer
+			logger := logger.NewLogger(&saida)
+			mensagem, erro := dataJson.NewMensagem(caso.tipo, "veiculo", caso.dados)
+			if erro != nil {
+				t.Fatal(erro)
+			}
+			handleVeiculo(logger, connectionStore, repositorio.NewRepositorioMemoria(), caso.conexao, mensagem)
+			if !strings.Contains(saida.String(), caso.esperado) {
+				t.Fatalf("pedido nao recusado:\n%s", saida.String())
+			}
+		})
+	}
+}
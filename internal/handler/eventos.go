@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"slices"
+)
+
+// Diário onde os eventos de domínio são gravados, definido em ConfigurarDiario.
+// Sem diário os eventos não são gravados.
+var diarioEventos *eventos.Diario
+
+func ConfigurarDiario(diario *eventos.Diario) {
+	diarioEventos = diario
+}
+
+// Grava o evento no diário e atualiza a fila do ponto afetado no
+// ConnectionStore. Uma falha na gravação é registrada no log, sem
+// interromper a operação que gerou o evento.
+func RegistrarEvento(logger *logger.Logger, connectionStore *store.ConnectionStore, evento eventos.Evento) {
+	if diarioEventos == nil {
+		return
+	}
+	if erro := diarioEventos.Registrar(evento); erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao registrar evento %s (%s, ponto %d): %v", evento.Tipo, evento.Placa, evento.PontoID, erro))
+		return
+	}
+	if evento.PontoID != 0 {
+		estado := diarioEventos.Estado()
+		connectionStore.AtualizarFilaDoPonto(evento.PontoID, veiculosDaFila(estado.Filas[evento.PontoID]))
+	}
+}
+
+func veiculosDaFila(placas []string) []dataJson.Veiculo {
+	fila := make([]dataJson.Veiculo, 0, len(placas))
+	for _, placa := range placas {
+		fila = append(fila, dataJson.Veiculo{Placa: placa})
+	}
+	return fila
+}
+
+// Restaura as reservas e as filas reconstruídas a partir do diário e volta
+// a acompanhar a fila de cada reserva
+func RestaurarEstado(logger *logger.Logger, connectionStore *store.ConnectionStore, estado eventos.Estado) {
+	reservasMutex.Lock()
+	for placa, pontoID := range estado.Reservas {
+		reservasAtivas[placa] = pontoID
+	}
+	reservasMutex.Unlock()
+
+	for pontoID, placas := range estado.Filas {
+		connectionStore.AtualizarFilaDoPonto(pontoID, veiculosDaFila(placas))
+	}
+	for placa, pontoID := range estado.Reservas {
+		go monitorarFilaParaVeiculo(logger, connectionStore, placa, pontoID)
+	}
+	logger.Info(fmt.Sprintf("Estado restaurado do diário de eventos: %d reservas, %d filas", len(estado.Reservas), len(estado.Filas)))
+}
+
+// Grava o snapshot do estado e esvazia o diário, a pedido de um operador
+func compactarDiario(logger *logger.Logger) (string, any) {
+	if diarioEventos == nil {
+		return "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoDiarioIndisponivel}
+	}
+	compactacao, erro := diarioEventos.Compactar()
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao compactar o diário de eventos: %v", erro))
+		return "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoFalhaCompactacao}
+	}
+	logger.Info(fmt.Sprintf("Diário de eventos compactado: %d eventos até o evento %d no snapshot", compactacao.Eventos, compactacao.Seq))
+	return "diario-compactado", dataJson.DiarioCompactado{Seq: compactacao.Seq, Eventos: compactacao.Eventos}
+}
+
+// Concilia a fila guardada no servidor com a fila que o ponto mantém, ao
+// ponto se identificar. As reservas registradas no servidor valem: placas
+// que o ponto não conhece voltam para o fim da fila dele, e placas sem
+// reserva no servidor para este ponto são retiradas. A ordem das placas que
+// os dois conhecem segue a do ponto, que é quem atende.
+func reconciliarFila(logger *logger.Logger, connectionStore *store.ConnectionStore, pontoID int) {
+	_, filaPonto, motivo := filaDoPonto(logger, connectionStore, pontoID)
+	if motivo != "" {
+		logger.Erro(fmt.Sprintf("Fila do ponto ID %d nao conciliada: %s", pontoID, motivo))
+		return
+	}
+
+	filaServidor := make([]string, 0)
+	for _, veiculo := range connectionStore.GetFilaPorPonto(pontoID) {
+		filaServidor = append(filaServidor, veiculo.Placa)
+	}
+	reservasMutex.Lock()
+	reservadas := make(map[string]bool)
+	for placa, reservado := range reservasAtivas {
+		if reservado == pontoID {
+			reservadas[placa] = true
+		}
+	}
+	reservasMutex.Unlock()
+	// Reservas sem posição conhecida na fila vão para o fim, em ordem de placa
+	semPosicao := make([]string, 0)
+	for placa := range reservadas {
+		if !slices.Contains(filaServidor, placa) {
+			semPosicao = append(semPosicao, placa)
+		}
+	}
+	slices.Sort(semPosicao)
+	filaServidor = append(slices.DeleteFunc(filaServidor, func(placa string) bool { return !reservadas[placa] }), semPosicao...)
+
+	novaFila := conciliarFilas(filaPonto, filaServidor)
+	for _, placa := range filaPonto {
+		if !slices.Contains(novaFila, placa) {
+			logger.Info(fmt.Sprintf("Veiculo %s sem reserva no servidor retirado da fila do ponto ID %d", placa, pontoID))
+		}
+	}
+	for _, placa := range filaServidor {
+		if !slices.Contains(filaPonto, placa) {
+			logger.Info(fmt.Sprintf("Reserva do veiculo %s devolvida a fila do ponto ID %d", placa, pontoID))
+		}
+	}
+
+	if !slices.Equal(novaFila, filaPonto) {
+		pontoCon := connectionStore.GetConexaoPorID(pontoID)
+		if pontoCon == nil {
+			return
+		}
+		erro := dataJson.SendPayload(pontoCon, "fila-atualizada", "servidor", dataJson.Fila{Placas: novaFila})
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao enviar fila conciliada ao ponto ID %d: %v", pontoID, erro))
+			return
+		}
+	}
+	if !slices.Equal(novaFila, filaServidor) {
+		RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.FilaAlterada, PontoID: pontoID, Placas: novaFila})
+	}
+	logger.Info(fmt.Sprintf("Fila do ponto ID %d conciliada: %v", pontoID, novaFila))
+}
+
+// Fila resultante da conciliação: as placas do servidor, na ordem do ponto,
+// seguidas das que o ponto não conhece, na ordem do servidor
+func conciliarFilas(filaPonto []string, filaServidor []string) []string {
+	novaFila := make([]string, 0, len(filaServidor))
+	for _, placa := range filaPonto {
+		if slices.Contains(filaServidor, placa) && !slices.Contains(novaFila, placa) {
+			novaFila = append(novaFila, placa)
+		}
+	}
+	for _, placa := range filaServidor {
+		if !slices.Contains(novaFila, placa) {
+			novaFila = append(novaFila, placa)
+		}
+	}
+	return novaFila
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConciliarFilas(t *testing.T) {
+	casos := []struct {
+		nome     string
+		ponto    []string
+		servidor []string
+		esperada []string
+	}{
+		{"iguais", []string{"AAA1111", "BBB2222"}, []string{"AAA1111", "BBB2222"}, []string{"AAA1111", "BBB2222"}},
+		{"ordem do ponto", []string{"BBB2222", "AAA1111"}, []string{"AAA1111", "BBB2222"}, []string{"BBB2222", "AAA1111"}},
+		{"ponto reiniciado", nil, []string{"AAA1111", "BBB2222"}, []string{"AAA1111", "BBB2222"}},
+		{"sem reserva no servidor", []string{"AAA1111", "CCC3333"}, []string{"AAA1111"}, []string{"AAA1111"}},
+		{"reserva desconhecida pelo ponto", []string{"BBB2222"}, []string{"AAA1111", "BBB2222", "CCC3333"}, []string{"BBB2222", "AAA1111", "CCC3333"}},
+		{"placa repetida no ponto", []string{"AAA1111", "AAA1111"}, []string{"AAA1111"}, []string{"AAA1111"}},
+	}
+	for _, caso := range casos {
+		if fila := conciliarFilas(caso.ponto, caso.servidor); !slices.Equal(fila, caso.esperada) {
+			t.Errorf("%s: fila %v, esperada %v", caso.nome, fila, caso.esperada)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Cada fuzz target usa um diretório de dados temporário com uma cópia do
+// regiao.json
+func prepararDiretorio(f *testing.F) {
+	diretorio := f.TempDir()
+	// Os processos do fuzzing herdam o diretório atual do coordenador, então o
+	// regiao.json é localizado a partir deste arquivo
+	_, arquivo, _, _ := runtime.Caller(0)
+	regiao, erro := os.ReadFile(filepath.Join(filepath.Dir(arquivo), "..", "dataJson", dataJson.ArquivoRegiao))
+	if erro != nil {
+		f.Fatal(erro)
+	}
+	if erro := os.WriteFile(filepath.Join(diretorio, dataJson.ArquivoRegiao), regiao, 0644); erro != nil {
+		f.Fatal(erro)
+	}
+	dataJson.ConfigurarDiretorioDados(diretorio)
+}
+
+// Conexão do servidor cujo outro lado descarta tudo o que recebe
+func conexaoEmMemoria(t *testing.T) (*dataJson.Conn, net.Conn) {
+	servidor, cliente := net.Pipe()
+	go io.Copy(io.Discard, cliente)
+	t.Cleanup(func() {
+		servidor.Close()
+		cliente.Close()
+	})
+	return dataJson.NewConn(servidor), cliente
+}
+
+// Registra a conexão como já identificada pela origem informada
+func conexaoIdentificada(t *testing.T, connectionStore *store.ConnectionStore, origem string) *dataJson.Conn {
+	conexao, _ := conexaoEmMemoria(t)
+	connectionStore.SetProtocolo(conexao, dataJson.Protocolo{
+		Versao:   dataJson.VersaoProtocoloAtual,
+		Recursos: dataJson.RecursosSuportados(),
+	})
+	switch origem {
+	case "veiculo":
+		connectionStore.AddVeiculo(conexao, "FUZ1A23")
+		connectionStore.MarcarAutenticado(conexao)
+	case "ponto-de-recarga":
+		connectionStore.AddPontoRecargaComID(conexao, 1)
+	case "operador":
+		connectionStore.AddOperador(conexao, "fuzz")
+	}
+	return conexao
+}
+
+func adicionarSementes(f *testing.F, tipos map[string]any) {
+	for tipo, dados := range tipos {
+		bruto, erro := json.Marshal(dados)
+		if erro != nil {
+			f.Fatal(erro)
+		}
+		f.Add(tipo, bruto)
+	}
+	f.Add("tipo-desconhecido", []byte(`{}`))
+	f.Add("identificacao", []byte(`{"versoes":[1],"placa":"`+strings.Repeat("A", 300)+`"}`))
+}
+
+// Executa o handler com a mensagem recebida em uma conexão já identificada
+func fuzzHandler(f *testing.F, origem string, tipos map[string]any,
+	handler func(*logger.Logger, *store.ConnectionStore, repositorio.VehicleRepository, *dataJson.Conn, dataJson.Mensagem)) {
+	prepararDiretorio(f)
+	ConfigurarOperador(nil, nil)
+	adicionarSementes(f, tipos)
+	logger := logger.NewLogger(io.Discard)
+
+	f.Fuzz(func(t *testing.T, tipo string, dados []byte) {
+		connectionStore := store.NewConnectionStore()
+		conexao := conexaoIdentificada(t, connectionStore, origem)
+		mensagem := dataJson.Mensagem{Versao: dataJson.VersaoPayload, ID: 1, Tipo: tipo, Origem: origem, Dados: dados}
+		handler(logger, connectionStore, repositorio.NewRepositorioMemoria(), conexao, mensagem)
+	})
+}
+
+func FuzzHandleVeiculo(f *testing.F) {
+	fuzzHandler(f, "veiculo", map[string]any{
+		"identificacao":     dataJson.Identificacao{Versoes: []int{1}, Placa: "ABC-1234", Senha: "1234"},
+		"verificar-placa":   dataJson.VerificarPlaca{Placa: "abc1d23"},
+		"localizacao":       dataJson.Localizacao{Latitude: -12.25, Longitude: -38.95},
+		"solicitar-reserva": dataJson.SolicitarReserva{PontoID: 1},
+		"veiculo-chegou":    dataJson.VeiculoChegou{Placa: "FUZ1A23"},
+		"get-recarga":       nil,
+	}, handleVeiculo)
+}
+
+func FuzzHandlePontoDeRecarga(f *testing.F) {
+	fuzzHandler(f, "ponto-de-recarga", map[string]any{
+		"identificacao":      dataJson.Identificacao{Versoes: []int{1}, PontoID: 2, Credencial: "ponto-2-dev"},
+		"chamando-veiculo":   dataJson.ChamandoVeiculo{Placa: "FUZ1A23"},
+		"recarga-finalizada": dataJson.RecargaFinalizada{Placa: "FUZ1A23", PontoID: 1, ConsumoKwh: 20, Valor: 30},
+	}, handlePontoDeRecarga)
+}
+
+func FuzzHandleOperador(f *testing.F) {
+	fuzzHandler(f, "operador", map[string]any{
+		"listar-conexoes":     nil,
+		"consultar-fila":      dataJson.PedidoFila{PontoID: 1},
+		"editar-fila":         dataJson.PedidoFila{PontoID: 1, Placas: []string{"FUZ1A23"}},
+		"forcar-liberacao":    dataJson.ForcarLiberacao{PontoID: 1},
+		"cancelar-reserva":    dataJson.CancelarReserva{Placa: "FUZ1A23"},
+		"desconectar-cliente": dataJson.DesconectarCliente{Placa: "FUZ1A23"},
+		"cadastrar-senha":     dataJson.CadastrarSenha{Placa: "FUZ1A23", Senha: "1234"},
+	}, handleOperador)
+}
+
+// Quadros brutos enviados por um cliente desde a conexão, antes da identificação
+func FuzzHandleConnection(f *testing.F) {
+	prepararDiretorio(f)
+	enquadrar := func(mensagens ...dataJson.Mensagem) []byte {
+		var dados []byte
+		for _, mensagem := range mensagens {
+			quadro, erro := dataJson.JSONCodec{}.Encode(mensagem)
+			if erro != nil {
+				f.Fatal(erro)
+			}
+			dados = binary.BigEndian.AppendUint32(dados, uint32(len(quadro)))
+			dados = append(dados, quadro...)
+		}
+		return dados
+	}
+	mensagem := func(tipo string, origem string, dados any) dataJson.Mensagem {
+		msg, erro := dataJson.NewMensagem(tipo, origem, dados)
+		if erro != nil {
+			f.Fatal(erro)
+		}
+		return msg
+	}
+	f.Add(enquadrar(
+		mensagem("identificacao", "veiculo", dataJson.Identificacao{Versoes: []int{1}}),
+		mensagem("get-recarga", "veiculo", nil),
+		mensagem("localizacao", "veiculo", dataJson.Localizacao{Latitude: -12.25, Longitude: -38.95}),
+	))
+	f.Add(enquadrar(
+		mensagem("identificacao", "ponto-de-recarga", dataJson.Identificacao{Versoes: []int{1}, PontoID: 3, Credencial: "ponto-3-dev"}),
+		mensagem("chamando-veiculo", "ponto-de-recarga", dataJson.ChamandoVeiculo{Placa: "ABC1234"}),
+	))
+	f.Add(enquadrar(mensagem("localizacao", "veiculo", dataJson.Localizacao{})))
+	f.Add([]byte{0x7f, 0xff, 0xff, 0xff})
+	logger := logger.NewLogger(io.Discard)
+
+	f.Fuzz(func(t *testing.T, dados []byte) {
+		connectionStore := store.NewConnectionStore()
+		conexao, cliente := conexaoEmMemoria(t)
+		go func() {
+			cliente.Write(dados)
+			cliente.Close()
+		}()
+		HandleConnection(conexao, connectionStore, repositorio.NewRepositorioMemoria(), logger)
+	})
+}
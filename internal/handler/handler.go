@@ -1,16 +1,19 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
+	"recarga-inteligente/internal/certificados"
 	"recarga-inteligente/internal/dataJson"
 	"recarga-inteligente/internal/distancia"
+	"recarga-inteligente/internal/eventos"
 	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
 	"recarga-inteligente/internal/store"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,16 +31,16 @@ var (
 	reservasMutex  sync.Mutex
 )
 
-// ok
-func HandleConnection(conexao net.Conn, connectionStore *store.ConnectionStore, logger *logger.Logger) {
+// Trata as mensagens da conexão até ela ser encerrada. Os veículos e as
+// recargas são guardados em veiculos, o mesmo repositório usado pela API HTTP.
+func HandleConnection(conexao *dataJson.Conn, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, logger *logger.Logger) {
 	defer connectionStore.RemoveConnection(conexao)
 	on := true
 	for on {
 		//recebe mensagem inicial
 		mensagemRecebida, erro := dataJson.ReceiveMessage(conexao)
 		if erro != nil {
-			e := fmt.Sprintf("%v", erro)
-			if e == "erro: EOF" {
+			if errors.Is(erro, io.EOF) || errors.Is(erro, net.ErrClosed) {
 				logger.Info(fmt.Sprintf("conexao (%s) desconectada", conexao.RemoteAddr()))
 			} else {
 				logger.Erro(fmt.Sprintf("Erro ao ler mensagem inicial: %v", erro))
@@ -45,123 +48,284 @@ func HandleConnection(conexao net.Conn, connectionStore *store.ConnectionStore,
 			on = false
 			continue
 		}
+		connectionStore.RegistrarContato(conexao)
 
-		// Processa cada mensagem em uma goroutine separada para não bloquear o loop principal
-		go func(mensagem dataJson.Mensagem, conn net.Conn) {
+		// A resposta ao heartbeat só serve para registrar o contato
+		if mensagemRecebida.Tipo == "pong" {
+			continue
+		}
+
+		// Respostas a pedidos do servidor vão para quem as aguarda
+		if entregarResposta(conexao, mensagemRecebida) {
+			continue
+		}
+
+		// Limite de taxa por conexão e por placa, inclusive para a identificação
+		if !verificarLimite(logger, connectionStore, conexao, mensagemRecebida) {
+			continue
+		}
+
+		// Veículos e operadores não respondem a nada que o servidor não tenha
+		// pedido; a resposta sem dono é descartada em vez de virar um pedido
+		if mensagemRecebida.ReplyTo != 0 && connectionStore.GetIdPonto(conexao) == 0 {
+			logger.Info(fmt.Sprintf("Resposta %s sem pedido correspondente de %s descartada", mensagemRecebida.Tipo, conexao.RemoteAddr()))
+			continue
+		}
+
+		tratarMensagem := func(mensagem dataJson.Mensagem, conn *dataJson.Conn) {
 			switch mensagem.Origem {
 			case "ponto-de-recarga":
-				handlePontoDeRecarga(logger, connectionStore, conn, mensagem)
+				handlePontoDeRecarga(logger, connectionStore, veiculos, conn, mensagem)
 			case "veiculo":
-				handleVeiculo(logger, connectionStore, conn, mensagem)
+				handleVeiculo(logger, connectionStore, veiculos, conn, mensagem)
+			case "operador":
+				handleOperador(logger, connectionStore, veiculos, conn, mensagem)
 			default:
 				logger.Info("Origem desconhecida, ignorando mensagem")
+				recusarPedido(logger, conn, mensagem, &dataJson.ErroValidacao{Campo: "origem", Motivo: dataJson.MotivoFormatoInvalido})
 			}
-		}(mensagemRecebida, conexao)
+		}
+
+		// A identificação define o protocolo da conexão, então é tratada antes da próxima leitura
+		if mensagemRecebida.Tipo == "identificacao" {
+			tratarMensagem(mensagemRecebida, conexao)
+			continue
+		}
+
+		// Nenhuma outra mensagem é aceita antes da identificação
+		if _, identificada := connectionStore.GetProtocolo(conexao); !identificada {
+			logger.Erro(fmt.Sprintf("Mensagem %s recebida antes da identificacao: %s", mensagemRecebida.Tipo, conexao.RemoteAddr()))
+			dataJson.SendReply(conexao, mensagemRecebida, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+				Motivo: dataJson.MotivoIdentificacaoPendente,
+			})
+			continue
+		}
+
+		// Processa cada mensagem em uma goroutine separada para não bloquear o loop principal
+		go tratarMensagem(mensagemRecebida, conexao)
+	}
+}
+
+// Negocia a versão do protocolo e os recursos com o cliente que está se identificando.
+// Clientes sem versão em comum recebem a recusa e são desconectados.
+func negociarProtocolo(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) (dataJson.Identificacao, dataJson.Protocolo, bool) {
+	var identificacao dataJson.Identificacao
+	erro := mensagem.DecodeDados(&identificacao)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao ler identificacao de %s: %v -> desconectado", conexao.RemoteAddr(), erro))
+		dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+			Motivo: dataJson.MotivoPedidoInvalido,
+		})
+		connectionStore.RemoveConnection(conexao)
+		return identificacao, dataJson.Protocolo{}, false
+	}
+
+	protocolo, ok := dataJson.NegociarProtocolo(identificacao.Versoes, identificacao.Recursos)
+	if !ok {
+		logger.Erro(fmt.Sprintf("Cliente %s sem versao de protocolo compativel (%v) -> desconectado", conexao.RemoteAddr(), identificacao.Versoes))
+		dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+			Motivo:            dataJson.MotivoVersaoIncompativel,
+			VersoesSuportadas: dataJson.VersoesSuportadas(),
+		})
+		connectionStore.RemoveConnection(conexao)
+		return identificacao, protocolo, false
+	}
+	return identificacao, protocolo, true
+}
+
+// Responde pedido-invalido a uma mensagem de tipo desconhecido ou com payload
+// inválido, informando o campo recusado quando o erro é de validação. Respostas
+// a pedidos do servidor não são respondidas.
+func recusarPedido(logger *logger.Logger, conexao *dataJson.Conn, mensagem dataJson.Mensagem, erro error) {
+	if mensagem.ReplyTo != 0 {
+		return
+	}
+	pedido := dataJson.PedidoInvalido{Tipo: mensagem.Tipo, Motivo: dataJson.MotivoPayloadInvalido}
+	var validacao *dataJson.ErroValidacao
+	if errors.As(erro, &validacao) {
+		pedido.Campo, pedido.Motivo = validacao.Campo, validacao.Motivo
+	}
+	// O tipo recebido só é devolvido se ele mesmo for válido
+	if pedido.Validar() != nil {
+		pedido.Tipo = ""
+	}
+	erroEnvio := dataJson.SendReply(conexao, mensagem, "pedido-invalido", "servidor", pedido)
+	if erroEnvio != nil {
+		logger.Erro(fmt.Sprintf("Erro ao recusar pedido de %s: %v", conexao.RemoteAddr(), erroEnvio))
+	}
+}
+
+// Confirma a identificação informando a versão e os recursos escolhidos.
+// A confirmação segue em JSON; as mensagens seguintes usam o codec negociado.
+func aceitarIdentificacao(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem, aceita dataJson.IdentificacaoAceita) {
+	connectionStore.SetProtocolo(conexao, aceita.Protocolo())
+	erro := dataJson.SendReply(conexao, mensagem, "identificacao-aceita", "servidor", aceita)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao confirmar identificacao de %s: %v", conexao.RemoteAddr(), erro))
+	}
+	conexao.SetCodec(dataJson.CodecDoProtocolo(aceita.Protocolo()))
+}
+
+// Associa a conexão ao ID com que o ponto se identificou. Com TLS o ID vem do
+// certificado de cliente, obrigatório para pontos; sem TLS o ponto informa o
+// ID e a credencial cadastrados em regiao.json.
+func registrarPonto(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem, identificacao dataJson.Identificacao) (int, bool) {
+	var id int
+	motivo := ""
+	if conexao.TLS() {
+		id, motivo = identificarPontoTLS(logger, conexao, identificacao)
+	} else {
+		id, motivo = identificarPontoCredencial(logger, conexao, identificacao)
+	}
+
+	if motivo == "" && !connectionStore.AddPontoRecargaComID(conexao, id) {
+		motivo = dataJson.MotivoPontoIndisponivel
+		logger.Erro(fmt.Sprintf("Ponto ID %d ja conectado -> desconectado: %s", id, conexao.RemoteAddr()))
+	}
+	if motivo == "" {
+		return id, true
+	}
+
+	dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{Motivo: motivo})
+	connectionStore.RemoveConnection(conexao)
+	return 0, false
+}
+
+// Obtém o ID do ponto pelo certificado de cliente. Retorna o motivo da recusa
+// se o certificado não identificar um ponto cadastrado.
+func identificarPontoTLS(logger *logger.Logger, conexao *dataJson.Conn, identificacao dataJson.Identificacao) (int, string) {
+	identidade, temCertificado := conexao.IdentidadeTLS()
+	id, nomeValido := certificados.PontoIDDoNome(identidade)
+	switch {
+	case !temCertificado:
+		logger.Erro(fmt.Sprintf("Ponto de recarga sem certificado de cliente -> desconectado: %s", conexao.RemoteAddr()))
+		return 0, dataJson.MotivoCertificadoAusente
+	case !nomeValido || (identificacao.PontoID != 0 && identificacao.PontoID != id):
+		logger.Erro(fmt.Sprintf("Certificado %q nao identifica o ponto de recarga %d -> desconectado: %s", identidade, identificacao.PontoID, conexao.RemoteAddr()))
+		return 0, dataJson.MotivoCertificadoInvalido
+	}
+	if _, resultado := dataJson.GetPontoId(id); resultado != 0 {
+		logger.Erro(fmt.Sprintf("Ponto ID %d nao cadastrado -> desconectado: %s", id, conexao.RemoteAddr()))
+		return 0, dataJson.MotivoPontoNaoCadastrado
 	}
+	return id, ""
 }
 
-func handlePontoDeRecarga(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao net.Conn, mensagem dataJson.Mensagem) {
+// Confere o ID e a credencial informados com o cadastro de regiao.json.
+// Retorna o motivo da recusa se o ponto não for reconhecido.
+func identificarPontoCredencial(logger *logger.Logger, conexao *dataJson.Conn, identificacao dataJson.Identificacao) (int, string) {
+	id := identificacao.PontoID
+	ponto, resultado := dataJson.GetPontoId(id)
+	if id <= 0 || resultado != 0 {
+		logger.Erro(fmt.Sprintf("Ponto de recarga nao cadastrado (ID %d) tentando se conectar -> desconectado: %s", id, conexao.RemoteAddr()))
+		return 0, dataJson.MotivoPontoNaoCadastrado
+	}
+	if !ponto.CredencialValida(identificacao.Credencial) {
+		logger.Erro(fmt.Sprintf("Credencial invalida para o ponto ID %d -> desconectado: %s", id, conexao.RemoteAddr()))
+		return 0, dataJson.MotivoCredencialInvalida
+	}
+	return id, ""
+}
+
+func handlePontoDeRecarga(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
 
 	if mensagem.Tipo == "identificacao" {
-		idPonto := connectionStore.AddPontoRecarga(conexao)
-		if idPonto == -1 {
-			logger.Erro(fmt.Sprintf("Ponto de recarga nao cadastrado tentando se conectar -> desconectado: %s", conexao.RemoteAddr()))
-			connectionStore.RemoveConnection(conexao)
+		identificacao, protocolo, ok := negociarProtocolo(logger, connectionStore, conexao, mensagem)
+		if !ok {
+			return
+		}
+
+		idPonto, ok := registrarPonto(logger, connectionStore, conexao, mensagem, identificacao)
+		if !ok {
 			return
 		}
-		logger.Info(fmt.Sprintf("Novo ponto de recarga conectado id: (%d)", idPonto))
+		aceitarIdentificacao(logger, connectionStore, conexao, mensagem, dataJson.IdentificacaoAceita{
+			Versao:   protocolo.Versao,
+			Recursos: protocolo.Recursos,
+		})
+		logger.Info(fmt.Sprintf("Novo ponto de recarga conectado id: (%d) protocolo v%d", idPonto, protocolo.Versao))
+
+		// A resposta do ponto chega por esta mesma leitura, então a conciliação
+		// não pode bloqueá-la
+		go reconciliarFila(logger, connectionStore, idPonto)
 
 		// Solicitar disponibilidade inicial
-		disponibilidade := disponibilidadePonto(logger, connectionStore, idPonto)
-		logger.Info(fmt.Sprintf("Disponibilidade inicial do Ponto id (%d) recebida: %s", idPonto, disponibilidade.Conteudo))
+		disponibilidade, erro := disponibilidadePonto(logger, connectionStore, idPonto)
+		if erro == nil {
+			logger.Info(fmt.Sprintf("Disponibilidade inicial do Ponto id (%d) recebida: %d na fila", idPonto, disponibilidade.TamanhoFila))
+		}
 		return
 	}
 
 	id := connectionStore.GetIdPonto(conexao)
 	switch mensagem.Tipo {
+	case "disponibilidade", "status-fila":
+		// Respostas a get-disponibilidade e nova-solicitacao, enviados sem
+		// aguardar resposta: a fila considerada é a do servidor
 	case "chamando-veiculo":
 		// O ponto está chamando um veículo para atendimento
-		placaVeiculo := mensagem.Conteudo
+		var chamada dataJson.ChamandoVeiculo
+		if erro := mensagem.DecodeDados(&chamada); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao ler chamada do ponto ID %d: %v", id, erro))
+			recusarPedido(logger, conexao, mensagem, erro)
+			return
+		}
+		placaVeiculo := chamada.Placa
 		logger.Info(fmt.Sprintf("Ponto ID %d está chamando o veículo %s", id, placaVeiculo))
 
-		// Localizar a conexão do veículo
-		veiculoCon := connectionStore.GetConexaoPorPlaca(placaVeiculo)
-		if veiculoCon != nil {
-			// Criar uma goroutine para não bloquear o processamento do ponto
-			go func() {
-				msgSuaVez := dataJson.Mensagem{
-					Tipo:     "sua-vez",
-					Conteudo: fmt.Sprintf("É sua vez de ser atendido no ponto ID %d!", id),
-					Origem:   "servidor",
-				}
-				erro := dataJson.SendMessage(veiculoCon, msgSuaVez)
-				if erro != nil {
-					logger.Erro(fmt.Sprintf("Erro ao notificar veículo %s que é sua vez: %v", placaVeiculo, erro))
-				}
-			}()
-		}
+		// Criar uma goroutine para não bloquear o processamento do ponto
+		go func() {
+			erro := notificarVeiculo(logger, connectionStore, placaVeiculo, "sua-vez", dataJson.SuaVez{PontoID: id})
+			if erro != nil {
+				logger.Erro(fmt.Sprintf("Erro ao notificar veículo %s que é sua vez: %v", placaVeiculo, erro))
+			}
+		}()
 
 	case "recarga-finalizada":
 		// Extrair informações da recarga
-		var placaVeiculo string
-		var consumoTotal, valor float64
-		var pontoID int
-
-		pontoID = id
-
-		n, err := fmt.Sscanf(mensagem.Conteudo, "Veiculo %s atendido. Consumo: %f kWh, Valor: R$ %f",
-			&placaVeiculo, &consumoTotal, &valor)
-
-		if err != nil || n != 3 {
-			//logger.Erro(fmt.Sprintf("Erro ao extrair informacoes da recarga: %v (itens extraídos: %d)", err, n))
-
-			// Método alternativo de extração como fallback
-			if strings.Contains(mensagem.Conteudo, "Veículo") {
-				parts := strings.Split(mensagem.Conteudo, "Veículo ")
-				if len(parts) > 1 {
-					placaParts := strings.Split(parts[1], " ")
-					placaVeiculo = placaParts[0]
-
-					// Tentar extrair valores novamente
-					valorParts := strings.Split(mensagem.Conteudo, "Valor: R$ ")
-					if len(valorParts) > 1 {
-						valor, _ = strconv.ParseFloat(strings.TrimSpace(valorParts[1]), 64)
-					}
-
-					consumoParts := strings.Split(mensagem.Conteudo, "Consumo: ")
-					if len(consumoParts) > 1 {
-						consumoStr := strings.Split(consumoParts[1], " kWh")[0]
-						consumoTotal, _ = strconv.ParseFloat(strings.TrimSpace(consumoStr), 64)
-					}
-				}
-			}
+		var recarga dataJson.RecargaFinalizada
+		if erro := mensagem.DecodeDados(&recarga); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao extrair informacoes da recarga do ponto ID %d: %v", id, erro))
+			recusarPedido(logger, conexao, mensagem, erro)
+			return
 		}
 
+		// O ponto é identificado pela conexão, não pelo que ele informa
+		pontoID := id
+		recarga.PontoID = pontoID
+		placaVeiculo := recarga.Placa
+		consumoTotal := recarga.ConsumoKwh
+		valor := recarga.Valor
+
 		logger.Info(fmt.Sprintf("Recarga finalizada pelo ponto ID %d para veículo %s: Consumo: %.2f kWh, Valor: R$ %.2f",
 			pontoID, placaVeiculo, consumoTotal, valor))
 
-		// 1. Remover do mapa de reservas ativas primeiro para liberar o ponto
-		reservasMutex.Lock()
-		delete(reservasAtivas, placaVeiculo)
-		reservasMutex.Unlock()
-
-		// 2. Notificar o ponto que pode processar o próximo veículo imediatamente
-		msgLiberarPonto := dataJson.Mensagem{
-			Tipo:     "liberar-ponto",
-			Conteudo: "Ponto liberado para atender próximo veículo",
-			Origem:   "servidor",
+		// 1. Encerrar a reserva primeiro para liberar o ponto. Um ponto só
+		// encerra a recarga de quem o reservou ou está na sua fila
+		if !encerrarReserva(connectionStore, placaVeiculo, pontoID) {
+			logger.Erro(fmt.Sprintf("Ponto ID %d informou recarga do veículo %s, que não está no ponto -> recusada", pontoID, placaVeiculo))
+			recusarPedido(logger, conexao, mensagem, &dataJson.ErroValidacao{Campo: "placa", Motivo: dataJson.MotivoSemReserva})
+			return
 		}
 
+		// 2. Notificar o ponto que pode processar o próximo veículo imediatamente
 		// Enviamos em uma goroutine para não bloquear
 		go func() {
-			err := dataJson.SendMessage(conexao, msgLiberarPonto)
+			err := dataJson.SendPayload(conexao, "liberar-ponto", "servidor", nil)
 			if err != nil {
 				logger.Erro(fmt.Sprintf("Erro ao notificar ponto sobre liberação: %v", err))
 			}
 		}()
 
-		// 3. Registrar a recarga no histórico
-		erro := dataJson.RegistrarRecarga(placaVeiculo, pontoID, valor)
+		// 3. Registrar a recarga no diário de eventos e no histórico
+		RegistrarEvento(logger, connectionStore, eventos.Evento{
+			Tipo:       eventos.RecargaFinalizada,
+			Placa:      placaVeiculo,
+			PontoID:    pontoID,
+			ConsumoKwh: consumoTotal,
+			Valor:      valor,
+		})
+		erro := veiculos.RegistrarRecarga(placaVeiculo, pontoID, valor)
 		if erro != nil {
 			logger.Erro(fmt.Sprintf("Erro ao registrar recarga: %v", erro))
 		} else {
@@ -170,120 +334,77 @@ func handlePontoDeRecarga(logger *logger.Logger, connectionStore *store.Connecti
 		}
 
 		// 4. Notificar o veículo - isso deve estar em uma goroutine e usar o tipo correto
-		veiculoCon := connectionStore.GetConexaoPorPlaca(placaVeiculo)
-		if veiculoCon != nil {
-			// Usar uma goroutine para não bloquear
-			go func() {
-				msgVeiculo := dataJson.Mensagem{
-					Tipo:     "recarga-finalizada",
-					Conteudo: mensagem.Conteudo,
-					Origem:   "servidor",
-				}
+		go func() {
+			erro := notificarVeiculo(logger, connectionStore, placaVeiculo, "recarga-finalizada", recarga)
+			if erro != nil {
+				logger.Erro(fmt.Sprintf("Erro ao notificar veículo %s sobre recarga finalizada: %v",
+					placaVeiculo, erro))
+			} else {
+				logger.Info(fmt.Sprintf("Veículo %s notificado sobre recarga finalizada", placaVeiculo))
+			}
+		}()
 
-				erro := dataJson.SendMessage(veiculoCon, msgVeiculo)
-				if erro != nil {
-					logger.Erro(fmt.Sprintf("Erro ao notificar veículo %s sobre recarga finalizada: %v",
-						placaVeiculo, erro))
-				} else {
-					logger.Info(fmt.Sprintf("Veículo %s notificado sobre recarga finalizada", placaVeiculo))
-				}
-			}()
-		} else {
-			logger.Erro(fmt.Sprintf("Conexão do veículo %s não encontrada para notificar sobre recarga finalizada", placaVeiculo))
+	default:
+		// Respostas que chegaram depois do prazo de quem as aguardava
+		if mensagem.ReplyTo != 0 {
+			return
 		}
+		logger.Erro(fmt.Sprintf("Tipo de mensagem do ponto ID %d ainda nao foi mapeada - %s", id, mensagem.Tipo))
+		recusarPedido(logger, conexao, mensagem, &dataJson.ErroValidacao{Campo: "tipo", Motivo: dataJson.MotivoTipoDesconhecido})
 	}
 }
 
 // ok
-func disponibilidadePonto(logger *logger.Logger, connectionStore *store.ConnectionStore, pontoId int) dataJson.Mensagem {
+func disponibilidadePonto(logger *logger.Logger, connectionStore *store.ConnectionStore, pontoId int) (dataJson.Disponibilidade, error) {
 	fila := connectionStore.GetFilaPorPonto(pontoId)
 	conexaoPonto := connectionStore.GetConexaoPorID(pontoId)
-	filaJSON, err := json.Marshal(fila)
-	if err != nil {
-		logger.Erro(fmt.Sprintf("Erro ao serializar fila do ponto %d: %v", pontoId, err))
-	} else {
-		msgFila := dataJson.Mensagem{
-			Tipo:     "atualizar-fila",
-			Conteudo: string(filaJSON),
-			Origem:   "servidor",
-		}
-		err = dataJson.SendMessage(conexaoPonto, msgFila)
-		if err != nil {
-			logger.Erro(fmt.Sprintf("Erro ao enviar fila para ponto %d: %v", pontoId, err))
-		} else {
-			//logger.Info(fmt.Sprintf("Fila Recebida do ponto %d com sucesso", pontoId))
-		}
+	if conexaoPonto == nil {
+		return dataJson.Disponibilidade{}, fmt.Errorf("ponto ID %d não está conectado", pontoId)
 	}
 
-	solicitacao := dataJson.Mensagem{
-		Tipo:     "get-disponibilidade",
-		Conteudo: fmt.Sprintf("Ola ponto de recarga id (%d)! Informe sua disponibilidade / fila", pontoId),
-		Origem:   "servidor",
+	placas := make([]string, 0, len(fila))
+	for _, veiculo := range fila {
+		placas = append(placas, veiculo.Placa)
+	}
+	err := dataJson.SendPayload(conexaoPonto, "atualizar-fila", "servidor", dataJson.Fila{Placas: placas})
+	if err != nil {
+		logger.Erro(fmt.Sprintf("Erro ao enviar fila para ponto %d: %v", pontoId, err))
 	}
-	erro := dataJson.SendMessage(conexaoPonto, solicitacao)
+
+	erro := dataJson.SendPayload(conexaoPonto, "get-disponibilidade", "servidor", nil)
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao solicitar disponibilidade ao ponto-de-recarga id (%d): %v", pontoId, erro))
-		return dataJson.Mensagem{}
+		return dataJson.Disponibilidade{}, erro
 	}
 
 	disponibilidade := connectionStore.GetFilaPorPonto(pontoId)
-
-	status := "Situacao atual: "
-	if len(disponibilidade) == 0 {
-		status += "sem fila"
-	} else {
-		status += fmt.Sprintf("com %d na fila", len(disponibilidade))
-	}
-
-	msg := dataJson.Mensagem{
-		Tipo:     "disponibilidade",
-		Conteudo: status,
-		Origem:   "ponto-de-recarga",
-	}
-
-	return msg
+	return dataJson.Disponibilidade{TamanhoFila: len(disponibilidade)}, nil
 }
 
 // ok
-func processarLocalizacao(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao net.Conn, mensagem dataJson.Mensagem) {
-	var latitude, longitude float64
-	_, erro := fmt.Sscanf(mensagem.Conteudo, "%f,%f", &latitude, &longitude)
+func processarLocalizacao(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
+	var localizacao dataJson.Localizacao
+	erro := mensagem.DecodeDados(&localizacao)
+	if erro == nil {
+		erro = ValidarLocalizacao(localizacao)
+	}
 	if erro != nil {
 		logger.Erro(fmt.Sprintf("Erro ao receber localizacao: %v", erro))
+		recusarPedido(logger, conexao, mensagem, erro)
 		return
 	}
-	logger.Info(fmt.Sprintf("Localizacao recebida: Latitude %f, Longitude %f", latitude, longitude))
-
-	logger.Info("Calculando ranking dos pontos de recarga...")
 
-	// Calcular ranking
-	ranking := calcularRankingPontos(logger, latitude, longitude, connectionStore)
-
-	for i, ponto := range ranking {
-		logger.Info(fmt.Sprintf("Ranking[%d]: ID=%d, Distância=%.2f, Fila=%d, Score=%.2f",
-			i, ponto.ID, ponto.Distancia, ponto.Fila, ponto.Score))
-	}
+	rankingPontos := RankingParaLocalizacao(logger, connectionStore, localizacao)
 
 	// Enviar ranking ao veículo
 	logger.Info("Enviando ranking ao veículo...")
 
-	var rankingStr string
-	for i, ponto := range ranking {
-		// Modificar a exibição da fila para não mostrar '999' ao usuário
-		filaExibicao := ponto.Fila
-		if filaExibicao == 999 {
-			filaExibicao = 0 // Mostrar como 0 para o usuário quando não temos informação
-		}
-
-		rankingStr += fmt.Sprintf("%d. Ponto ID: %d, Distância: %.2f km, Fila: %d veículos\n",
-			i+1, ponto.ID, ponto.Distancia, filaExibicao)
-	}
-
-	msg := dataJson.Mensagem{
-		Tipo:     "ranking-pontos",
-		Conteudo: rankingStr,
-		Origem:   "servidor",
+	msg, erro := dataJson.NewMensagem("ranking-pontos", "servidor", rankingPontos)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao montar ranking: %v", erro))
+		return
 	}
+	msg.ReplyTo = mensagem.ID
 
 	// Tentar enviar a mensagem com retry
 	maxRetries := 3
@@ -303,81 +424,32 @@ func processarLocalizacao(logger *logger.Logger, connectionStore *store.Connecti
 
 //
 
-func processarReserva(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao net.Conn, mensagem dataJson.Mensagem) {
-	pontoID, _ := strconv.Atoi(mensagem.Conteudo)
-	logger.Info(fmt.Sprintf("Reserva solicitada para ponto ID %d", pontoID))
+func processarReserva(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
+	var pedido dataJson.SolicitarReserva
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao ler solicitação de reserva: %v", erro))
+		dataJson.SendReply(conexao, mensagem, "reserva-falhou", "servidor", dataJson.ReservaFalhou{Motivo: dataJson.MotivoPedidoInvalido})
+		return
+	}
 
 	// Obter placa do veículo
 	placa := connectionStore.GetVeiculoPlaca(conexao)
 
-	// Encontrar a conexão do ponto pelo ID
-	pontoCon := connectionStore.GetConexaoPorID(pontoID)
-	if pontoCon == nil {
-		logger.Erro(fmt.Sprintf("Ponto ID %d não encontrado", pontoID))
+	confirmacao, erro := ReservarPonto(logger, connectionStore, placa, pedido.PontoID)
+	var falha *ErroReserva
+	if errors.As(erro, &falha) {
 		// Informar ao veículo que a reserva falhou
-		msg := dataJson.Mensagem{
-			Tipo:     "reserva-falhou",
-			Conteudo: fmt.Sprintf("Ponto ID %d não encontrado", pontoID),
-			Origem:   "servidor",
-		}
-		dataJson.SendMessage(conexao, msg)
+		dataJson.SendReply(conexao, mensagem, "reserva-falhou", "servidor", falha.Falha)
 		return
 	}
 
-	//filaAtual := connectionStore.GetFilaPorPonto(pontoID)
-	//logger.Info(fmt.Sprintf("Verificação em tempo real: Ponto ID %d tem %d veículos na fila", pontoID, len(filaAtual)+1))
-
-	// Enviar solicitação para o ponto
-	msgPonto := dataJson.Mensagem{
-		Tipo:     "nova-solicitacao",
-		Conteudo: placa,
-		Origem:   "servidor",
-	}
-
-	erro := dataJson.SendMessage(pontoCon, msgPonto)
+	// Sempre enviar uma mensagem ao veículo, independente do resultado
+	msgConfirmacao, erro := dataJson.NewMensagem("reserva-confirmada", "servidor", confirmacao)
 	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao enviar solicitação ao ponto: %v", erro))
-
-		// Notificar o veículo sobre a falha mesmo em caso de erro
-		msgFalha := dataJson.Mensagem{
-			Tipo:     "reserva-falhou",
-			Conteudo: fmt.Sprintf("Falha ao comunicar com o ponto ID %d", pontoID),
-			Origem:   "servidor",
-		}
-		dataJson.SendMessage(conexao, msgFalha)
+		logger.Erro(fmt.Sprintf("Erro ao montar confirmação de reserva: %v", erro))
 		return
 	}
-
-	// Registrar a reserva temporariamente em memória
-	reservasMutex.Lock()
-	reservasAtivas[placa] = pontoID
-	reservasMutex.Unlock()
-
-	// Consulta a fila diretamente no servidor
-	fila := connectionStore.GetFilaPorPonto(pontoID)
-	posicaoFila := len(fila) + 1 // Posição padrão se o veículo ainda não estiver na fila
-
-	// Verifica a posição real do veículo (placa)
-	for i, v := range fila {
-		if v.Placa == placa {
-			posicaoFila = i + 1
-			break
-		}
-	}
-
-	var mensagemStatus string
-	// Sempre enviar uma mensagem ao veículo, independente do resultado
-	if posicaoFila <= 1 {
-		mensagemStatus = fmt.Sprintf("Reserva confirmada para ponto ID %d. Você é o próximo a ser atendido!", pontoID)
-	} else {
-		mensagemStatus = fmt.Sprintf("Reserva confirmada para ponto ID %d. Você está na posição %d da fila, aguarde sua vez.", pontoID, posicaoFila)
-	}
-
-	msgConfirmacao := dataJson.Mensagem{
-		Tipo:     "reserva-confirmada",
-		Conteudo: mensagemStatus,
-		Origem:   "servidor",
-	}
+	msgConfirmacao.ReplyTo = mensagem.ID
 
 	// Tentar enviar várias vezes se necessário
 	maxTentativas := 3
@@ -389,11 +461,11 @@ func processarReserva(logger *logger.Logger, connectionStore *store.ConnectionSt
 		logger.Erro(fmt.Sprintf("Tentativa %d: Erro ao enviar confirmação ao veículo: %v", i+1, err))
 		time.Sleep(100 * time.Millisecond)
 	}
-
-	go monitorarFilaParaVeiculo(logger, connectionStore, conexao, placa, pontoID)
 }
 
-func monitorarFilaParaVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculoCon net.Conn, placa string, pontoID int) {
+// O veículo é localizado pela placa a cada atualização, pois pode ter
+// retomado a sessão em outra conexão
+func monitorarFilaParaVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string, pontoID int) {
 	// Monitorar por no máximo 10 minutos
 	timeout := time.After(10 * time.Minute)
 	ticker := time.NewTicker(10 * time.Second)
@@ -417,20 +489,16 @@ func monitorarFilaParaVeiculo(logger *logger.Logger, connectionStore *store.Conn
 			//tamanhoFila := verificarFilaPontoEspecifico(logger, connectionStore, pontoID)
 
 			// Calcular posição estimada do veículo
-			resp := disponibilidadePonto(logger, connectionStore, pontoID)
-			//logger.Info(fmt.Sprintf("disponibilidade recebida em monitorarFilaParaVeiculo: %s", resp.Conteudo))
+			_, erro := disponibilidadePonto(logger, connectionStore, pontoID)
 
-			if resp.Tipo == "disponibilidade" {
+			if erro == nil {
 				// Enviar atualização ao veículo
-				msgAtualizar := dataJson.Mensagem{
-					Tipo: "posicao-fila",
-					Conteudo: fmt.Sprintf("Atualização: Você está na fila do ponto ID %d.",
-						pontoID),
-					Origem: "servidor",
-				}
-
 				// Não interromper o monitoramento se falhar ao enviar uma atualização
-				err := dataJson.SendMessage(veiculoCon, msgAtualizar)
+				veiculoCon := connectionStore.GetConexaoPorPlaca(placa)
+				if veiculoCon == nil {
+					continue
+				}
+				err := dataJson.SendPayload(veiculoCon, "posicao-fila", "servidor", dataJson.PosicaoFila{PontoID: pontoID})
 				if err != nil {
 					logger.Erro(fmt.Sprintf("Erro ao enviar atualização da fila para veículo %s: %v", placa, err))
 				}
@@ -464,21 +532,19 @@ func consultarDisponibilidadePontos(logger *logger.Logger, connectionStore *stor
 	pontosMap := connectionStore.GetPontosMap()
 	for conexao, id := range pontosMap {
 		wg.Add(1)
-		go func(conexao net.Conn, id int) {
+		go func(conexao *dataJson.Conn, id int) {
 			defer wg.Done()
 
 			// Criar um canal para timeout individual da consulta
 			consultaTimeout := time.After(2 * time.Second)
 
 			// Canal para receber a resposta da consulta
-			respChan := make(chan dataJson.Mensagem, 1)
+			respChan := make(chan dataJson.Disponibilidade, 1)
 
 			// Fazer a consulta em uma goroutine
 			go func() {
-				resp := disponibilidadePonto(logger, connectionStore, id)
-				//logger.Info(fmt.Sprintf("disponibilidade recebida em consultarDisponibilidadePontos: %s", resp.Conteudo))
-
-				if resp.Tipo == "disponibilidade" {
+				resp, erro := disponibilidadePonto(logger, connectionStore, id)
+				if erro == nil {
 					respChan <- resp
 				}
 			}()
@@ -486,19 +552,11 @@ func consultarDisponibilidadePontos(logger *logger.Logger, connectionStore *stor
 			// Esperar pela resposta ou timeout
 			select {
 			case resp := <-respChan:
-				// Extrair o número de veículos na fila da resposta
-				var tamanhoFila int
-				if strings.Contains(resp.Conteudo, "sem fila") {
-					tamanhoFila = 0
-				} else {
-					fmt.Sscanf(resp.Conteudo, "Situacao atual: com %d na fila", &tamanhoFila)
-				}
-
 				// Enviar o resultado para o canal principal
 				resultados <- struct {
 					id          int
 					tamanhoFila int
-				}{id, tamanhoFila}
+				}{id, resp.TamanhoFila}
 
 			case <-consultaTimeout:
 				logger.Erro(fmt.Sprintf("Timeout ao consultar disponibilidade do ponto ID %d", id))
@@ -534,19 +592,18 @@ func consultarDisponibilidadePontos(logger *logger.Logger, connectionStore *stor
 	return filas
 }
 
-// ok
-func calcDistancia(latVeiculo float64, lonVeiculo float64, totalPontos int) (map[int]float64, error) {
+// Distância até cada ponto conectado. Pontos que acabaram de ser retirados
+// de regiao.json e ainda não foram desconectados ficam de fora.
+func calcDistancia(latVeiculo float64, lonVeiculo float64, idsPontos []int) (map[int]float64, error) {
 	mapDistancias := make(map[int]float64)
 
-	for id := 1; id <= totalPontos; id++ {
+	for _, id := range idsPontos {
 		ponto, erro := dataJson.GetPontoId(id)
 		if erro == 0 {
 			d := distancia.GetDistancia(latVeiculo, lonVeiculo, ponto.Latitude, ponto.Longitude)
 			km := d / 1000
 			mapDistancias[id] = km
-		} else if erro == 2 {
-			return mapDistancias, fmt.Errorf("ponto id (%d) nao localizado", id)
-		} else {
+		} else if erro != 2 {
 			return mapDistancias, fmt.Errorf("Erro ao carregar arquivo json")
 		}
 	}
@@ -556,7 +613,11 @@ func calcDistancia(latVeiculo float64, lonVeiculo float64, totalPontos int) (map
 // ok
 func calcularRankingPontos(logger *logger.Logger, latVeiculo, lonVeiculo float64, connectionStore *store.ConnectionStore) []PontoRanking {
 	// Calcular distâncias
-	mapDistancias, _ := calcDistancia(latVeiculo, lonVeiculo, connectionStore.GetTotalPontosConectados())
+	idsPontos := make([]int, 0, connectionStore.GetTotalPontosConectados())
+	for _, id := range connectionStore.GetPontosMap() {
+		idsPontos = append(idsPontos, id)
+	}
+	mapDistancias, _ := calcDistancia(latVeiculo, lonVeiculo, idsPontos)
 
 	// Consultar tamanho das filas em tempo real
 	mapFilas := consultarDisponibilidadePontos(logger, connectionStore)
@@ -608,56 +669,99 @@ func calcularRankingPontos(logger *logger.Logger, latVeiculo, lonVeiculo float64
 }
 
 // ok
-func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao net.Conn, mensagem dataJson.Mensagem) {
+func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
 
 	switch mensagem.Tipo {
 	case "identificacao":
-		var placa string
-		if strings.Contains(mensagem.Conteudo, "placa") {
-			parts := strings.Split(mensagem.Conteudo, "placa ")
-			if len(parts) > 1 {
-				placa = strings.Split(parts[1], " ")[0]
-				logger.Info(fmt.Sprintf("Novo veículo placa %s conectado: (%s)", placa, conexao.RemoteAddr()))
-
-				if connectionStore.PlacaJaEmUso(placa, conexao) {
-					msgErro := dataJson.Mensagem{
-						Tipo:     "placa-em-uso",
-						Conteudo: "Esta placa já está em uso por outro veículo.",
-						Origem:   "servidor",
-					}
-					dataJson.SendMessage(conexao, msgErro)
-					return
-				}
+		identificacao, protocolo, ok := negociarProtocolo(logger, connectionStore, conexao, mensagem)
+		if !ok {
+			return
+		}
 
-				// Armazenar a placa do veículo
-				connectionStore.AddVeiculo(conexao, placa)
+		// A placa é sempre tratada na forma normalizada
+		if identificacao.Placa != "" {
+			placa, erro := dataJson.NormalizarPlaca(identificacao.Placa)
+			if erro != nil {
+				logger.Info(fmt.Sprintf("Placa %q inválida, identificação recusada: (%s)", identificacao.Placa, conexao.RemoteAddr()))
+				dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+					Motivo: dataJson.MotivoPlacaInvalida,
+				})
+				return
+			}
+			identificacao.Placa = placa
+		}
 
-				// Salvar a placa no JSON de veículos
-				erro := dataJson.SalvarVeiculo(placa)
-				if erro != nil {
-					logger.Erro(fmt.Sprintf("Erro ao salvar dados do veículo: %v", erro))
-				}
-			} else {
-				logger.Info(fmt.Sprintf("Novo veículo conectado: (%s)", conexao.RemoteAddr()))
-				connectionStore.AddVeiculo(conexao, "")
+		aceita := dataJson.IdentificacaoAceita{Versao: protocolo.Versao, Recursos: protocolo.Recursos}
+
+		// Veículo reconectando com o token de uma sessão anterior
+		if identificacao.Sessao != "" && protocolo.TemRecurso(dataJson.RecursoSessao) {
+			if retomarSessao(logger, connectionStore, conexao, mensagem, identificacao, aceita) {
+				return
+			}
+		}
+
+		placa := identificacao.Placa
+		if placa != "" {
+			if connectionStore.PlacaJaEmUso(placa, conexao) {
+				logger.Info(fmt.Sprintf("Placa %s já está em uso, identificação recusada: (%s)", placa, conexao.RemoteAddr()))
+				dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+					Motivo: dataJson.MotivoPlacaEmUso,
+				})
+				return
+			}
+			if !autenticarIdentificacao(logger, connectionStore, veiculos, conexao, mensagem, identificacao) {
+				return
+			}
+			logger.Info(fmt.Sprintf("Novo veículo placa %s conectado: (%s) protocolo v%d", placa, conexao.RemoteAddr(), protocolo.Versao))
+
+			// Armazenar a placa do veículo
+			connectionStore.AddVeiculo(conexao, placa)
+
+			// Salvar a placa no JSON de veículos
+			erro := veiculos.SalvarVeiculo(placa)
+			if erro != nil {
+				logger.Erro(fmt.Sprintf("Erro ao salvar dados do veículo: %v", erro))
+			}
+
+			if protocolo.TemRecurso(dataJson.RecursoSessao) {
+				aceita.Sessao = connectionStore.CriarSessao(conexao, placa)
 			}
 		} else {
-			logger.Info(fmt.Sprintf("Novo veículo conectado: (%s)", conexao.RemoteAddr()))
+			logger.Info(fmt.Sprintf("Novo veículo conectado: (%s) protocolo v%d", conexao.RemoteAddr(), protocolo.Versao))
 			connectionStore.AddVeiculo(conexao, "")
 		}
+		aceitarIdentificacao(logger, connectionStore, conexao, mensagem, aceita)
 
 	case "get-recarga":
-		go processarSolicitacaoRecarga(logger, conexao)
+		go processarSolicitacaoRecarga(logger, conexao, mensagem)
 
 	case "localizacao":
 		go processarLocalizacao(logger, connectionStore, conexao, mensagem)
 
 	case "solicitar-reserva":
+		if !exigirAutenticacao(logger, connectionStore, conexao, mensagem) {
+			return
+		}
 		go processarReserva(logger, connectionStore, conexao, mensagem)
 
 	case "veiculo-chegou":
-		// Veículo informou que chegou ao ponto de recarga
-		placaVeiculo := mensagem.Conteudo
+		if !exigirAutenticacao(logger, connectionStore, conexao, mensagem) {
+			return
+		}
+		// Veículo informou que chegou ao ponto de recarga. A placa é a da
+		// conexão autenticada; a do pedido só é conferida.
+		var chegada dataJson.VeiculoChegou
+		if erro := mensagem.DecodeDados(&chegada); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao ler chegada do veículo: %v", erro))
+			recusarPedido(logger, conexao, mensagem, erro)
+			return
+		}
+		placaVeiculo := connectionStore.GetVeiculoPlaca(conexao)
+		if informada, erro := dataJson.NormalizarPlaca(chegada.Placa); erro != nil || informada != placaVeiculo {
+			logger.Erro(fmt.Sprintf("Chegada informada com placa %q pelo veículo %s", chegada.Placa, placaVeiculo))
+			recusarPedido(logger, conexao, mensagem, &dataJson.ErroValidacao{Campo: "placa", Motivo: dataJson.MotivoPlacaInvalida})
+			return
+		}
 		logger.Info(fmt.Sprintf("Veículo %s informou chegada ao ponto", placaVeiculo))
 
 		// Obter o ID do ponto do mapa de reservas ativas
@@ -667,7 +771,7 @@ func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore
 
 		if !existe {
 			// Fallback: tentar buscar nos registros permanentes
-			_, err := dataJson.ObterUltimoReserva(placaVeiculo)
+			_, err := veiculos.ObterUltimoReserva(placaVeiculo)
 			if err != nil {
 				logger.Erro(fmt.Sprintf("Não foi possível determinar o ponto reservado para o veículo %s: %v", placaVeiculo, err))
 				return
@@ -682,21 +786,30 @@ func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore
 		}
 		logger.Info(fmt.Sprintf("ponto %d conexao recebida %s", pontoID, pontoCon.RemoteAddr()))
 
-		msgPonto := dataJson.Mensagem{
-			Tipo:     "veiculo-chegou",
-			Conteudo: placaVeiculo,
-			Origem:   "servidor",
-		}
-
-		erro := dataJson.SendMessage(pontoCon, msgPonto)
+		erro := dataJson.SendPayload(pontoCon, "veiculo-chegou", "servidor", dataJson.VeiculoChegou{Placa: placaVeiculo})
 		if erro != nil {
 			logger.Erro(fmt.Sprintf("Erro ao notificar ponto %d sobre chegada do veículo: %v", pontoID, erro))
 		} else {
 			logger.Info(fmt.Sprintf("Ponto ID %d notificado sobre a chegada do veículo %s", pontoID, placaVeiculo))
+			RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.RecargaIniciada, Placa: placaVeiculo, PontoID: pontoID})
 		}
 
 	case "verificar-placa":
-		placa := mensagem.Conteudo
+		if !exigirAutenticacao(logger, connectionStore, conexao, mensagem) {
+			return
+		}
+		var verificacao dataJson.VerificarPlaca
+		if erro := mensagem.DecodeDados(&verificacao); erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao ler placa para verificação: %v", erro))
+			recusarPedido(logger, conexao, mensagem, erro)
+			return
+		}
+		placa, erro := dataJson.NormalizarPlaca(verificacao.Placa)
+		if erro != nil {
+			logger.Info(fmt.Sprintf("Placa %q inválida", verificacao.Placa))
+			dataJson.SendReply(conexao, mensagem, "placa-invalida", "servidor", nil)
+			return
+		}
 		logger.Info(fmt.Sprintf("Verificando disponibilidade da placa: %s", placa))
 
 		// Verificar se a placa já está em uso em alguma conexão ativa
@@ -711,58 +824,39 @@ func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore
 		}
 
 		// Enviar resposta
-		var msgResposta dataJson.Mensagem
 		if placaEmUso {
-			msgResposta = dataJson.Mensagem{
-				Tipo:     "placa-indisponivel",
-				Conteudo: "Esta placa já está em uso.",
-				Origem:   "servidor",
-			}
+			dataJson.SendReply(conexao, mensagem, "placa-indisponivel", "servidor", nil)
 		} else {
-			msgResposta = dataJson.Mensagem{
-				Tipo:     "placa-disponivel",
-				Conteudo: "Placa disponível para uso.",
-				Origem:   "servidor",
-			}
+			dataJson.SendReply(conexao, mensagem, "placa-disponivel", "servidor", nil)
 		}
 
-		dataJson.SendMessage(conexao, msgResposta)
-
 	case "consultar-historico":
+		if !exigirAutenticacao(logger, connectionStore, conexao, mensagem) {
+			return
+		}
 		// Veículo está solicitando seu histórico de recargas
 		placa := connectionStore.GetVeiculoPlaca(conexao)
 		logger.Info(fmt.Sprintf("Veículo %s solicitou histórico de recargas", placa))
 
-		// Buscar histórico no arquivo JSON
-		recargas, erro := dataJson.ObterHistoricoRecargas(placa)
-		if erro != nil {
-			logger.Erro(fmt.Sprintf("Erro ao obter histórico de recargas para %s: %v", placa, erro))
-
-			// Enviar mensagem de erro
-			msgErro := dataJson.Mensagem{
-				Tipo:     "historico-erro",
-				Conteudo: "Erro ao buscar histórico de recargas",
-				Origem:   "servidor",
-			}
-			dataJson.SendMessage(conexao, msgErro)
+		// O histórico só é oferecido a clientes que negociaram o recurso
+		if protocolo, _ := connectionStore.GetProtocolo(conexao); !protocolo.TemRecurso(dataJson.RecursoHistorico) {
+			logger.Erro(fmt.Sprintf("Veículo %s não negociou o recurso de histórico", placa))
+			dataJson.SendReply(conexao, mensagem, "historico-erro", "servidor", nil)
 			return
 		}
 
-		// Serializar o histórico para JSON
-		historicoJSON, erro := json.Marshal(recargas)
+		// Buscar histórico no repositório de veículos
+		recargas, erro := veiculos.ObterHistoricoRecargas(placa)
 		if erro != nil {
-			logger.Erro(fmt.Sprintf("Erro ao serializar histórico: %v", erro))
+			logger.Erro(fmt.Sprintf("Erro ao obter histórico de recargas para %s: %v", placa, erro))
+
+			// Enviar mensagem de erro
+			dataJson.SendReply(conexao, mensagem, "historico-erro", "servidor", nil)
 			return
 		}
 
 		// Enviar o histórico ao veículo
-		msgHistorico := dataJson.Mensagem{
-			Tipo:     "historico-recargas",
-			Conteudo: string(historicoJSON),
-			Origem:   "servidor",
-		}
-
-		erro = dataJson.SendMessage(conexao, msgHistorico)
+		erro = dataJson.SendReply(conexao, mensagem, "historico-recargas", "servidor", dataJson.HistoricoRecargas{Recargas: recargas})
 		if erro != nil {
 			logger.Erro(fmt.Sprintf("Erro ao enviar histórico para veículo %s: %v", placa, erro))
 		} else {
@@ -770,53 +864,49 @@ func handleVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore
 		}
 
 	case "limpar-historico":
+		if !exigirAutenticacao(logger, connectionStore, conexao, mensagem) {
+			return
+		}
 		placa := connectionStore.GetVeiculoPlaca(conexao)
 		logger.Info(fmt.Sprintf("Veículo %s solicitou limpeza do histórico de recargas", placa))
 
-		err := dataJson.LimparHistoricoRecargas(placa)
+		if protocolo, _ := connectionStore.GetProtocolo(conexao); !protocolo.TemRecurso(dataJson.RecursoHistorico) {
+			logger.Erro(fmt.Sprintf("Veículo %s não negociou o recurso de histórico", placa))
+			dataJson.SendReply(conexao, mensagem, "erro-pagamento", "servidor", nil)
+			return
+		}
+
+		err := veiculos.PagarRecargas(placa)
 		if err != nil {
-			logger.Erro(fmt.Sprintf("Erro ao limpar histórico de %s: %v", placa, err))
-			dataJson.SendMessage(conexao, dataJson.Mensagem{
-				Tipo:     "erro-pagamento",
-				Conteudo: "Erro ao processar pagamento.",
-				Origem:   "servidor",
-			})
+			logger.Erro(fmt.Sprintf("Erro ao registrar pagamento de %s: %v", placa, err))
+			dataJson.SendReply(conexao, mensagem, "erro-pagamento", "servidor", nil)
 			return
 		}
 
-		dataJson.SendMessage(conexao, dataJson.Mensagem{
-			Tipo:     "pagamento-confirmado",
-			Conteudo: "Histórico de recargas limpo com sucesso.",
-			Origem:   "servidor",
-		})
+		RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.PagamentoEfetuado, Placa: placa})
+		dataJson.SendReply(conexao, mensagem, "pagamento-confirmado", "servidor", nil)
 
 	default:
 		logger.Erro(fmt.Sprintf("Tipo de solicitacao ainda nao foi mapeada - %s", mensagem.Tipo))
+		recusarPedido(logger, conexao, mensagem, &dataJson.ErroValidacao{Campo: "tipo", Motivo: dataJson.MotivoTipoDesconhecido})
 	}
 }
 
 // ok
-func processarSolicitacaoRecarga(logger *logger.Logger, conexao net.Conn) {
-	solicitacao := dataJson.Mensagem{
-		Tipo:     "get-localizacao",
-		Conteudo: "Ola Veiculo! Informe sua localizacao atual.",
-		Origem:   "servidor",
-	}
-
-	// Enviar solicitação de localização
-	erro := dataJson.SendMessage(conexao, solicitacao)
+func processarSolicitacaoRecarga(logger *logger.Logger, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
+	dadosRegiao, erro := dataJson.RegiaoPublica()
 	if erro != nil {
-		logger.Erro(fmt.Sprintf("Erro ao solicitar localizacao ao veiculo: %v", erro))
+		logger.Erro(fmt.Sprintf("Erro ao carregar dados da regiao do JSON: %v", erro))
 		return
 	}
 
-	// Enviar dados da região
-	erro = dataJson.SendDadosRegiao(conexao)
+	// Solicitar a localização enviando os dados da região em resposta ao pedido
+	erro = dataJson.SendReply(conexao, mensagem, "get-localizacao", "servidor", dadosRegiao)
 	if erro != nil {
 		if strings.Contains(erro.Error(), "broken pipe") {
 			logger.Erro(fmt.Sprintf("Veiculo desconectado durante comunicacao: %v", erro))
 		} else {
-			logger.Erro(fmt.Sprintf("Erro ao enviar dados da regiao: %v", erro))
+			logger.Erro(fmt.Sprintf("Erro ao solicitar localizacao ao veiculo: %v", erro))
 		}
 		return
 	}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+// As respostas que o servidor não aguarda são descartadas sem erro no log
+func TestRespostasDoPontoNaoAguardadas(t *testing.T) {
+	var saida bytes.Buffer
+	logger := logger.NewLogger(&saida)
+	connectionStore := store.NewConnectionStore()
+	ponto := conexaoIdentificada(t, connectionStore, "ponto-de-recarga")
+
+	for _, tipo := range []string{"disponibilidade", "status-fila", "fila-ponto"} {
+		mensagem, erro := dataJson.NewMensagem(tipo, "ponto-de-recarga", map[string]any{})
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		mensagem.ReplyTo = 42
+		handlePontoDeRecarga(logger, connectionStore, repositorio.NewRepositorioMemoria(), ponto, mensagem)
+	}
+	if strings.Contains(saida.String(), "ERRO") {
+		t.Fatalf("resposta nao aguardada registrada como erro:\n%s", saida.String())
+	}
+}
+
+// Um ponto não encerra a recarga de um veículo que reservou outro ponto
+func TestRecargaFinalizadaDeOutroPonto(t *testing.T) {
+	veiculos := repositorio.NewRepositorioMemoria()
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+	servidor, cliente := net.Pipe()
+	t.Cleanup(func() {
+		servidor.Close()
+		cliente.Close()
+	})
+	ponto := dataJson.NewConn(servidor)
+	connectionStore.AddPontoRecargaComID(ponto, 1)
+	if erro := veiculos.SalvarVeiculo("ABC1234"); erro != nil {
+		t.Fatal(erro)
+	}
+
+	reservasMutex.Lock()
+	reservasAtivas["ABC1234"] = 2
+	reservasMutex.Unlock()
+	t.Cleanup(func() {
+		reservasMutex.Lock()
+		delete(reservasAtivas, "ABC1234")
+		reservasMutex.Unlock()
+	})
+
+	recebida := make(chan dataJson.Mensagem, 1)
+	go func() {
+		mensagem, erro := dataJson.ReceiveMessage(dataJson.NewConn(cliente))
+		if erro == nil {
+			recebida <- mensagem
+		}
+	}()
+	mensagem, erro := dataJson.NewMensagem("recarga-finalizada", "ponto-de-recarga", dataJson.RecargaFinalizada{Placa: "ABC1234", PontoID: 2, ConsumoKwh: 20, Valor: 30})
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	handlePontoDeRecarga(logger, connectionStore, veiculos, ponto, mensagem)
+
+	select {
+	case resposta := <-recebida:
+		var pedido dataJson.PedidoInvalido
+		if resposta.Tipo != "pedido-invalido" || resposta.DecodeDados(&pedido) != nil || pedido.Motivo != dataJson.MotivoSemReserva {
+			t.Fatalf("resposta ao ponto: %+v", resposta)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("recarga de outro ponto nao recusada")
+	}
+	if pontoID, _ := ReservaAtiva("ABC1234"); pontoID != 2 {
+		t.Fatalf("reserva no ponto 2 alterada: %d", pontoID)
+	}
+	if recargas, _ := veiculos.ObterHistoricoRecargas("ABC1234"); len(recargas) != 0 {
+		t.Fatalf("recarga registrada: %v", recargas)
+	}
+}
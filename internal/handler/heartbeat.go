@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"strconv"
+	"time"
+)
+
+// Variaveis de ambiente do heartbeat
+const (
+	EnvIntervaloHeartbeat = "HEARTBEAT_INTERVALO" // duracao, por exemplo "10s"
+	EnvFalhasHeartbeat    = "HEARTBEAT_FALHAS"    // pings sem resposta antes da remocao
+)
+
+type ConfigHeartbeat struct {
+	Intervalo time.Duration
+	Falhas    int
+}
+
+func ConfigHeartbeatPadrao() ConfigHeartbeat {
+	return ConfigHeartbeat{Intervalo: 10 * time.Second, Falhas: 3}
+}
+
+// Le a configuracao do heartbeat do ambiente, usando o padrao para variaveis ausentes
+func ConfigHeartbeatDoAmbiente() (ConfigHeartbeat, error) {
+	config := ConfigHeartbeatPadrao()
+	if valor := os.Getenv(EnvIntervaloHeartbeat); valor != "" {
+		intervalo, erro := time.ParseDuration(valor)
+		if erro != nil || intervalo <= 0 {
+			return config, fmt.Errorf("%s invalido: %q", EnvIntervaloHeartbeat, valor)
+		}
+		config.Intervalo = intervalo
+	}
+	if valor := os.Getenv(EnvFalhasHeartbeat); valor != "" {
+		falhas, erro := strconv.Atoi(valor)
+		if erro != nil || falhas <= 0 {
+			return config, fmt.Errorf("%s invalido: %q", EnvFalhasHeartbeat, valor)
+		}
+		config.Falhas = falhas
+	}
+	return config, nil
+}
+
+// Envia "ping" periodicamente as conexoes que negociaram o heartbeat e remove
+// as que ficaram sem dar sinal de vida por mais de Falhas intervalos.
+// Qualquer mensagem recebida conta como contato.
+func MonitorarConexoes(logger *logger.Logger, connectionStore *store.ConnectionStore, config ConfigHeartbeat) {
+	limite := config.Intervalo * time.Duration(config.Falhas)
+	ticker := time.NewTicker(config.Intervalo)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		agora := time.Now()
+		for conexao, ultimoContato := range connectionStore.GetUltimosContatos() {
+			protocolo, identificada := connectionStore.GetProtocolo(conexao)
+			if !identificada || !protocolo.TemRecurso(dataJson.RecursoHeartbeat) {
+				continue
+			}
+
+			if agora.Sub(ultimoContato) > limite {
+				logger.Erro(fmt.Sprintf("Conexao %s sem resposta desde %s -> desconectada",
+					conexao.RemoteAddr(), ultimoContato.Format("15:04:05")))
+				connectionStore.RemoveConnection(conexao)
+				continue
+			}
+
+			// O envio nao pode travar o monitor caso a conexao esteja parada
+			go func(conexao *dataJson.Conn) {
+				erro := dataJson.SendPayload(conexao, "ping", "servidor", nil)
+				if erro != nil {
+					logger.Erro(fmt.Sprintf("Erro ao enviar ping para %s: %v", conexao.RemoteAddr(), erro))
+				}
+			}(conexao)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Variaveis de ambiente dos limites de taxa
+const (
+	// Lista "tipo=quantidade/duracao" separada por virgulas, por exemplo
+	// "localizacao=3/15s,*=20/1s"; "*" vale para os tipos nao listados
+	EnvLimiteMensagens = "LIMITE_MENSAGENS"
+	// Mensagens recusadas por minuto toleradas antes da desconexao
+	EnvLimiteInfracoes = "LIMITE_INFRACOES"
+)
+
+type ConfigLimites struct {
+	Padrao    store.RegraLimite
+	PorTipo   map[string]store.RegraLimite
+	Infracoes int
+}
+
+// Consultas que disparam a consulta a todos os pontos têm limites mais baixos
+func ConfigLimitesPadrao() ConfigLimites {
+	return ConfigLimites{
+		Padrao: store.RegraLimite{Taxa: 20, Rajada: 20},
+		PorTipo: map[string]store.RegraLimite{
+			"identificacao":     regraPorJanela(5, 30*time.Second),
+			"get-recarga":       regraPorJanela(3, 15*time.Second),
+			"localizacao":       regraPorJanela(3, 15*time.Second),
+			"solicitar-reserva": regraPorJanela(5, 30*time.Second),
+			"verificar-placa":   regraPorJanela(5, 30*time.Second),
+		},
+		Infracoes: 10,
+	}
+}
+
+// Até quantidade mensagens seguidas, repostas ao longo da janela
+func regraPorJanela(quantidade int, janela time.Duration) store.RegraLimite {
+	return store.RegraLimite{Taxa: float64(quantidade) / janela.Seconds(), Rajada: quantidade}
+}
+
+// Le os limites do ambiente. Os tipos informados em LIMITE_MENSAGENS
+// substituem os do padrao; os demais continuam valendo.
+func ConfigLimitesDoAmbiente() (ConfigLimites, error) {
+	config := ConfigLimitesPadrao()
+	if valor := os.Getenv(EnvLimiteMensagens); valor != "" {
+		for _, item := range strings.Split(valor, ",") {
+			tipo, regra, ok := strings.Cut(strings.TrimSpace(item), "=")
+			quantidadeTexto, janelaTexto, okRegra := strings.Cut(regra, "/")
+			quantidade, erroQuantidade := strconv.Atoi(quantidadeTexto)
+			janela, erroJanela := time.ParseDuration(janelaTexto)
+			if !ok || !okRegra || tipo == "" || erroQuantidade != nil || quantidade <= 0 || erroJanela != nil || janela <= 0 {
+				return config, fmt.Errorf("%s invalido: %q", EnvLimiteMensagens, item)
+			}
+			if tipo == "*" {
+				config.Padrao = regraPorJanela(quantidade, janela)
+			} else {
+				config.PorTipo[tipo] = regraPorJanela(quantidade, janela)
+			}
+		}
+	}
+	if valor := os.Getenv(EnvLimiteInfracoes); valor != "" {
+		infracoes, erro := strconv.Atoi(valor)
+		if erro != nil || infracoes <= 0 {
+			return config, fmt.Errorf("%s invalido: %q", EnvLimiteInfracoes, valor)
+		}
+		config.Infracoes = infracoes
+	}
+	return config, nil
+}
+
+// Regra em vigor para o tipo de mensagem, aplicada também às rotas da API HTTP
+func RegraDoTipo(tipo string) store.RegraLimite {
+	return configLimites.regra(tipo)
+}
+
+func (config ConfigLimites) regra(tipo string) store.RegraLimite {
+	if regra, existe := config.PorTipo[tipo]; existe {
+		return regra
+	}
+	return config.Padrao
+}
+
+var configLimites = ConfigLimitesPadrao()
+
+// Define os limites aplicados às mensagens recebidas
+func ConfigurarLimites(config ConfigLimites) {
+	configLimites = config
+}
+
+// Aplica o limite do tipo da mensagem à conexão e à placa do veículo. Mensagens
+// acima do limite recebem limite-excedido; quem esgota as infrações toleradas
+// é desconectado. Retorna false se a mensagem não deve ser processada.
+func verificarLimite(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) bool {
+	// Mensagens dos pontos já identificados não são limitadas: a consulta de
+	// disponibilidade a todos os pontos a cada localização faria o servidor
+	// derrubar os seus pontos. As respostas aguardadas pelo servidor já foram
+	// entregues antes daqui, então um reply_to não isenta ninguém
+	if connectionStore.GetIdPonto(conexao) != 0 {
+		return true
+	}
+
+	// Sem autenticação a placa é apenas o endereço da conexão, e não ganha
+	// baldes próprios
+	placa := ""
+	if connectionStore.VeiculoAutenticado(conexao) {
+		placa = connectionStore.GetVeiculoPlaca(conexao)
+	}
+	espera, permitido := connectionStore.ConsumirLimite(conexao, placa, mensagem.Tipo, configLimites.regra(mensagem.Tipo))
+	if permitido {
+		return true
+	}
+
+	tolerancia := regraPorJanela(configLimites.Infracoes, time.Minute)
+	if connectionStore.RegistrarExcesso(conexao, tolerancia) {
+		logger.Erro(fmt.Sprintf("Conexao %s (%s) excedeu o limite de mensagens repetidamente -> desconectada", conexao.RemoteAddr(), connectionStore.GetVeiculoPlaca(conexao)))
+		connectionStore.RemoveConnection(conexao)
+		return false
+	}
+
+	logger.Erro(fmt.Sprintf("Limite de %s excedido por %s (%s)", mensagem.Tipo, conexao.RemoteAddr(), connectionStore.GetVeiculoPlaca(conexao)))
+	erro := dataJson.SendReply(conexao, mensagem, "limite-excedido", "servidor", dataJson.LimiteExcedido{
+		Tipo:       mensagem.Tipo,
+		TentarEmMs: espera.Milliseconds(),
+	})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao avisar limite excedido a %s: %v", conexao.RemoteAddr(), erro))
+	}
+	return false
+}
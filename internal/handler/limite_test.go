@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"io"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"testing"
+	"time"
+)
+
+func TestLimiteDeMensagens(t *testing.T) {
+	anterior := configLimites
+	t.Cleanup(func() { ConfigurarLimites(anterior) })
+	ConfigurarLimites(ConfigLimites{Padrao: regraPorJanela(2, time.Minute), Infracoes: 2})
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+
+	// Os pontos respondem a cada consulta do servidor e não são limitados
+	ponto := conexaoIdentificada(t, connectionStore, "ponto-de-recarga")
+	for i := range 50 {
+		if !verificarLimite(logger, connectionStore, ponto, dataJson.Mensagem{Tipo: "status-fila", Origem: "ponto-de-recarga"}) {
+			t.Fatalf("mensagem %d do ponto limitada", i)
+		}
+	}
+
+	veiculo, _ := conexaoEmMemoria(t)
+	connectionStore.AddVeiculo(veiculo, "")
+	esperados := []bool{true, true, false, false, false}
+	for i, esperado := range esperados {
+		if permitido := verificarLimite(logger, connectionStore, veiculo, dataJson.Mensagem{Tipo: "localizacao", Origem: "veiculo"}); permitido != esperado {
+			t.Fatalf("mensagem %d do veiculo: permitida %v, esperado %v", i, permitido, esperado)
+		}
+	}
+	// Esgotadas as infrações toleradas, a conexão é encerrada
+	if connectionStore.GetVeiculoPlaca(veiculo) != "" {
+		t.Fatal("veiculo acima do limite nao foi desconectado")
+	}
+	if connectionStore.GetIdPonto(ponto) != 1 {
+		t.Fatal("ponto desconectado pelo limite")
+	}
+}
+
+func TestLimiteIgnoraReplyToDoVeiculo(t *testing.T) {
+	anterior := configLimites
+	t.Cleanup(func() { ConfigurarLimites(anterior) })
+	ConfigurarLimites(ConfigLimites{Padrao: regraPorJanela(2, time.Minute), Infracoes: 2})
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+
+	// Um reply_to sem pedido correspondente não livra a localização do limite
+	veiculo := conexaoIdentificada(t, connectionStore, "veiculo")
+	permitidas := 0
+	for i := 0; i < 50 && connectionStore.GetVeiculoPlaca(veiculo) != ""; i++ {
+		mensagem := dataJson.Mensagem{ID: uint64(i + 1), ReplyTo: uint64(i + 1), Tipo: "localizacao", Origem: "veiculo"}
+		if verificarLimite(logger, connectionStore, veiculo, mensagem) {
+			permitidas++
+		}
+	}
+	if permitidas != 2 {
+		t.Fatalf("%d localizacoes com reply_to permitidas, esperado 2", permitidas)
+	}
+	if connectionStore.GetVeiculoPlaca(veiculo) != "" {
+		t.Fatal("veiculo inundando localizacao com reply_to nao foi desconectado")
+	}
+}
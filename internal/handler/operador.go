@@ -0,0 +1,409 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/auditoria"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mesmo limite do campo operador da identificação
+const tamanhoMaximoNomeOperador = 64
+
+// Variavel de ambiente com os operadores aceitos: lista "nome=sha256" separada
+// por virgulas, com o SHA-256 (hex) da credencial de cada operador, por exemplo
+// "ana=5e88...,bruno=9f86...". Sem ela, conexões de operador são recusadas.
+const EnvOperadores = "OPERADORES"
+
+// Credencial compartilhada por todos os operadores nas versões anteriores
+const envCredencialOperadorAntiga = "OPERADOR_CREDENCIAL_SHA256"
+
+var configOperador struct {
+	credenciais map[string]string // nome do operador -> SHA-256 da credencial
+	auditoria   *auditoria.Auditoria
+}
+
+// Define os operadores aceitos, cada um com o hash da sua credencial, e o log
+// onde cada ação é registrada
+func ConfigurarOperador(credenciais map[string]string, auditoria *auditoria.Auditoria) {
+	configOperador.credenciais = credenciais
+	configOperador.auditoria = auditoria
+}
+
+// Le os operadores de OPERADORES. A antiga credencial compartilhada não é
+// mais aceita, já que a auditoria não teria como distinguir os operadores.
+func OperadoresDoAmbiente() (map[string]string, error) {
+	credenciais := make(map[string]string)
+	valor := os.Getenv(EnvOperadores)
+	if valor == "" {
+		if os.Getenv(envCredencialOperadorAntiga) != "" {
+			return credenciais, fmt.Errorf("%s foi substituida por %s, com uma credencial por operador", envCredencialOperadorAntiga, EnvOperadores)
+		}
+		return credenciais, nil
+	}
+	for _, item := range strings.Split(valor, ",") {
+		nome, hash, ok := strings.Cut(strings.TrimSpace(item), "=")
+		_, erroHash := hex.DecodeString(hash)
+		if !ok || nome == "" || len(nome) > tamanhoMaximoNomeOperador || len(hash) != 2*sha256.Size || erroHash != nil {
+			return credenciais, fmt.Errorf("%s invalido: %q", EnvOperadores, nome)
+		}
+		if _, repetido := credenciais[nome]; repetido {
+			return credenciais, fmt.Errorf("%s invalido: operador %q repetido", EnvOperadores, nome)
+		}
+		credenciais[nome] = hash
+	}
+	return credenciais, nil
+}
+
+// Registra a ação do operador na auditoria
+func auditar(logger *logger.Logger, conexao *dataJson.Conn, operador string, acao string, alvo string, resultado string) {
+	AuditarOperador(logger, operador, conexao.RemoteAddr().String(), acao, alvo, resultado)
+}
+
+// Registra na auditoria uma ação de operador feita fora do protocolo TCP,
+// como as rotas de administração da API HTTP
+func AuditarOperador(logger *logger.Logger, operador string, endereco string, acao string, alvo string, resultado string) {
+	logger.Info(fmt.Sprintf("Auditoria: operador %q (%s) %s %s -> %s", operador, endereco, acao, alvo, resultado))
+	if configOperador.auditoria == nil {
+		return
+	}
+	erro := configOperador.auditoria.Registrar(auditoria.Registro{
+		Operador:  operador,
+		Endereco:  endereco,
+		Acao:      acao,
+		Alvo:      alvo,
+		Resultado: resultado,
+	})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao gravar auditoria: %v", erro))
+	}
+}
+
+// Confere a credencial com a cadastrada para o operador. Retorna o motivo da
+// recusa, ou "" se ela for aceita; só então o nome pode ir para a auditoria
+// como o do operador.
+func ConferirCredencialOperador(operador string, credencial string) string {
+	if len(configOperador.credenciais) == 0 {
+		return dataJson.MotivoOperadorDesabilitado
+	}
+	// Um operador desconhecido tem hash vazio, que não aceita nenhuma credencial
+	if !dataJson.ConfereCredencial(configOperador.credenciais[operador], credencial) {
+		return dataJson.MotivoCredencialInvalida
+	}
+	return ""
+}
+
+func handleOperador(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
+	if mensagem.Tipo == "identificacao" {
+		identificarOperador(logger, connectionStore, conexao, mensagem)
+		return
+	}
+
+	operador, autenticado := connectionStore.GetOperador(conexao)
+	if !autenticado {
+		logger.Erro(fmt.Sprintf("Mensagem %s de operador não autenticado: %s", mensagem.Tipo, conexao.RemoteAddr()))
+		dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{
+			Motivo: dataJson.MotivoAutenticacaoPendente,
+		})
+		return
+	}
+
+	var alvo, tipoResposta string
+	var resposta any
+	switch mensagem.Tipo {
+	case "listar-conexoes":
+		tipoResposta, resposta = "lista-conexoes", listarConexoes(connectionStore)
+	case "consultar-fila":
+		alvo, tipoResposta, resposta = consultarFila(logger, connectionStore, mensagem)
+	case "editar-fila":
+		alvo, tipoResposta, resposta = editarFila(logger, connectionStore, mensagem)
+	case "forcar-liberacao":
+		alvo, tipoResposta, resposta = forcarLiberacao(logger, connectionStore, mensagem)
+	case "cancelar-reserva":
+		alvo, tipoResposta, resposta = cancelarReservaOperador(logger, connectionStore, mensagem)
+	case "desconectar-cliente":
+		alvo, tipoResposta, resposta = desconectarCliente(logger, connectionStore, mensagem)
+	case "cadastrar-senha":
+		alvo, tipoResposta, resposta = cadastrarSenhaOperador(logger, connectionStore, veiculos, mensagem)
+	case "compactar-diario":
+		tipoResposta, resposta = compactarDiario(logger)
+	default:
+		logger.Erro(fmt.Sprintf("Tipo de solicitacao de operador ainda nao foi mapeada - %s", mensagem.Tipo))
+		tipoResposta, resposta = "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+
+	resultado := "ok"
+	if falha, falhou := resposta.(dataJson.OperacaoFalhou); falhou {
+		resultado = falha.Motivo
+	}
+	auditar(logger, conexao, operador, mensagem.Tipo, alvo, resultado)
+
+	erro := dataJson.SendReply(conexao, mensagem, tipoResposta, "servidor", resposta)
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao responder operador %s: %v", operador, erro))
+	}
+}
+
+// Confere a credencial do operador. Falhas são auditadas e encerram a conexão.
+func identificarOperador(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem) {
+	identificacao, protocolo, ok := negociarProtocolo(logger, connectionStore, conexao, mensagem)
+	if !ok {
+		return
+	}
+	operador := identificacao.Operador
+
+	if motivo := ConferirCredencialOperador(operador, identificacao.Credencial); motivo != "" {
+		auditar(logger, conexao, operador, "identificacao", "", motivo)
+		dataJson.SendReply(conexao, mensagem, "identificacao-recusada", "servidor", dataJson.IdentificacaoRecusada{Motivo: motivo})
+		connectionStore.RemoveConnection(conexao)
+		return
+	}
+
+	connectionStore.AddOperador(conexao, operador)
+	aceitarIdentificacao(logger, connectionStore, conexao, mensagem, dataJson.IdentificacaoAceita{
+		Versao:   protocolo.Versao,
+		Recursos: protocolo.Recursos,
+	})
+	auditar(logger, conexao, operador, "identificacao", "", "ok")
+}
+
+func listarConexoes(connectionStore *store.ConnectionStore) dataJson.ListaConexoes {
+	lista := dataJson.ListaConexoes{Pontos: []dataJson.ConexaoPonto{}, Veiculos: []dataJson.ConexaoVeiculo{}}
+	for conexao, id := range connectionStore.GetPontosMap() {
+		lista.Pontos = append(lista.Pontos, dataJson.ConexaoPonto{ID: id, Endereco: conexao.RemoteAddr().String()})
+	}
+	for conexao, placa := range connectionStore.GetVeiculosMap() {
+		pontoReservado, _ := ReservaAtiva(placa)
+		lista.Veiculos = append(lista.Veiculos, dataJson.ConexaoVeiculo{
+			Placa:          placa,
+			Endereco:       conexao.RemoteAddr().String(),
+			PontoReservado: pontoReservado,
+		})
+	}
+	sort.Slice(lista.Pontos, func(i, j int) bool { return lista.Pontos[i].ID < lista.Pontos[j].ID })
+	sort.Slice(lista.Veiculos, func(i, j int) bool { return lista.Veiculos[i].Placa < lista.Veiculos[j].Placa })
+	return lista
+}
+
+// Pede ao ponto a sua fila atual, que só ele conhece na ordem de atendimento
+func filaDoPonto(logger *logger.Logger, connectionStore *store.ConnectionStore, pontoID int) (*dataJson.Conn, []string, string) {
+	pontoCon := connectionStore.GetConexaoPorID(pontoID)
+	if pontoCon == nil {
+		return nil, nil, dataJson.MotivoPontoNaoEncontrado
+	}
+	resposta, erro := requisitar(pontoCon, "consultar-fila", dataJson.PedidoFila{PontoID: pontoID})
+	var fila dataJson.FilaPonto
+	if erro == nil {
+		erro = resposta.DecodeDados(&fila)
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao consultar fila do ponto ID %d: %v", pontoID, erro))
+		return nil, nil, dataJson.MotivoFalhaComunicacao
+	}
+	return pontoCon, fila.Placas, ""
+}
+
+func consultarFila(logger *logger.Logger, connectionStore *store.ConnectionStore, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.PedidoFila
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	alvo := fmt.Sprintf("ponto %d", pedido.PontoID)
+
+	_, placas, motivo := filaDoPonto(logger, connectionStore, pedido.PontoID)
+	if motivo != "" {
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: motivo}
+	}
+	return alvo, "fila-ponto", dataJson.FilaPonto{PontoID: pedido.PontoID, Placas: placas}
+}
+
+// Reordena ou retira veículos da fila do ponto. Veículos retirados têm a
+// reserva cancelada; placas que não estão na fila atual são recusadas.
+func editarFila(logger *logger.Logger, connectionStore *store.ConnectionStore, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.PedidoFila
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	alvo := fmt.Sprintf("ponto %d: %v", pedido.PontoID, pedido.Placas)
+
+	pontoCon, atual, motivo := filaDoPonto(logger, connectionStore, pedido.PontoID)
+	if motivo != "" {
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: motivo}
+	}
+
+	novaFila := make([]string, 0, len(pedido.Placas))
+	for _, placa := range pedido.Placas {
+		normalizada, erro := dataJson.NormalizarPlaca(placa)
+		if erro != nil || !slices.Contains(atual, normalizada) || slices.Contains(novaFila, normalizada) {
+			return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoFilaDivergente}
+		}
+		novaFila = append(novaFila, normalizada)
+	}
+
+	for _, placa := range atual {
+		if !slices.Contains(novaFila, placa) {
+			retirarDaFila(logger, connectionStore, pontoCon, pedido.PontoID, placa)
+		}
+	}
+
+	erro := dataJson.SendPayload(pontoCon, "fila-atualizada", "servidor", dataJson.Fila{Placas: novaFila})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao enviar nova fila ao ponto ID %d: %v", pedido.PontoID, erro))
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoFalhaComunicacao}
+	}
+	RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.FilaAlterada, PontoID: pedido.PontoID, Placas: novaFila})
+	return alvo, "operacao-concluida", nil
+}
+
+// Esvazia a fila do ponto, cancelando as reservas, e o sinaliza para seguir
+func forcarLiberacao(logger *logger.Logger, connectionStore *store.ConnectionStore, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.ForcarLiberacao
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	alvo := fmt.Sprintf("ponto %d", pedido.PontoID)
+
+	pontoCon, atual, motivo := filaDoPonto(logger, connectionStore, pedido.PontoID)
+	if motivo != "" {
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: motivo}
+	}
+
+	// Reservas registradas no servidor que o ponto não conhece também são liberadas
+	reservasMutex.Lock()
+	for placa, pontoID := range reservasAtivas {
+		if pontoID == pedido.PontoID && !slices.Contains(atual, placa) {
+			atual = append(atual, placa)
+		}
+	}
+	reservasMutex.Unlock()
+
+	for _, placa := range atual {
+		retirarDaFila(logger, connectionStore, pontoCon, pedido.PontoID, placa)
+	}
+
+	erro := dataJson.SendPayload(pontoCon, "fila-atualizada", "servidor", dataJson.Fila{Placas: []string{}})
+	if erro == nil {
+		erro = dataJson.SendPayload(pontoCon, "liberar-ponto", "servidor", nil)
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao liberar ponto ID %d: %v", pedido.PontoID, erro))
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoFalhaComunicacao}
+	}
+	RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.FilaAlterada, PontoID: pedido.PontoID})
+	return alvo, "operacao-concluida", nil
+}
+
+// Retira o veículo da fila do ponto, cancelando a reserva e avisando o veículo
+func retirarDaFila(logger *logger.Logger, connectionStore *store.ConnectionStore, pontoCon *dataJson.Conn, pontoID int, placa string) {
+	if reservado, existe := ReservaAtiva(placa); existe && reservado == pontoID {
+		CancelarReserva(logger, connectionStore, placa)
+		avisarCancelamento(logger, connectionStore, placa, pontoID)
+		return
+	}
+	// Sem reserva no servidor, basta retirar o veículo da fila do ponto
+	erro := dataJson.SendPayload(pontoCon, "cancelar-reserva", "servidor", dataJson.CancelarReserva{Placa: placa})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao retirar %s da fila do ponto ID %d: %v", placa, pontoID, erro))
+	}
+}
+
+func avisarCancelamento(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string, pontoID int) {
+	erro := notificarVeiculo(logger, connectionStore, placa, "reserva-cancelada", dataJson.ReservaCancelada{PontoID: pontoID})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao avisar veículo %s sobre o cancelamento da reserva: %v", placa, erro))
+	}
+}
+
+func cancelarReservaOperador(logger *logger.Logger, connectionStore *store.ConnectionStore, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.CancelarReserva
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	placa, erro := dataJson.NormalizarPlaca(pedido.Placa)
+	if erro != nil {
+		return pedido.Placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPlacaInvalida}
+	}
+
+	pontoID, erro := CancelarReserva(logger, connectionStore, placa)
+	if errors.Is(erro, ErrSemReserva) {
+		return placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoSemReserva}
+	}
+	avisarCancelamento(logger, connectionStore, placa, pontoID)
+	return placa, "operacao-concluida", nil
+}
+
+// Cadastra a senha de um veículo que ainda não tem senha, como as placas
+// gravadas antes das senhas, que não podem se cadastrar no primeiro acesso.
+// A auditoria registra só a placa.
+func cadastrarSenhaOperador(logger *logger.Logger, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.CadastrarSenha
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	placa, erro := dataJson.NormalizarPlaca(pedido.Placa)
+	if erro != nil {
+		return pedido.Placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPlacaInvalida}
+	}
+	hash, erro := dataJson.NovaSenhaVeiculo(pedido.Senha)
+	if erro != nil {
+		return placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoSenhaInvalida}
+	}
+
+	erro = veiculos.CadastrarSenhaVeiculo(placa, hash)
+	if errors.Is(erro, dataJson.ErrSenhaJaCadastrada) {
+		return placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoSenhaJaCadastrada}
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao cadastrar senha do veículo %s: %v", placa, erro))
+		return placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoFalhaCadastro}
+	}
+	logger.Info(fmt.Sprintf("Senha do veículo %s cadastrada pelo operador", placa))
+	RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.VeiculoCadastrado, Placa: placa})
+	return placa, "operacao-concluida", nil
+}
+
+// Encerra a conexão de um ponto ou veículo com a mesma limpeza de uma desconexão
+func desconectarCliente(logger *logger.Logger, connectionStore *store.ConnectionStore, mensagem dataJson.Mensagem) (string, string, any) {
+	var pedido dataJson.DesconectarCliente
+	if erro := mensagem.DecodeDados(&pedido); erro != nil {
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+
+	var alvo string
+	var conexao *dataJson.Conn
+	motivo := ""
+	switch {
+	case pedido.PontoID != 0:
+		alvo = "ponto " + strconv.Itoa(pedido.PontoID)
+		conexao = connectionStore.GetConexaoPorID(pedido.PontoID)
+		motivo = dataJson.MotivoPontoNaoEncontrado
+	case pedido.Placa != "":
+		placa, erro := dataJson.NormalizarPlaca(pedido.Placa)
+		if erro != nil {
+			return pedido.Placa, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPlacaInvalida}
+		}
+		alvo = "veiculo " + placa
+		conexao = connectionStore.GetConexaoPorPlaca(placa)
+		motivo = dataJson.MotivoVeiculoNaoEncontrado
+	default:
+		return "", "operacao-falhou", dataJson.OperacaoFalhou{Motivo: dataJson.MotivoPedidoInvalido}
+	}
+	if conexao == nil {
+		return alvo, "operacao-falhou", dataJson.OperacaoFalhou{Motivo: motivo}
+	}
+
+	logger.Info(fmt.Sprintf("Operador desconectou %s: (%s)", alvo, conexao.RemoteAddr()))
+	connectionStore.RemoveConnection(conexao)
+	return alvo, "operacao-concluida", nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"strings"
+	"testing"
+)
+
+func hashCredencial(credencial string) string {
+	hash := sha256.Sum256([]byte(credencial))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestOperadoresDoAmbiente(t *testing.T) {
+	ana, bruno := hashCredencial("senha-da-ana"), hashCredencial("senha-do-bruno")
+	casos := []struct {
+		operadores string
+		antiga     string
+		esperados  map[string]string // nil se a configuração deve ser recusada
+	}{
+		{"", "", map[string]string{}},
+		{"ana=" + ana, "", map[string]string{"ana": ana}},
+		{" ana=" + ana + ", bruno=" + bruno, "", map[string]string{"ana": ana, "bruno": bruno}},
+		{"ana=" + ana + ",ana=" + bruno, "", nil},
+		{"ana", "", nil},
+		{"=" + ana, "", nil},
+		{"ana=" + ana[:10], "", nil},
+		{"ana=" + strings.Repeat("z", 64), "", nil},
+		{"ana=" + ana + ",", "", nil},
+		// A credencial compartilhada não é mais aceita
+		{"", ana, nil},
+		{"bruno=" + bruno, ana, map[string]string{"bruno": bruno}},
+	}
+	for _, caso := range casos {
+		t.Setenv(EnvOperadores, caso.operadores)
+		t.Setenv(envCredencialOperadorAntiga, caso.antiga)
+		operadores, erro := OperadoresDoAmbiente()
+		if caso.esperados == nil {
+			if erro == nil {
+				t.Errorf("OPERADORES=%q aceito: %v", caso.operadores, operadores)
+			}
+			continue
+		}
+		if erro != nil || len(operadores) != len(caso.esperados) {
+			t.Errorf("OPERADORES=%q: %v %v", caso.operadores, operadores, erro)
+			continue
+		}
+		for nome, hash := range caso.esperados {
+			if operadores[nome] != hash {
+				t.Errorf("OPERADORES=%q: hash de %s %q", caso.operadores, nome, operadores[nome])
+			}
+		}
+	}
+}
+
+// Cada operador só entra com a própria credencial, e a conexão fica
+// registrada com o nome conferido
+func TestCredencialPorOperador(t *testing.T) {
+	t.Cleanup(func() { ConfigurarOperador(nil, nil) })
+	ConfigurarOperador(nil, nil)
+	if motivo := ConferirCredencialOperador("ana", "senha-da-ana"); motivo != dataJson.MotivoOperadorDesabilitado {
+		t.Fatalf("operador aceito sem OPERADORES: %q", motivo)
+	}
+
+	ConfigurarOperador(map[string]string{
+		"ana":   hashCredencial("senha-da-ana"),
+		"bruno": hashCredencial("senha-do-bruno"),
+	}, nil)
+	logger := logger.NewLogger(io.Discard)
+	casos := []struct {
+		operador   string
+		credencial string
+		motivo     string
+	}{
+		{"ana", "senha-da-ana", ""},
+		{"bruno", "senha-do-bruno", ""},
+		{"ana", "senha-do-bruno", dataJson.MotivoCredencialInvalida},
+		{"carla", "senha-da-ana", dataJson.MotivoCredencialInvalida},
+		{"", "senha-da-ana", dataJson.MotivoCredencialInvalida},
+		{"ana", "", dataJson.MotivoCredencialInvalida},
+	}
+	for _, caso := range casos {
+		if motivo := ConferirCredencialOperador(caso.operador, caso.credencial); motivo != caso.motivo {
+			t.Errorf("ConferirCredencialOperador(%q, %q) = %q, esperado %q", caso.operador, caso.credencial, motivo, caso.motivo)
+		}
+
+		connectionStore := store.NewConnectionStore()
+		conexao, _ := conexaoEmMemoria(t)
+		mensagem, erro := dataJson.NewMensagem("identificacao", "operador", dataJson.Identificacao{
+			Versoes:    dataJson.VersoesSuportadas(),
+			Credencial: caso.credencial,
+			Operador:   caso.operador,
+		})
+		if erro != nil {
+			t.Fatal(erro)
+		}
+		identificarOperador(logger, connectionStore, conexao, mensagem)
+		operador, autenticado := connectionStore.GetOperador(conexao)
+		if autenticado != (caso.motivo == "") || (autenticado && operador != caso.operador) {
+			t.Errorf("identificacao de %q: registrado %q %v", caso.operador, operador, autenticado)
+		}
+	}
+}
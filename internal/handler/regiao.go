@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"time"
+)
+
+// Variavel de ambiente com o intervalo entre as verificacoes de regiao.json
+const EnvIntervaloRegiao = "REGIAO_INTERVALO"
+
+const intervaloRegiaoPadrao = 5 * time.Second
+
+// Le o intervalo de verificacao de regiao.json do ambiente, por exemplo "5s"
+func IntervaloRegiaoDoAmbiente() (time.Duration, error) {
+	valor := os.Getenv(EnvIntervaloRegiao)
+	if valor == "" {
+		return intervaloRegiaoPadrao, nil
+	}
+	intervalo, erro := time.ParseDuration(valor)
+	if erro != nil || intervalo <= 0 {
+		return intervaloRegiaoPadrao, fmt.Errorf("%s invalido: %q", EnvIntervaloRegiao, valor)
+	}
+	return intervalo, nil
+}
+
+// Confere periodicamente a data de modificação de regiao.json e recarrega a
+// região quando ela muda. Pontos novos passam a ser aceitos na identificação;
+// pontos retirados têm as reservas canceladas e a conexão encerrada.
+func MonitorarRegiao(logger *logger.Logger, connectionStore *store.ConnectionStore, intervalo time.Duration) {
+	ticker := time.NewTicker(intervalo)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		alteracao, recarregada, erro := dataJson.RecarregarRegiao()
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao recarregar %s, mantendo a região anterior: %v", dataJson.ArquivoRegiao, erro))
+			continue
+		}
+		if !recarregada {
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s recarregado: pontos adicionados %v, retirados %v, alterados %v",
+			dataJson.ArquivoRegiao, alteracao.Adicionados, alteracao.Retirados, alteracao.Alterados))
+		retirarPontosDescadastrados(logger, connectionStore)
+	}
+}
+
+// Cancela as reservas e encerra a conexão dos pontos conectados que não
+// estão mais em regiao.json
+func retirarPontosDescadastrados(logger *logger.Logger, connectionStore *store.ConnectionStore) {
+	for conexao, pontoID := range connectionStore.GetPontosMap() {
+		if _, resultado := dataJson.GetPontoId(pontoID); resultado != 2 {
+			continue
+		}
+
+		reservasMutex.Lock()
+		var placas []string
+		for placa, reservado := range reservasAtivas {
+			if reservado == pontoID {
+				placas = append(placas, placa)
+			}
+		}
+		reservasMutex.Unlock()
+		for _, placa := range placas {
+			if _, erro := CancelarReserva(logger, connectionStore, placa); erro == nil {
+				avisarCancelamento(logger, connectionStore, placa, pontoID)
+			}
+		}
+
+		logger.Info(fmt.Sprintf("Ponto ID %d retirado de %s -> desconectado: %s", pontoID, dataJson.ArquivoRegiao, conexao.RemoteAddr()))
+		connectionStore.RemoveConnection(conexao)
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"sync"
+	"time"
+)
+
+// Tempo máximo de espera pela resposta de um ponto a um pedido do servidor
+const tempoLimiteResposta = 5 * time.Second
+
+type chaveRequisicao struct {
+	conexao *dataJson.Conn
+	id      uint64
+}
+
+var (
+	requisicoesPendentes = make(map[chaveRequisicao]chan dataJson.Mensagem)
+	requisicoesMutex     sync.Mutex
+)
+
+// Envia um pedido ao cliente da conexão e aguarda a resposta correlacionada
+// pelo ID. A resposta é entregue por HandleConnection, que lê a conexão.
+func requisitar(conexao *dataJson.Conn, tipo string, dados any) (dataJson.Mensagem, error) {
+	pedido, erro := dataJson.NewMensagem(tipo, "servidor", dados)
+	if erro != nil {
+		return dataJson.Mensagem{}, erro
+	}
+	pedido.ID = conexao.NextID()
+
+	chave := chaveRequisicao{conexao: conexao, id: pedido.ID}
+	resposta := make(chan dataJson.Mensagem, 1)
+	requisicoesMutex.Lock()
+	requisicoesPendentes[chave] = resposta
+	requisicoesMutex.Unlock()
+	defer func() {
+		requisicoesMutex.Lock()
+		delete(requisicoesPendentes, chave)
+		requisicoesMutex.Unlock()
+	}()
+
+	erro = dataJson.SendMessage(conexao, pedido)
+	if erro != nil {
+		return dataJson.Mensagem{}, erro
+	}
+
+	select {
+	case mensagem := <-resposta:
+		return mensagem, nil
+	case <-time.After(tempoLimiteResposta):
+		return dataJson.Mensagem{}, fmt.Errorf("sem resposta de %s para %s", conexao.RemoteAddr(), tipo)
+	}
+}
+
+// Entrega a mensagem a um pedido pendente do servidor. Retorna false se ela
+// não for a resposta de nenhum pedido.
+func entregarResposta(conexao *dataJson.Conn, mensagem dataJson.Mensagem) bool {
+	if mensagem.ReplyTo == 0 {
+		return false
+	}
+	requisicoesMutex.Lock()
+	resposta, existe := requisicoesPendentes[chaveRequisicao{conexao: conexao, id: mensagem.ReplyTo}]
+	requisicoesMutex.Unlock()
+	if !existe {
+		return false
+	}
+	select {
+	case resposta <- mensagem:
+	default:
+	}
+	return true
+}
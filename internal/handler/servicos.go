@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+)
+
+// Operações usadas tanto pelo protocolo TCP quanto pela API HTTP
+
+var ErrSemReserva = errors.New("veículo sem reserva ativa")
+
+// Erro devolvido quando a reserva não pode ser feita
+type ErroReserva struct {
+	Falha dataJson.ReservaFalhou
+}
+
+func (erro *ErroReserva) Error() string {
+	return fmt.Sprintf("reserva no ponto %d falhou: %s", erro.Falha.PontoID, erro.Falha.Motivo)
+}
+
+// Confere se a localização é válida e está na área de cobertura de regiao.json.
+// Os erros são sempre *dataJson.ErroValidacao; sem regiao.json a área não é
+// conferida, e o ranking sai vazio.
+func ValidarLocalizacao(localizacao dataJson.Localizacao) error {
+	if erro := localizacao.Validar(); erro != nil {
+		return erro
+	}
+	dadosRegiao, erro := dataJson.GetRegiao()
+	if erro == nil && !dadosRegiao.Area.Contem(localizacao) {
+		return &dataJson.ErroValidacao{Campo: "localizacao", Motivo: dataJson.MotivoForaDaArea}
+	}
+	return nil
+}
+
+// Calcula os melhores pontos de recarga para a localização do veículo
+func RankingParaLocalizacao(logger *logger.Logger, connectionStore *store.ConnectionStore, localizacao dataJson.Localizacao) dataJson.RankingPontos {
+	latitude, longitude := localizacao.Latitude, localizacao.Longitude
+	logger.Info(fmt.Sprintf("Localizacao recebida: Latitude %f, Longitude %f", latitude, longitude))
+
+	logger.Info("Calculando ranking dos pontos de recarga...")
+
+	// Calcular ranking
+	ranking := calcularRankingPontos(logger, latitude, longitude, connectionStore)
+
+	for i, ponto := range ranking {
+		logger.Info(fmt.Sprintf("Ranking[%d]: ID=%d, Distância=%.2f, Fila=%d, Score=%.2f",
+			i, ponto.ID, ponto.Distancia, ponto.Fila, ponto.Score))
+	}
+
+	rankingPontos := dataJson.RankingPontos{Pontos: []dataJson.PontoRankeado{}}
+	for _, ponto := range ranking {
+		// Modificar a fila para não enviar '999' ao usuário
+		filaExibicao := ponto.Fila
+		if filaExibicao == 999 {
+			filaExibicao = 0 // Enviar 0 quando não temos informação
+		}
+
+		rankingPontos.Pontos = append(rankingPontos.Pontos, dataJson.PontoRankeado{
+			ID:          ponto.ID,
+			DistanciaKm: ponto.Distancia,
+			Fila:        filaExibicao,
+		})
+	}
+	return rankingPontos
+}
+
+// Reserva o ponto para o veículo da placa, encaminhando a solicitação ao
+// ponto e acompanhando a fila até a recarga. Falhas retornam *ErroReserva.
+func ReservarPonto(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string, pontoID int) (dataJson.ReservaConfirmada, error) {
+	logger.Info(fmt.Sprintf("Reserva solicitada para ponto ID %d", pontoID))
+
+	// Encontrar a conexão do ponto pelo ID
+	pontoCon := connectionStore.GetConexaoPorID(pontoID)
+	if pontoCon == nil {
+		logger.Erro(fmt.Sprintf("Ponto ID %d não encontrado", pontoID))
+		return dataJson.ReservaConfirmada{}, &ErroReserva{Falha: dataJson.ReservaFalhou{
+			PontoID: pontoID,
+			Motivo:  dataJson.MotivoPontoNaoEncontrado,
+		}}
+	}
+
+	// Enviar solicitação para o ponto
+	erro := dataJson.SendPayload(pontoCon, "nova-solicitacao", "servidor", dataJson.NovaSolicitacao{Placa: placa})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao enviar solicitação ao ponto: %v", erro))
+		return dataJson.ReservaConfirmada{}, &ErroReserva{Falha: dataJson.ReservaFalhou{
+			PontoID: pontoID,
+			Motivo:  dataJson.MotivoFalhaComunicacao,
+		}}
+	}
+
+	// Registrar a reserva temporariamente em memória
+	reservasMutex.Lock()
+	reservasAtivas[placa] = pontoID
+	reservasMutex.Unlock()
+	RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.ReservaCriada, Placa: placa, PontoID: pontoID})
+
+	// Consulta a fila diretamente no servidor
+	fila := connectionStore.GetFilaPorPonto(pontoID)
+	posicaoFila := len(fila) + 1 // Posição padrão se o veículo ainda não estiver na fila
+
+	// Verifica a posição real do veículo (placa)
+	for i, v := range fila {
+		if v.Placa == placa {
+			posicaoFila = i + 1
+			break
+		}
+	}
+
+	go monitorarFilaParaVeiculo(logger, connectionStore, placa, pontoID)
+
+	return dataJson.ReservaConfirmada{PontoID: pontoID, Posicao: posicaoFila}, nil
+}
+
+// Retorna o ponto reservado pelo veículo da placa
+func ReservaAtiva(placa string) (int, bool) {
+	reservasMutex.Lock()
+	defer reservasMutex.Unlock()
+	pontoID, existe := reservasAtivas[placa]
+	return pontoID, existe
+}
+
+// Encerra a reserva do veículo ao fim da recarga no ponto. Retorna false se o
+// veículo não reservou o ponto nem está na sua fila, e nesse caso nada muda
+func encerrarReserva(connectionStore *store.ConnectionStore, placa string, pontoID int) bool {
+	reservasMutex.Lock()
+	reservado, existe := reservasAtivas[placa]
+	if existe && reservado == pontoID {
+		delete(reservasAtivas, placa)
+	}
+	reservasMutex.Unlock()
+	if existe && reservado == pontoID {
+		return true
+	}
+
+	for _, veiculo := range connectionStore.GetFilaPorPonto(pontoID) {
+		if veiculo.Placa == placa {
+			return true
+		}
+	}
+	return false
+}
+
+// Cancela a reserva do veículo e avisa o ponto para retirá-lo da fila
+func CancelarReserva(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string) (int, error) {
+	reservasMutex.Lock()
+	pontoID, existe := reservasAtivas[placa]
+	delete(reservasAtivas, placa)
+	reservasMutex.Unlock()
+
+	if !existe {
+		return 0, ErrSemReserva
+	}
+	logger.Info(fmt.Sprintf("Reserva do veículo %s no ponto ID %d cancelada", placa, pontoID))
+	RegistrarEvento(logger, connectionStore, eventos.Evento{Tipo: eventos.ReservaCancelada, Placa: placa, PontoID: pontoID})
+
+	pontoCon := connectionStore.GetConexaoPorID(pontoID)
+	if pontoCon == nil {
+		logger.Erro(fmt.Sprintf("Ponto ID %d não encontrado para avisar sobre o cancelamento", pontoID))
+		return pontoID, nil
+	}
+	erro := dataJson.SendPayload(pontoCon, "cancelar-reserva", "servidor", dataJson.CancelarReserva{Placa: placa})
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao avisar ponto %d sobre o cancelamento: %v", pontoID, erro))
+	}
+	return pontoID, nil
+}
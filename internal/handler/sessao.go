@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"time"
+)
+
+// Variavel de ambiente com o tempo que uma sessao desconectada pode ser retomada
+const EnvValidadeSessao = "SESSAO_VALIDADE"
+
+const validadeSessaoPadrao = 5 * time.Minute
+
+// Le a validade das sessoes do ambiente, por exemplo "5m"
+func ValidadeSessaoDoAmbiente() (time.Duration, error) {
+	valor := os.Getenv(EnvValidadeSessao)
+	if valor == "" {
+		return validadeSessaoPadrao, nil
+	}
+	validade, erro := time.ParseDuration(valor)
+	if erro != nil || validade <= 0 {
+		return validadeSessaoPadrao, fmt.Errorf("%s invalido: %q", EnvValidadeSessao, valor)
+	}
+	return validade, nil
+}
+
+// Retoma a sessão informada na identificação e entrega as notificações
+// perdidas. Retorna false se o token for inválido ou a sessão tiver expirado,
+// caso em que a identificação segue como uma nova conexão.
+func retomarSessao(logger *logger.Logger, connectionStore *store.ConnectionStore, conexao *dataJson.Conn, mensagem dataJson.Mensagem, identificacao dataJson.Identificacao, aceita dataJson.IdentificacaoAceita) bool {
+	placa, pendentes, ok := connectionStore.RetomarSessao(conexao, identificacao.Sessao, identificacao.Placa)
+	if !ok {
+		logger.Info(fmt.Sprintf("Sessão informada por %s inválida ou expirada, seguindo com nova identificação", conexao.RemoteAddr()))
+		return false
+	}
+
+	aceita.Sessao = identificacao.Sessao
+	aceita.Retomada = true
+	aceitarIdentificacao(logger, connectionStore, conexao, mensagem, aceita)
+	logger.Info(fmt.Sprintf("Veículo %s retomou a sessão: (%s), %d notificações pendentes", placa, conexao.RemoteAddr(), len(pendentes)))
+
+	for _, pendente := range pendentes {
+		erro := dataJson.SendMessage(conexao, pendente)
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Erro ao entregar notificação %s pendente para %s: %v", pendente.Tipo, placa, erro))
+			connectionStore.GuardarNotificacao(placa, pendente)
+		}
+	}
+	return true
+}
+
+// Envia uma notificação ao veículo da placa. Se ele estiver desconectado com
+// uma sessão aberta, a notificação é guardada para quando a sessão for retomada.
+func notificarVeiculo(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string, tipo string, dados any) error {
+	mensagem, erro := dataJson.NewMensagem(tipo, "servidor", dados)
+	if erro != nil {
+		return erro
+	}
+
+	veiculoCon := connectionStore.GetConexaoPorPlaca(placa)
+	if veiculoCon != nil {
+		erro = dataJson.SendMessage(veiculoCon, mensagem)
+		if erro == nil {
+			return nil
+		}
+	}
+
+	if connectionStore.GuardarNotificacao(placa, mensagem) {
+		logger.Info(fmt.Sprintf("Veículo %s desconectado, notificação %s guardada na sessão", placa, tipo))
+		return nil
+	}
+	if erro != nil {
+		return erro
+	}
+	return fmt.Errorf("conexão do veículo %s não encontrada", placa)
+}
+
+// Encerra periodicamente as sessões que não foram retomadas dentro da
+// validade, liberando as reservas dos veículos
+func MonitorarSessoes(logger *logger.Logger, connectionStore *store.ConnectionStore, validade time.Duration) {
+	ticker := time.NewTicker(min(validade, 30*time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, placa := range connectionStore.ExpirarSessoes(validade) {
+			expirarSessao(logger, connectionStore, placa)
+		}
+	}
+}
+
+// Cancela a reserva do veículo cuja sessão expirou pelo mesmo caminho do
+// cancelamento pedido, para que o ponto retire o veículo da fila
+func expirarSessao(logger *logger.Logger, connectionStore *store.ConnectionStore, placa string) {
+	pontoID, erro := CancelarReserva(logger, connectionStore, placa)
+	if errors.Is(erro, ErrSemReserva) {
+		logger.Info(fmt.Sprintf("Sessão do veículo %s expirou", placa))
+		return
+	}
+	logger.Info(fmt.Sprintf("Sessão do veículo %s expirou, reserva no ponto ID %d liberada", placa, pontoID))
+}
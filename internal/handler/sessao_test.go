@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"io"
+	"net"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/store"
+	"testing"
+	"time"
+)
+
+// A reserva de uma sessão expirada é cancelada também no ponto
+func TestSessaoExpiradaAvisaOPonto(t *testing.T) {
+	logger := logger.NewLogger(io.Discard)
+	connectionStore := store.NewConnectionStore()
+	servidor, cliente := net.Pipe()
+	t.Cleanup(func() {
+		servidor.Close()
+		cliente.Close()
+	})
+	connectionStore.AddPontoRecargaComID(dataJson.NewConn(servidor), 1)
+
+	reservasMutex.Lock()
+	reservasAtivas["ABC1234"] = 1
+	reservasMutex.Unlock()
+	t.Cleanup(func() {
+		reservasMutex.Lock()
+		delete(reservasAtivas, "ABC1234")
+		reservasMutex.Unlock()
+	})
+
+	recebida := make(chan dataJson.Mensagem, 1)
+	go func() {
+		mensagem, erro := dataJson.ReceiveMessage(dataJson.NewConn(cliente))
+		if erro == nil {
+			recebida <- mensagem
+		}
+	}()
+	expirarSessao(logger, connectionStore, "ABC1234")
+
+	select {
+	case mensagem := <-recebida:
+		var cancelamento dataJson.CancelarReserva
+		if mensagem.Tipo != "cancelar-reserva" || mensagem.DecodeDados(&cancelamento) != nil || cancelamento.Placa != "ABC1234" {
+			t.Fatalf("aviso ao ponto: %+v", mensagem)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ponto nao avisado do cancelamento")
+	}
+	if _, existe := ReservaAtiva("ABC1234"); existe {
+		t.Fatal("reserva mantida apos a sessao expirar")
+	}
+}
@@ -0,0 +1,95 @@
+package httpAPI
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/handler"
+	"strconv"
+	"time"
+)
+
+// Rotas equivalentes a mensagens do protocolo usam o limite da mensagem; as
+// demais têm um balde próprio com o limite padrão
+var tiposDasRotas = map[string]string{
+	"GET /api/ranking":                     "localizacao",
+	"POST /api/reservas":                   "solicitar-reserva",
+	"GET /api/veiculos/{placa}/historico":  "consultar-historico",
+	"POST /api/veiculos/{placa}/pagamento": "limpar-historico",
+}
+
+// As autenticações recusadas contam no limite da identificação pelo protocolo
+const tipoAutenticacao = "identificacao"
+
+func tipoDaRota(padrao string) string {
+	if tipo, existe := tiposDasRotas[padrao]; existe {
+		return tipo
+	}
+	return padrao
+}
+
+// Aplica o limite da rota ao endereço do cliente antes de tratar o pedido,
+// com as mesmas regras das mensagens recebidas pelas conexões
+func (api *api) limitar(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, padrao := mux.Handler(r); padrao != "" {
+			tipo := tipoDaRota(padrao)
+			espera, permitido := api.connectionStore.ConsumirLimiteEndereco(enderecoCliente(r), tipo, handler.RegraDoTipo(tipo))
+			if !permitido {
+				api.recusarExcesso(w, r, tipo, espera)
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Aplica o limite da rota à placa autenticada, compartilhado com as conexões
+// do veículo, de forma que trocar de endereço não zera o limite
+func (api *api) limitarPlaca(w http.ResponseWriter, r *http.Request, placa string) bool {
+	tipo := tipoDaRota(r.Pattern)
+	espera, permitido := api.connectionStore.ConsumirLimitePlaca(placa, tipo, handler.RegraDoTipo(tipo))
+	if !permitido {
+		api.recusarExcesso(w, r, tipo, espera)
+		return false
+	}
+	return true
+}
+
+// Recusa a autenticação, antes de conferir a senha, quando o endereço já
+// esgotou as tentativas recusadas; sem isso um cliente poderia bloquear placas
+// alheias errando a senha repetidamente
+func (api *api) autenticacaoLiberada(w http.ResponseWriter, r *http.Request) bool {
+	espera := api.connectionStore.EsperaLimiteEndereco(enderecoCliente(r), tipoAutenticacao, handler.RegraDoTipo(tipoAutenticacao))
+	if espera > 0 {
+		api.recusarExcesso(w, r, tipoAutenticacao, espera)
+		return false
+	}
+	return true
+}
+
+func (api *api) registrarFalhaAutenticacao(r *http.Request) {
+	api.connectionStore.ConsumirLimiteEndereco(enderecoCliente(r), tipoAutenticacao, handler.RegraDoTipo(tipoAutenticacao))
+}
+
+// Responde 429 com a espera em Retry-After e no corpo, como o limite-excedido
+// do protocolo
+func (api *api) recusarExcesso(w http.ResponseWriter, r *http.Request, tipo string, espera time.Duration) {
+	api.logger.Erro(fmt.Sprintf("Limite de %s excedido por %s", tipo, r.RemoteAddr))
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(espera.Seconds())), 10))
+	escreverJSON(w, http.StatusTooManyRequests, dataJson.LimiteExcedido{
+		Tipo:       tipo,
+		TentarEmMs: espera.Milliseconds(),
+	})
+}
+
+// Endereço do cliente sem a porta, que muda a cada conexão
+func enderecoCliente(r *http.Request) string {
+	endereco, _, erro := net.SplitHostPort(r.RemoteAddr)
+	if erro != nil {
+		return r.RemoteAddr
+	}
+	return endereco
+}
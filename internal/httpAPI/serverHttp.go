@@ -0,0 +1,365 @@
+package httpAPI
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/eventos"
+	"recarga-inteligente/internal/exportacao"
+	"recarga-inteligente/internal/handler"
+	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
+	"recarga-inteligente/internal/store"
+	"recarga-inteligente/internal/webSocket"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estado de um ponto de recarga cadastrado
+type PontoStatus struct {
+	dataJson.Ponto
+	Conectado bool `json:"conectado"`
+}
+
+// Reserva ativa de um veículo
+type Reserva struct {
+	Placa   string `json:"placa"`
+	PontoID int    `json:"ponto_id"`
+}
+
+// Corpo de POST /api/reservas
+type PedidoReserva struct {
+	Placa   string `json:"placa"`
+	PontoID int    `json:"ponto_id"`
+}
+
+type respostaErro struct {
+	Erro   string `json:"erro"`
+	Motivo string `json:"motivo,omitempty"`
+}
+
+type api struct {
+	connectionStore *store.ConnectionStore
+	veiculos        repositorio.VehicleRepository
+	logger          *logger.Logger
+}
+
+// Monta as rotas da API HTTP sobre a mesma lógica usada pelo protocolo TCP
+func NewHandler(connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, logger *logger.Logger) http.Handler {
+	rotas := &api{connectionStore: connectionStore, veiculos: veiculos, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/regiao", rotas.getRegiao)
+	mux.HandleFunc("GET /api/pontos", rotas.getPontos)
+	mux.HandleFunc("GET /api/ranking", rotas.getRanking)
+	mux.HandleFunc("POST /api/reservas", rotas.postReserva)
+	mux.HandleFunc("GET /api/reservas/{placa}", rotas.getReserva)
+	mux.HandleFunc("DELETE /api/reservas/{placa}", rotas.deleteReserva)
+	mux.HandleFunc("GET /api/veiculos/{placa}/historico", rotas.getHistorico)
+	mux.HandleFunc("POST /api/veiculos/{placa}/pagamento", rotas.postPagamento)
+	mux.HandleFunc("GET /api/admin/recargas", rotas.getRecargas)
+	mux.HandleFunc("GET /ws", rotas.getWebSocket)
+	return rotas.limitar(mux)
+}
+
+// Inicia a API HTTP na porta informada. Com tlsConfig nil a API é servida sem TLS.
+func StartServerHTTP(porta string, tlsConfig *tls.Config, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, logger *logger.Logger) error {
+	servidor := &http.Server{
+		Addr:              porta,
+		Handler:           NewHandler(connectionStore, veiculos, logger),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.Info(fmt.Sprintf("API HTTP escutando na porta %s (TLS: %t)...", porta, tlsConfig != nil))
+	var erro error
+	if tlsConfig != nil {
+		// Certificado e chave já estão carregados em tlsConfig
+		erro = servidor.ListenAndServeTLS("", "")
+	} else {
+		erro = servidor.ListenAndServe()
+	}
+	if erro != nil {
+		logger.Erro(fmt.Sprintf("Erro ao iniciar API HTTP: %v", erro))
+	}
+	return erro
+}
+
+func (api *api) getRegiao(w http.ResponseWriter, r *http.Request) {
+	dadosRegiao, erro := dataJson.RegiaoPublica()
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao carregar dados da regiao do JSON: %v", erro))
+		escreverErro(w, http.StatusInternalServerError, "erro ao carregar dados da região", "")
+		return
+	}
+	escreverJSON(w, http.StatusOK, dadosRegiao)
+}
+
+func (api *api) getPontos(w http.ResponseWriter, r *http.Request) {
+	dadosRegiao, erro := dataJson.RegiaoPublica()
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao carregar pontos de recarga: %v", erro))
+		escreverErro(w, http.StatusInternalServerError, "erro ao carregar pontos de recarga", "")
+		return
+	}
+
+	status := make([]PontoStatus, 0, len(dadosRegiao.PontosDeRecarga))
+	for _, ponto := range dadosRegiao.PontosDeRecarga {
+		status = append(status, PontoStatus{
+			Ponto:     ponto,
+			Conectado: api.connectionStore.GetConexaoPorID(ponto.ID) != nil,
+		})
+	}
+	escreverJSON(w, http.StatusOK, status)
+}
+
+// GET /api/ranking?latitude=-12.25&longitude=-38.95
+func (api *api) getRanking(w http.ResponseWriter, r *http.Request) {
+	latitude, erroLat := strconv.ParseFloat(r.URL.Query().Get("latitude"), 64)
+	longitude, erroLon := strconv.ParseFloat(r.URL.Query().Get("longitude"), 64)
+	if erroLat != nil || erroLon != nil {
+		escreverErro(w, http.StatusBadRequest, "latitude e longitude são obrigatórias", "")
+		return
+	}
+	localizacao := dataJson.Localizacao{Latitude: latitude, Longitude: longitude}
+	var validacao *dataJson.ErroValidacao
+	if erro := handler.ValidarLocalizacao(localizacao); errors.As(erro, &validacao) {
+		escreverErro(w, http.StatusBadRequest, erro.Error(), validacao.Motivo)
+		return
+	}
+
+	ranking := handler.RankingParaLocalizacao(api.logger, api.connectionStore, localizacao)
+	escreverJSON(w, http.StatusOK, ranking)
+}
+
+func (api *api) postReserva(w http.ResponseWriter, r *http.Request) {
+	var pedido PedidoReserva
+	erro := json.NewDecoder(http.MaxBytesReader(w, r.Body, dataJson.TamanhoMaximoQuadro)).Decode(&pedido)
+	if erro != nil || strings.TrimSpace(pedido.Placa) == "" || pedido.PontoID <= 0 {
+		escreverErro(w, http.StatusBadRequest, "informe placa e ponto_id", dataJson.MotivoPedidoInvalido)
+		return
+	}
+	pedido.Placa, erro = dataJson.NormalizarPlaca(pedido.Placa)
+	if erro != nil {
+		escreverErro(w, http.StatusBadRequest, erro.Error(), dataJson.MotivoPlacaInvalida)
+		return
+	}
+	if !api.autenticar(w, r, pedido.Placa) {
+		return
+	}
+
+	confirmacao, erro := handler.ReservarPonto(api.logger, api.connectionStore, pedido.Placa, pedido.PontoID)
+	var falha *handler.ErroReserva
+	if errors.As(erro, &falha) {
+		codigo := http.StatusBadGateway
+		if falha.Falha.Motivo == dataJson.MotivoPontoNaoEncontrado {
+			codigo = http.StatusNotFound
+		}
+		escreverErro(w, codigo, falha.Error(), falha.Falha.Motivo)
+		return
+	}
+	escreverJSON(w, http.StatusCreated, confirmacao)
+}
+
+func (api *api) getReserva(w http.ResponseWriter, r *http.Request) {
+	placa, ok := placaDaRota(w, r)
+	if !ok || !api.autenticar(w, r, placa) {
+		return
+	}
+	pontoID, existe := handler.ReservaAtiva(placa)
+	if !existe {
+		escreverErro(w, http.StatusNotFound, handler.ErrSemReserva.Error(), "")
+		return
+	}
+	escreverJSON(w, http.StatusOK, Reserva{Placa: placa, PontoID: pontoID})
+}
+
+func (api *api) deleteReserva(w http.ResponseWriter, r *http.Request) {
+	placa, ok := placaDaRota(w, r)
+	if !ok || !api.autenticar(w, r, placa) {
+		return
+	}
+	_, erro := handler.CancelarReserva(api.logger, api.connectionStore, placa)
+	if errors.Is(erro, handler.ErrSemReserva) {
+		escreverErro(w, http.StatusNotFound, erro.Error(), "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *api) getHistorico(w http.ResponseWriter, r *http.Request) {
+	placa, ok := placaDaRota(w, r)
+	if !ok || !api.autenticar(w, r, placa) {
+		return
+	}
+	recargas, erro := api.veiculos.ObterHistoricoRecargas(placa)
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao obter histórico de recargas para %s: %v", placa, erro))
+		escreverErro(w, http.StatusInternalServerError, "erro ao obter histórico de recargas", "")
+		return
+	}
+	escreverJSON(w, http.StatusOK, dataJson.HistoricoRecargas{Recargas: recargas})
+}
+
+func (api *api) postPagamento(w http.ResponseWriter, r *http.Request) {
+	placa, ok := placaDaRota(w, r)
+	if !ok || !api.autenticar(w, r, placa) {
+		return
+	}
+	erro := api.veiculos.PagarRecargas(placa)
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao registrar pagamento de %s: %v", placa, erro))
+		escreverErro(w, http.StatusInternalServerError, "erro ao efetuar pagamento", "")
+		return
+	}
+	handler.RegistrarEvento(api.logger, api.connectionStore, eventos.Evento{Tipo: eventos.PagamentoEfetuado, Placa: placa})
+	api.logger.Info(fmt.Sprintf("Pagamento do veículo %s confirmado pela API HTTP", placa))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lê e normaliza a placa do caminho da rota, respondendo 400 se ela for inválida
+func placaDaRota(w http.ResponseWriter, r *http.Request) (string, bool) {
+	placa, erro := dataJson.NormalizarPlaca(r.PathValue("placa"))
+	if erro != nil {
+		escreverErro(w, http.StatusBadRequest, erro.Error(), dataJson.MotivoPlacaInvalida)
+		return "", false
+	}
+	return placa, true
+}
+
+// Exige autenticação HTTP Basic com a placa como usuário e a senha do
+// veículo, a mesma usada na identificação pelo protocolo TCP
+func (api *api) autenticar(w http.ResponseWriter, r *http.Request, placa string) bool {
+	usuario, senha, informada := r.BasicAuth()
+	usuario, erro := dataJson.NormalizarPlaca(usuario)
+	if !informada || erro != nil || usuario != placa {
+		w.Header().Set("WWW-Authenticate", `Basic realm="recarga-inteligente"`)
+		escreverErro(w, http.StatusUnauthorized, "autenticação do veículo necessária", dataJson.MotivoAutenticacaoPendente)
+		return false
+	}
+	if !api.autenticacaoLiberada(w, r) {
+		return false
+	}
+
+	erro = handler.AutenticarVeiculo(api.logger, api.connectionStore, api.veiculos, placa, senha)
+	var bloqueio *handler.ErroVeiculoBloqueado
+	switch {
+	case erro == nil:
+		return api.limitarPlaca(w, r, placa)
+	case errors.As(erro, &bloqueio):
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(bloqueio.Ate).Seconds())+1))
+		escreverErro(w, http.StatusForbidden, erro.Error(), dataJson.MotivoVeiculoBloqueado)
+	case errors.Is(erro, handler.ErrSenhaInvalida), errors.Is(erro, handler.ErrVeiculoNaoCadastrado):
+		api.registrarFalhaAutenticacao(r)
+		w.Header().Set("WWW-Authenticate", `Basic realm="recarga-inteligente"`)
+		escreverErro(w, http.StatusUnauthorized, handler.ErrSenhaInvalida.Error(), dataJson.MotivoSenhaInvalida)
+	case errors.Is(erro, handler.ErrSenhaPendente):
+		escreverErro(w, http.StatusForbidden, erro.Error(), dataJson.MotivoSenhaPendente)
+	default:
+		api.logger.Erro(fmt.Sprintf("Erro ao autenticar veículo %s: %v", placa, erro))
+		escreverErro(w, http.StatusInternalServerError, "erro ao autenticar veículo", "")
+	}
+	return false
+}
+
+// Exporta o histórico de recargas para o financeiro, com totais por grupo.
+// GET /api/admin/recargas?formato=csv&agrupar=placa&de=2025-03-01&ate=2025-03-31&placa=ABC1234&ponto=2
+func (api *api) getRecargas(w http.ResponseWriter, r *http.Request) {
+	operador, ok := api.autenticarOperador(w, r)
+	if !ok {
+		return
+	}
+	consulta := r.URL.Query()
+	formato := consulta.Get("formato")
+	if formato == "" {
+		formato = exportacao.FormatoCSV
+	}
+	agrupamento := consulta.Get("agrupar")
+	if agrupamento == "" {
+		agrupamento = exportacao.PorPlaca
+	}
+	filtro, erro := exportacao.NovoFiltro(consulta.Get("de"), consulta.Get("ate"), consulta.Get("placa"), consulta.Get("ponto"))
+	if erro == nil {
+		erro = exportacao.ValidarFormato(formato)
+	}
+	if erro == nil {
+		erro = exportacao.ValidarAgrupamento(agrupamento)
+	}
+	if erro != nil {
+		handler.AuditarOperador(api.logger, operador, r.RemoteAddr, "exportar-recargas", r.URL.RawQuery, dataJson.MotivoPedidoInvalido)
+		escreverErro(w, http.StatusBadRequest, erro.Error(), dataJson.MotivoPedidoInvalido)
+		return
+	}
+
+	veiculos, erro := api.veiculos.ListarVeiculos()
+	var linhas []exportacao.Linha
+	if erro == nil {
+		linhas, erro = exportacao.Gerar(veiculos, filtro, agrupamento)
+	}
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao exportar recargas: %v", erro))
+		handler.AuditarOperador(api.logger, operador, r.RemoteAddr, "exportar-recargas", r.URL.RawQuery, "erro")
+		escreverErro(w, http.StatusInternalServerError, "erro ao exportar recargas", "")
+		return
+	}
+	handler.AuditarOperador(api.logger, operador, r.RemoteAddr, "exportar-recargas", r.URL.RawQuery, "ok")
+
+	w.Header().Set("Content-Type", exportacao.TipoConteudo(formato))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="recargas.%s"`, formato))
+	if erro := exportacao.Escrever(w, linhas, formato); erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro ao enviar exportação de recargas para %s: %v", r.RemoteAddr, erro))
+	}
+}
+
+// Exige autenticação HTTP Basic com o nome do operador como usuário e a
+// credencial desse operador como senha. Tentativas recusadas são auditadas.
+func (api *api) autenticarOperador(w http.ResponseWriter, r *http.Request) (string, bool) {
+	operador, credencial, informada := r.BasicAuth()
+	motivo := dataJson.MotivoAutenticacaoPendente
+	if informada {
+		if !api.autenticacaoLiberada(w, r) {
+			return "", false
+		}
+		motivo = handler.ConferirCredencialOperador(operador, credencial)
+	}
+	if motivo == "" {
+		return operador, true
+	}
+	if motivo == dataJson.MotivoCredencialInvalida {
+		api.registrarFalhaAutenticacao(r)
+	}
+	handler.AuditarOperador(api.logger, operador, r.RemoteAddr, "identificacao", r.URL.Path, motivo)
+	if motivo == dataJson.MotivoOperadorDesabilitado {
+		escreverErro(w, http.StatusForbidden, "operadores desabilitados neste servidor", motivo)
+		return "", false
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="recarga-inteligente-admin"`)
+	escreverErro(w, http.StatusUnauthorized, "autenticação de operador necessária", motivo)
+	return "", false
+}
+
+// Conexão WebSocket que transporta as mesmas mensagens do protocolo TCP,
+// tratada pelo servidor como qualquer outra conexão
+func (api *api) getWebSocket(w http.ResponseWriter, r *http.Request) {
+	conexao, erro := webSocket.Upgrade(w, r)
+	if erro != nil {
+		api.logger.Erro(fmt.Sprintf("Erro no handshake WebSocket com %s: %v", r.RemoteAddr, erro))
+		return
+	}
+	api.logger.Info(fmt.Sprintf("Conexão WebSocket estabelecida com %s", conexao.RemoteAddr()))
+	handler.HandleConnection(dataJson.NewConnTransporte(conexao), api.connectionStore, api.veiculos, api.logger)
+}
+
+func escreverJSON(w http.ResponseWriter, codigo int, dados any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(codigo)
+	json.NewEncoder(w).Encode(dados)
+}
+
+func escreverErro(w http.ResponseWriter, codigo int, mensagem string, motivo string) {
+	escreverJSON(w, codigo, respostaErro{Erro: mensagem, Motivo: motivo})
+}
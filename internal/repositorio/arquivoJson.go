@@ -0,0 +1,79 @@
+package repositorio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"sync"
+)
+
+// O arquivo existe mas não pôde ser decodificado. Ele é mantido como está e
+// nenhuma gravação é feita até que seja corrigido ou restaurado.
+var ErrArquivoCorrompido = errors.New("arquivo de veículos corrompido")
+
+// Veículos guardados em um arquivo JSON, relido e regravado a cada operação
+type arquivoJSON struct {
+	caminho string
+}
+
+// Um repositório por arquivo, para que todas as gravações em um mesmo
+// arquivo passem pelo mesmo mutex
+var (
+	repositoriosJSON      = make(map[string]*repositorio)
+	repositoriosJSONMutex sync.Mutex
+)
+
+// Repositório sobre o arquivo JSON informado. O arquivo é criado na primeira
+// gravação se ainda não existir. Chamadas com o mesmo arquivo retornam o
+// mesmo repositório.
+func NewRepositorioJSON(caminho string) VehicleRepository {
+	caminho = filepath.Clean(caminho)
+	repositoriosJSONMutex.Lock()
+	defer repositoriosJSONMutex.Unlock()
+	existente, existe := repositoriosJSON[caminho]
+	if !existe {
+		existente = &repositorio{armazenamento: arquivoJSON{caminho: caminho}}
+		repositoriosJSON[caminho] = existente
+	}
+	return existente
+}
+
+func (arquivo arquivoJSON) carregar() (dataJson.DadosVeiculos, error) {
+	var dados dataJson.DadosVeiculos
+	conteudo, erro := os.ReadFile(arquivo.caminho)
+	if os.IsNotExist(erro) {
+		return dados, nil
+	}
+	if erro != nil {
+		return dados, fmt.Errorf("erro ao abrir %s: %v", arquivo.caminho, erro)
+	}
+	conteudo, _, erro = dataJson.Migrar(dataJson.ArquivoVeiculos, conteudo)
+	if errors.Is(erro, dataJson.ErrVersaoDesconhecida) {
+		return dados, fmt.Errorf("%s: %w", arquivo.caminho, erro)
+	}
+	if erro == nil {
+		erro = json.Unmarshal(conteudo, &dados)
+	}
+	if erro != nil {
+		return dados, fmt.Errorf("%w: %s: %v", ErrArquivoCorrompido, arquivo.caminho, erro)
+	}
+	return dados, nil
+}
+
+func (arquivo arquivoJSON) salvar(dados dataJson.DadosVeiculos) error {
+	if dados.Veiculos == nil {
+		dados.Veiculos = []dataJson.Veiculo{}
+	}
+	dados.Versao = dataJson.VersaoAtual(dataJson.ArquivoVeiculos)
+	conteudo, erro := json.MarshalIndent(dados, "", "  ")
+	if erro != nil {
+		return fmt.Errorf("erro ao serializar veículos: %v", erro)
+	}
+	if erro := dataJson.GravarArquivoAtomico(arquivo.caminho, append(conteudo, '\n'), 0644); erro != nil {
+		return fmt.Errorf("erro ao gravar %s: %v", arquivo.caminho, erro)
+	}
+	return nil
+}
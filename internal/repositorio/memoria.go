@@ -0,0 +1,37 @@
+package repositorio
+
+import (
+	"recarga-inteligente/internal/dataJson"
+	"slices"
+)
+
+// Veículos guardados apenas em memória, usado nos testes
+type memoria struct {
+	dados dataJson.DadosVeiculos
+}
+
+func NewRepositorioMemoria() VehicleRepository {
+	return &repositorio{armazenamento: &memoria{}}
+}
+
+// As cópias evitam que quem recebeu um veículo altere o que está guardado
+func (memoria *memoria) carregar() (dataJson.DadosVeiculos, error) {
+	return copiarDados(memoria.dados), nil
+}
+
+func (memoria *memoria) salvar(dados dataJson.DadosVeiculos) error {
+	memoria.dados = copiarDados(dados)
+	return nil
+}
+
+func copiarDados(dados dataJson.DadosVeiculos) dataJson.DadosVeiculos {
+	copia := dataJson.DadosVeiculos{Veiculos: slices.Clone(dados.Veiculos)}
+	for i, veiculo := range copia.Veiculos {
+		copia.Veiculos[i].Recargas = slices.Clone(veiculo.Recargas)
+		if veiculo.Senha != nil {
+			senha := *veiculo.Senha
+			copia.Veiculos[i].Senha = &senha
+		}
+	}
+	return copia
+}
@@ -0,0 +1,208 @@
+package repositorio
+
+import (
+	"errors"
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"sync"
+	"time"
+)
+
+var ErrVeiculoNaoEncontrado = errors.New("veículo não encontrado")
+
+// Cadastro dos veículos: placas, senhas e histórico de recargas
+type VehicleRepository interface {
+	// Cadastra a placa, se ainda não existir
+	SalvarVeiculo(placa string) error
+	PlacaJaExiste(placa string) (bool, error)
+	// Retorna o cadastro do veículo da placa, ou false se ele não existir
+	ObterVeiculo(placa string) (dataJson.Veiculo, bool, error)
+	// Todos os veículos cadastrados, com o histórico de recargas
+	ListarVeiculos() ([]dataJson.Veiculo, error)
+	// Cadastra a senha do veículo, criando o registro se a placa ainda não
+	// existir. Retorna dataJson.ErrSenhaJaCadastrada se o veículo já tiver senha.
+	CadastrarSenhaVeiculo(placa string, senha dataJson.SenhaVeiculo) error
+	// Cadastra uma placa nova já com a senha. Retorna
+	// dataJson.ErrPlacaJaCadastrada se a placa já existir, com ou sem senha.
+	CadastrarVeiculo(placa string, senha dataJson.SenhaVeiculo) error
+	// Acrescenta uma recarga ao histórico, cadastrando o veículo se preciso
+	RegistrarRecarga(placa string, pontoID int, valor float64) error
+	// Recargas da placa ainda não pagas; vazio se o veículo não existir
+	ObterHistoricoRecargas(placa string) ([]dataJson.Recarga, error)
+	// Marca as recargas da placa como pagas. Elas deixam o histórico do
+	// veículo, mas continuam no cadastro para a exportação.
+	PagarRecargas(placa string) error
+	// Ponto da recarga mais recente do veículo
+	ObterUltimoReserva(placa string) (int, error)
+}
+
+// Onde os dados dos veículos são lidos e gravados por inteiro
+type armazenamento interface {
+	carregar() (dataJson.DadosVeiculos, error)
+	salvar(dados dataJson.DadosVeiculos) error
+}
+
+// Implementa as operações sobre um armazenamento; o mutex serializa as
+// leituras e regravações feitas pelas conexões em paralelo
+type repositorio struct {
+	mutex         sync.Mutex
+	armazenamento armazenamento
+}
+
+// Lê os dados sem alterá-los
+func (repositorio *repositorio) consultar() (dataJson.DadosVeiculos, error) {
+	repositorio.mutex.Lock()
+	defer repositorio.mutex.Unlock()
+	return repositorio.armazenamento.carregar()
+}
+
+// Lê os dados, aplica a alteração e grava o resultado. Se a alteração
+// retornar erro nada é gravado.
+func (repositorio *repositorio) atualizar(alterar func(dados *dataJson.DadosVeiculos) error) error {
+	repositorio.mutex.Lock()
+	defer repositorio.mutex.Unlock()
+	dados, erro := repositorio.armazenamento.carregar()
+	if erro != nil {
+		return erro
+	}
+	if erro := alterar(&dados); erro != nil {
+		return erro
+	}
+	return repositorio.armazenamento.salvar(dados)
+}
+
+func buscarVeiculo(dados *dataJson.DadosVeiculos, placa string) *dataJson.Veiculo {
+	for i := range dados.Veiculos {
+		if dados.Veiculos[i].Placa == placa {
+			return &dados.Veiculos[i]
+		}
+	}
+	return nil
+}
+
+// Retorna o veículo da placa, acrescentando um registro vazio se ele não existir
+func buscarOuCriarVeiculo(dados *dataJson.DadosVeiculos, placa string) *dataJson.Veiculo {
+	if veiculo := buscarVeiculo(dados, placa); veiculo != nil {
+		return veiculo
+	}
+	dados.Veiculos = append(dados.Veiculos, dataJson.Veiculo{Placa: placa, Recargas: []dataJson.Recarga{}})
+	return &dados.Veiculos[len(dados.Veiculos)-1]
+}
+
+func (repositorio *repositorio) SalvarVeiculo(placa string) error {
+	return repositorio.atualizar(func(dados *dataJson.DadosVeiculos) error {
+		buscarOuCriarVeiculo(dados, placa)
+		return nil
+	})
+}
+
+func (repositorio *repositorio) PlacaJaExiste(placa string) (bool, error) {
+	_, existe, erro := repositorio.ObterVeiculo(placa)
+	return existe, erro
+}
+
+func (repositorio *repositorio) ObterVeiculo(placa string) (dataJson.Veiculo, bool, error) {
+	dados, erro := repositorio.consultar()
+	if erro != nil {
+		return dataJson.Veiculo{}, false, erro
+	}
+	if veiculo := buscarVeiculo(&dados, placa); veiculo != nil {
+		return *veiculo, true, nil
+	}
+	return dataJson.Veiculo{}, false, nil
+}
+
+func (repositorio *repositorio) ListarVeiculos() ([]dataJson.Veiculo, error) {
+	dados, erro := repositorio.consultar()
+	if erro != nil {
+		return nil, erro
+	}
+	if dados.Veiculos == nil {
+		return []dataJson.Veiculo{}, nil
+	}
+	return dados.Veiculos, nil
+}
+
+func (repositorio *repositorio) CadastrarSenhaVeiculo(placa string, senha dataJson.SenhaVeiculo) error {
+	return repositorio.atualizar(func(dados *dataJson.DadosVeiculos) error {
+		veiculo := buscarOuCriarVeiculo(dados, placa)
+		if veiculo.Senha != nil {
+			return dataJson.ErrSenhaJaCadastrada
+		}
+		veiculo.Senha = &senha
+		return nil
+	})
+}
+
+func (repositorio *repositorio) CadastrarVeiculo(placa string, senha dataJson.SenhaVeiculo) error {
+	return repositorio.atualizar(func(dados *dataJson.DadosVeiculos) error {
+		if buscarVeiculo(dados, placa) != nil {
+			return dataJson.ErrPlacaJaCadastrada
+		}
+		buscarOuCriarVeiculo(dados, placa).Senha = &senha
+		return nil
+	})
+}
+
+func (repositorio *repositorio) RegistrarRecarga(placa string, pontoID int, valor float64) error {
+	if placa == "" {
+		return fmt.Errorf("placa do veículo não pode ser vazia")
+	}
+	if pontoID <= 0 {
+		return fmt.Errorf("ID do ponto de recarga inválido: %d", pontoID)
+	}
+	if valor <= 0 {
+		return fmt.Errorf("valor da recarga deve ser positivo: %.2f", valor)
+	}
+
+	return repositorio.atualizar(func(dados *dataJson.DadosVeiculos) error {
+		veiculo := buscarOuCriarVeiculo(dados, placa)
+		veiculo.Recargas = append(veiculo.Recargas, dataJson.Recarga{
+			Data:    time.Now().Format("2006-01-02 15:04:05"),
+			PontoID: pontoID,
+			Valor:   valor,
+		})
+		return nil
+	})
+}
+
+func (repositorio *repositorio) ObterHistoricoRecargas(placa string) ([]dataJson.Recarga, error) {
+	veiculo, _, erro := repositorio.ObterVeiculo(placa)
+	if erro != nil {
+		return nil, erro
+	}
+	pendentes := []dataJson.Recarga{}
+	for _, recarga := range veiculo.Recargas {
+		if !recarga.Pago {
+			pendentes = append(pendentes, recarga)
+		}
+	}
+	return pendentes, nil
+}
+
+func (repositorio *repositorio) PagarRecargas(placa string) error {
+	return repositorio.atualizar(func(dados *dataJson.DadosVeiculos) error {
+		veiculo := buscarVeiculo(dados, placa)
+		if veiculo == nil {
+			return fmt.Errorf("placa %s: %w", placa, ErrVeiculoNaoEncontrado)
+		}
+		for i := range veiculo.Recargas {
+			veiculo.Recargas[i].Pago = true
+		}
+		return nil
+	})
+}
+
+// Considera também as recargas já pagas
+func (repositorio *repositorio) ObterUltimoReserva(placa string) (int, error) {
+	veiculo, _, erro := repositorio.ObterVeiculo(placa)
+	if erro != nil {
+		return 0, erro
+	}
+	recargas := veiculo.Recargas
+	if len(recargas) == 0 {
+		return 0, fmt.Errorf("placa %s sem recargas: %w", placa, ErrVeiculoNaoEncontrado)
+	}
+	// A última posição do histórico é a recarga mais recente
+	return recargas[len(recargas)-1].PontoID, nil
+}
@@ -0,0 +1,237 @@
+package repositorio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"recarga-inteligente/internal/dataJson"
+	"sync"
+	"testing"
+)
+
+// As duas implementações devem se comportar da mesma forma
+func implementacoes(t *testing.T) map[string]func() VehicleRepository {
+	return map[string]func() VehicleRepository{
+		"json": func() VehicleRepository {
+			return NewRepositorioJSON(filepath.Join(t.TempDir(), "veiculos.json"))
+		},
+		"memoria": NewRepositorioMemoria,
+	}
+}
+
+func TestCadastroDeVeiculos(t *testing.T) {
+	for nome, novo := range implementacoes(t) {
+		t.Run(nome, func(t *testing.T) {
+			veiculos := novo()
+			if existe, erro := veiculos.PlacaJaExiste("ABC1234"); erro != nil || existe {
+				t.Fatalf("placa existe em repositorio vazio: %v %v", existe, erro)
+			}
+			for range 2 {
+				if erro := veiculos.SalvarVeiculo("ABC1234"); erro != nil {
+					t.Fatal(erro)
+				}
+			}
+			veiculo, existe, erro := veiculos.ObterVeiculo("ABC1234")
+			if erro != nil || !existe || veiculo.Placa != "ABC1234" || veiculo.Senha != nil {
+				t.Fatalf("veiculo salvo nao encontrado: %+v %v %v", veiculo, existe, erro)
+			}
+
+			senha := dataJson.SenhaVeiculo{Salt: "00", Hash: "11", Iteracoes: 1}
+			if erro := veiculos.CadastrarSenhaVeiculo("ABC1234", senha); erro != nil {
+				t.Fatal(erro)
+			}
+			if erro := veiculos.CadastrarSenhaVeiculo("ABC1234", senha); !errors.Is(erro, dataJson.ErrSenhaJaCadastrada) {
+				t.Fatalf("esperado ErrSenhaJaCadastrada, recebido %v", erro)
+			}
+			// A senha também cadastra placas novas
+			if erro := veiculos.CadastrarSenhaVeiculo("DEF5G67", senha); erro != nil {
+				t.Fatal(erro)
+			}
+			veiculo, _, _ = veiculos.ObterVeiculo("DEF5G67")
+			if veiculo.Senha == nil || *veiculo.Senha != senha {
+				t.Fatalf("senha nao cadastrada: %+v", veiculo)
+			}
+
+			// O cadastro no primeiro acesso só aceita placas que ainda não existem
+			if erro := veiculos.SalvarVeiculo("GHI8J90"); erro != nil {
+				t.Fatal(erro)
+			}
+			for _, placa := range []string{"ABC1234", "GHI8J90"} {
+				if erro := veiculos.CadastrarVeiculo(placa, senha); !errors.Is(erro, dataJson.ErrPlacaJaCadastrada) {
+					t.Fatalf("%s: esperado ErrPlacaJaCadastrada, recebido %v", placa, erro)
+				}
+			}
+			if veiculo, _, _ := veiculos.ObterVeiculo("GHI8J90"); veiculo.Senha != nil {
+				t.Fatalf("senha cadastrada em placa existente: %+v", veiculo)
+			}
+			if erro := veiculos.CadastrarVeiculo("JKL1M23", senha); erro != nil {
+				t.Fatal(erro)
+			}
+			if veiculo, existe, _ := veiculos.ObterVeiculo("JKL1M23"); !existe || veiculo.Senha == nil || *veiculo.Senha != senha {
+				t.Fatalf("placa nova nao cadastrada: %+v", veiculo)
+			}
+		})
+	}
+}
+
+func TestHistoricoDeRecargas(t *testing.T) {
+	for nome, novo := range implementacoes(t) {
+		t.Run(nome, func(t *testing.T) {
+			veiculos := novo()
+			recargas, erro := veiculos.ObterHistoricoRecargas("ABC1234")
+			if erro != nil || recargas == nil || len(recargas) != 0 {
+				t.Fatalf("historico de veiculo inexistente: %v %v", recargas, erro)
+			}
+			if lista, erro := veiculos.ListarVeiculos(); erro != nil || lista == nil || len(lista) != 0 {
+				t.Fatalf("lista de repositorio vazio: %v %v", lista, erro)
+			}
+			if _, erro := veiculos.ObterUltimoReserva("ABC1234"); !errors.Is(erro, ErrVeiculoNaoEncontrado) {
+				t.Fatalf("esperado ErrVeiculoNaoEncontrado, recebido %v", erro)
+			}
+			if erro := veiculos.PagarRecargas("ABC1234"); !errors.Is(erro, ErrVeiculoNaoEncontrado) {
+				t.Fatalf("esperado ErrVeiculoNaoEncontrado, recebido %v", erro)
+			}
+
+			for _, invalida := range []struct {
+				placa   string
+				pontoID int
+				valor   float64
+			}{{"", 1, 10}, {"ABC1234", 0, 10}, {"ABC1234", 1, 0}} {
+				if veiculos.RegistrarRecarga(invalida.placa, invalida.pontoID, invalida.valor) == nil {
+					t.Fatalf("recarga invalida aceita: %+v", invalida)
+				}
+			}
+
+			if erro := veiculos.RegistrarRecarga("ABC1234", 2, 30); erro != nil {
+				t.Fatal(erro)
+			}
+			if erro := veiculos.RegistrarRecarga("ABC1234", 5, 12.5); erro != nil {
+				t.Fatal(erro)
+			}
+			recargas, _ = veiculos.ObterHistoricoRecargas("ABC1234")
+			if len(recargas) != 2 || recargas[0].PontoID != 2 || recargas[1].Valor != 12.5 || recargas[1].Data == "" {
+				t.Fatalf("historico inesperado: %+v", recargas)
+			}
+			// Alterar o histórico retornado não altera o guardado
+			recargas[0].Valor = 0
+			if ultimo, erro := veiculos.ObterUltimoReserva("ABC1234"); erro != nil || ultimo != 5 {
+				t.Fatalf("ultima reserva: %d %v", ultimo, erro)
+			}
+			if recargas, _ := veiculos.ObterHistoricoRecargas("ABC1234"); recargas[0].Valor != 30 {
+				t.Fatalf("historico alterado por quem o leu: %+v", recargas)
+			}
+			if lista, erro := veiculos.ListarVeiculos(); erro != nil || len(lista) != 1 || len(lista[0].Recargas) != 2 {
+				t.Fatalf("lista de veiculos inesperada: %+v %v", lista, erro)
+			}
+
+			if erro := veiculos.PagarRecargas("ABC1234"); erro != nil {
+				t.Fatal(erro)
+			}
+			if recargas, _ := veiculos.ObterHistoricoRecargas("ABC1234"); len(recargas) != 0 {
+				t.Fatalf("historico nao foi limpo: %+v", recargas)
+			}
+			// As recargas pagas continuam no cadastro, marcadas, e as novas
+			// entram no histórico a pagar
+			if erro := veiculos.RegistrarRecarga("ABC1234", 3, 8); erro != nil {
+				t.Fatal(erro)
+			}
+			veiculo, _, _ := veiculos.ObterVeiculo("ABC1234")
+			if len(veiculo.Recargas) != 3 || !veiculo.Recargas[0].Pago || !veiculo.Recargas[1].Pago || veiculo.Recargas[2].Pago {
+				t.Fatalf("recargas pagas nao mantidas: %+v", veiculo.Recargas)
+			}
+			if recargas, _ := veiculos.ObterHistoricoRecargas("ABC1234"); len(recargas) != 1 || recargas[0].PontoID != 3 {
+				t.Fatalf("historico depois do pagamento: %+v", recargas)
+			}
+		})
+	}
+}
+
+func TestArquivoJSONPersiste(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "veiculos.json")
+	if erro := NewRepositorioJSON(caminho).RegistrarRecarga("ABC1234", 3, 20); erro != nil {
+		t.Fatal(erro)
+	}
+	if ultimo, erro := NewRepositorioJSON(caminho).ObterUltimoReserva("ABC1234"); erro != nil || ultimo != 3 {
+		t.Fatalf("recarga nao foi lida do arquivo: %d %v", ultimo, erro)
+	}
+}
+
+// Pontos que finalizam ao mesmo tempo não perdem recargas, mesmo com
+// repositórios abertos separadamente sobre o mesmo arquivo
+func TestRecargasConcorrentes(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "veiculos.json")
+	const pontos, recargasPorPonto = 4, 25
+	var grupo sync.WaitGroup
+	for ponto := 1; ponto <= pontos; ponto++ {
+		grupo.Add(1)
+		go func() {
+			defer grupo.Done()
+			veiculos := NewRepositorioJSON(caminho)
+			for range recargasPorPonto {
+				if erro := veiculos.RegistrarRecarga("ABC1234", ponto, 10); erro != nil {
+					t.Error(erro)
+				}
+			}
+		}()
+	}
+	grupo.Wait()
+
+	recargas, erro := NewRepositorioJSON(caminho).ObterHistoricoRecargas("ABC1234")
+	if erro != nil || len(recargas) != pontos*recargasPorPonto {
+		t.Fatalf("esperadas %d recargas, encontradas %d (%v)", pontos*recargasPorPonto, len(recargas), erro)
+	}
+	temporarios, _ := filepath.Glob(filepath.Join(filepath.Dir(caminho), ".*.tmp"))
+	if len(temporarios) != 0 {
+		t.Fatalf("arquivos temporarios deixados: %v", temporarios)
+	}
+}
+
+// Um arquivo truncado é informado e mantido, em vez de ser substituído
+func TestArquivoCorrompidoMantido(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "veiculos.json")
+	truncado := []byte(`{"veiculos": [{"placa": "ABC1234", "recargas": [{"data": "2025-`)
+	if erro := os.WriteFile(caminho, truncado, 0644); erro != nil {
+		t.Fatal(erro)
+	}
+	veiculos := NewRepositorioJSON(caminho)
+	if erro := veiculos.RegistrarRecarga("DEF5G67", 1, 10); !errors.Is(erro, ErrArquivoCorrompido) {
+		t.Fatalf("esperado ErrArquivoCorrompido, recebido %v", erro)
+	}
+	if _, erro := veiculos.ObterHistoricoRecargas("ABC1234"); !errors.Is(erro, ErrArquivoCorrompido) {
+		t.Fatalf("esperado ErrArquivoCorrompido, recebido %v", erro)
+	}
+	if conteudo, _ := os.ReadFile(caminho); !bytes.Equal(conteudo, truncado) {
+		t.Fatalf("arquivo corrompido foi alterado: %s", conteudo)
+	}
+}
+
+// Arquivos sem versão são migrados ao carregar e gravados na versão atual;
+// arquivos de uma versão mais nova não são lidos nem sobrescritos
+func TestArquivoJSONVersionado(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "veiculos.json")
+	os.WriteFile(caminho, []byte(`{"veiculos": [{"placa": "ABC1234", "recargas": [{"ponto_id": 2, "valor": 30}]}]}`), 0644)
+	veiculos := NewRepositorioJSON(caminho)
+	if ultimo, erro := veiculos.ObterUltimoReserva("ABC1234"); erro != nil || ultimo != 2 {
+		t.Fatalf("arquivo sem versao nao foi lido: %d %v", ultimo, erro)
+	}
+	if erro := veiculos.SalvarVeiculo("DEF5G67"); erro != nil {
+		t.Fatal(erro)
+	}
+	var dados dataJson.DadosVeiculos
+	conteudo, _ := os.ReadFile(caminho)
+	if erro := json.Unmarshal(conteudo, &dados); erro != nil || dados.Versao != dataJson.VersaoAtual(dataJson.ArquivoVeiculos) {
+		t.Fatalf("arquivo gravado sem a versao atual: %s", conteudo)
+	}
+
+	novo := filepath.Join(t.TempDir(), "veiculos.json")
+	futuro := []byte(`{"versao": 99, "veiculos": []}`)
+	os.WriteFile(novo, futuro, 0644)
+	if erro := NewRepositorioJSON(novo).SalvarVeiculo("ABC1234"); !errors.Is(erro, dataJson.ErrVersaoDesconhecida) {
+		t.Fatalf("esperado ErrVersaoDesconhecida, recebido %v", erro)
+	}
+	if conteudo, _ := os.ReadFile(novo); !bytes.Equal(conteudo, futuro) {
+		t.Fatalf("arquivo de versao mais nova foi alterado: %s", conteudo)
+	}
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"recarga-inteligente/internal/dataJson"
+	"time"
+)
+
+// Falhas de autenticação seguidas antes de bloquear a placa, e por quanto tempo
+const (
+	limiteFalhasAutenticacao = 5
+	duracaoBloqueio          = 15 * time.Minute
+)
+
+type tentativasAutenticacao struct {
+	falhas       int
+	bloqueadoAte time.Time
+}
+
+// Marca a conexão como de um veículo que comprovou a sua senha
+func (connection *ConnectionStore) MarcarAutenticado(conexao *dataJson.Conn) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	connection.autenticados[conexao] = true
+}
+
+func (connection *ConnectionStore) VeiculoAutenticado(conexao *dataJson.Conn) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	return connection.autenticados[conexao]
+}
+
+// Retorna até quando a placa está bloqueada, ou false se ela pode tentar se autenticar
+func (connection *ConnectionStore) BloqueioAutenticacao(placa string) (time.Time, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	tentativas, existe := connection.falhasAutenticacao[placa]
+	if !existe || time.Now().After(tentativas.bloqueadoAte) {
+		return time.Time{}, false
+	}
+	return tentativas.bloqueadoAte, true
+}
+
+// Conta uma senha errada para a placa. Ao atingir o limite a placa é
+// bloqueada e o fim do bloqueio é retornado; caso contrário retorna zero.
+func (connection *ConnectionStore) RegistrarFalhaAutenticacao(placa string) time.Time {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	tentativas, existe := connection.falhasAutenticacao[placa]
+	if !existe {
+		tentativas = &tentativasAutenticacao{}
+		connection.falhasAutenticacao[placa] = tentativas
+	}
+	tentativas.falhas++
+	if tentativas.falhas < limiteFalhasAutenticacao {
+		return time.Time{}
+	}
+	tentativas.falhas = 0
+	tentativas.bloqueadoAte = time.Now().Add(duracaoBloqueio)
+	return tentativas.bloqueadoAte
+}
+
+// Zera as falhas da placa após uma autenticação bem-sucedida
+func (connection *ConnectionStore) LimparFalhasAutenticacao(placa string) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	delete(connection.falhasAutenticacao, placa)
+}
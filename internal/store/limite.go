@@ -0,0 +1,183 @@
+package store
+
+import (
+	"math"
+	"recarga-inteligente/internal/dataJson"
+	"time"
+)
+
+// Limite de um tipo de mensagem: até Rajada mensagens seguidas, repostas à
+// razão de Taxa mensagens por segundo
+type RegraLimite struct {
+	Taxa   float64
+	Rajada int
+}
+
+// Intervalo entre as limpezas dos baldes de placas sem uso
+const intervaloLimpezaLimites = time.Minute
+
+// Balde de fichas de uma regra
+type balde struct {
+	fichas      float64
+	atualizacao time.Time
+	regra       RegraLimite // regra com que foi criado, para saber quando volta a ficar cheio
+}
+
+func novoBalde(regra RegraLimite, agora time.Time) *balde {
+	return &balde{fichas: float64(regra.Rajada), atualizacao: agora, regra: regra}
+}
+
+// Um balde cheio equivale a um novo e pode ser descartado
+func (balde *balde) cheio(agora time.Time) bool {
+	decorrido := agora.Sub(balde.atualizacao).Seconds()
+	return balde.fichas+decorrido*balde.regra.Taxa >= float64(balde.regra.Rajada)
+}
+
+// Repõe as fichas acumuladas desde a última atualização
+func (balde *balde) repor(regra RegraLimite, agora time.Time) {
+	decorrido := agora.Sub(balde.atualizacao).Seconds()
+	balde.fichas = math.Min(float64(regra.Rajada), balde.fichas+decorrido*regra.Taxa)
+	balde.atualizacao = agora
+}
+
+// Tempo até o balde ter uma ficha; zero se já tiver
+func (balde *balde) espera(regra RegraLimite) time.Duration {
+	if balde.fichas >= 1 {
+		return 0
+	}
+	if regra.Taxa <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - balde.fichas) / regra.Taxa * float64(time.Second))
+}
+
+func baldeDe(baldes map[string]*balde, tipo string, regra RegraLimite, agora time.Time) *balde {
+	atual, existe := baldes[tipo]
+	if !existe {
+		atual = novoBalde(regra, agora)
+		baldes[tipo] = atual
+	}
+	atual.repor(regra, agora)
+	return atual
+}
+
+// Consome uma ficha do tipo de mensagem no balde da conexão e, se a placa for
+// informada, no balde da placa, compartilhado entre as conexões do veículo.
+// A placa só deve ser informada para veículos autenticados, já que cada
+// placa mantém baldes até eles voltarem a ficar cheios. Se algum dos dois
+// estiver vazio nada é consumido e o tempo até a próxima ficha é retornado
+// com false.
+func (connection *ConnectionStore) ConsumirLimite(conexao *dataJson.Conn, placa string, tipo string, regra RegraLimite) (time.Duration, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	agora := connection.agoraLimites()
+
+	baldesConexao, existe := connection.limitesConexao[conexao]
+	if !existe {
+		baldesConexao = make(map[string]*balde)
+		connection.limitesConexao[conexao] = baldesConexao
+	}
+	baldes := []*balde{baldeDe(baldesConexao, tipo, regra, agora)}
+	if placa != "" {
+		baldes = append(baldes, baldeDe(baldesDaChave(connection.limitesPlaca, placa), tipo, regra, agora))
+	}
+	return consumir(baldes, regra)
+}
+
+// Consome uma ficha do tipo no balde do endereço de um cliente da API HTTP,
+// que não mantém conexão própria
+func (connection *ConnectionStore) ConsumirLimiteEndereco(endereco string, tipo string, regra RegraLimite) (time.Duration, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	agora := connection.agoraLimites()
+	return consumir([]*balde{baldeDe(baldesDaChave(connection.limitesEndereco, endereco), tipo, regra, agora)}, regra)
+}
+
+// Tempo até o balde do endereço ter uma ficha do tipo, sem consumi-la
+func (connection *ConnectionStore) EsperaLimiteEndereco(endereco string, tipo string, regra RegraLimite) time.Duration {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	agora := connection.agoraLimites()
+	return baldeDe(baldesDaChave(connection.limitesEndereco, endereco), tipo, regra, agora).espera(regra)
+}
+
+// Consome uma ficha do tipo no balde da placa de um veículo autenticado pela
+// API HTTP, o mesmo usado pelas conexões do veículo
+func (connection *ConnectionStore) ConsumirLimitePlaca(placa string, tipo string, regra RegraLimite) (time.Duration, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	agora := connection.agoraLimites()
+	return consumir([]*balde{baldeDe(baldesDaChave(connection.limitesPlaca, placa), tipo, regra, agora)}, regra)
+}
+
+// Hora atual para os baldes, limpando os que não são usados quando chega a
+// hora; exige o mutex já travado
+func (connection *ConnectionStore) agoraLimites() time.Time {
+	agora := time.Now()
+	if agora.Sub(connection.ultimaLimpezaLimites) >= intervaloLimpezaLimites {
+		connection.limparLimites(agora)
+	}
+	return agora
+}
+
+func baldesDaChave(limites map[string]map[string]*balde, chave string) map[string]*balde {
+	baldes, existe := limites[chave]
+	if !existe {
+		baldes = make(map[string]*balde)
+		limites[chave] = baldes
+	}
+	return baldes
+}
+
+// Se algum balde estiver vazio nada é consumido
+func consumir(baldes []*balde, regra RegraLimite) (time.Duration, bool) {
+	var espera time.Duration
+	for _, balde := range baldes {
+		espera = max(espera, balde.espera(regra))
+	}
+	if espera > 0 {
+		return espera, false
+	}
+	for _, balde := range baldes {
+		balde.fichas--
+	}
+	return 0, true
+}
+
+// Descarta os baldes das placas e dos endereços que não são usados há tempo
+// suficiente para voltarem a ficar cheios; exige o mutex já travado
+func (connection *ConnectionStore) limparLimites(agora time.Time) {
+	connection.ultimaLimpezaLimites = agora
+	for _, limites := range []map[string]map[string]*balde{connection.limitesPlaca, connection.limitesEndereco} {
+		for chave, baldes := range limites {
+			cheios := true
+			for _, balde := range baldes {
+				cheios = cheios && balde.cheio(agora)
+			}
+			if cheios {
+				delete(limites, chave)
+			}
+		}
+	}
+}
+
+// Conta uma mensagem recusada por excesso. As infrações também são limitadas
+// por um balde: retorna true quando a conexão esgotou as infrações toleradas
+// e deve ser desconectada.
+func (connection *ConnectionStore) RegistrarExcesso(conexao *dataJson.Conn, tolerancia RegraLimite) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	agora := time.Now()
+
+	infracoes, existe := connection.infracoes[conexao]
+	if !existe {
+		infracoes = novoBalde(tolerancia, agora)
+		connection.infracoes[conexao] = infracoes
+	}
+	infracoes.repor(tolerancia, agora)
+	if infracoes.fichas < 1 {
+		return true
+	}
+	infracoes.fichas--
+	return false
+}
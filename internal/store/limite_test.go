@@ -0,0 +1,88 @@
+package store
+
+import (
+	"math"
+	"net"
+	"recarga-inteligente/internal/dataJson"
+	"testing"
+	"time"
+)
+
+func TestLimitesPlacaDescartados(t *testing.T) {
+	connectionStore := NewConnectionStore()
+	servidor, cliente := net.Pipe()
+	t.Cleanup(func() {
+		servidor.Close()
+		cliente.Close()
+	})
+	conexao := dataJson.NewConn(servidor)
+	regra := RegraLimite{Taxa: 1, Rajada: 2}
+
+	// Sem placa só a conexão tem balde
+	connectionStore.ConsumirLimite(conexao, "", "localizacao", regra)
+	if len(connectionStore.limitesPlaca) != 0 {
+		t.Fatalf("balde criado sem placa: %v", connectionStore.limitesPlaca)
+	}
+
+	connectionStore.ConsumirLimite(conexao, "ABC1234", "localizacao", regra)
+	connectionStore.ConsumirLimite(conexao, "ABC1234", "reserva", regra)
+	connectionStore.ConsumirLimiteEndereco("192.0.2.1", "ranking", regra)
+	agora := time.Now()
+	connectionStore.limparLimites(agora)
+	if len(connectionStore.limitesPlaca) != 1 || len(connectionStore.limitesEndereco) != 1 {
+		t.Fatal("balde em uso descartado")
+	}
+	// Depois de voltarem a ficar cheios os baldes da placa são descartados
+	connectionStore.limparLimites(agora.Add(2 * time.Second))
+	if len(connectionStore.limitesPlaca) != 0 || len(connectionStore.limitesEndereco) != 0 {
+		t.Fatalf("baldes cheios mantidos: %v %v", connectionStore.limitesPlaca, connectionStore.limitesEndereco)
+	}
+}
+
+func TestBaldeDeFichas(t *testing.T) {
+	regra := RegraLimite{Taxa: 2, Rajada: 3}
+	inicio := time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)
+	balde := novoBalde(regra, inicio)
+
+	// Cada passo repõe as fichas até o instante, confere a espera e, se houver
+	// ficha, consome uma
+	passos := []struct {
+		decorrido time.Duration
+		espera    time.Duration
+		cheio     bool
+	}{
+		{0, 0, true},
+		{0, 0, false},
+		{0, 0, false},
+		{0, 500 * time.Millisecond, false},
+		{250 * time.Millisecond, 250 * time.Millisecond, false},
+		{500 * time.Millisecond, 0, false},
+		// Parado, o balde volta a ficar cheio sem passar da rajada
+		{10 * time.Second, 0, true},
+		{10 * time.Second, 0, false},
+		{10 * time.Second, 0, false},
+		{10 * time.Second, 500 * time.Millisecond, false},
+	}
+	for i, passo := range passos {
+		agora := inicio.Add(passo.decorrido)
+		if cheio := balde.cheio(agora); cheio != passo.cheio {
+			t.Fatalf("passo %d: cheio %v, esperado %v", i, cheio, passo.cheio)
+		}
+		balde.repor(regra, agora)
+		if espera := balde.espera(regra); espera != passo.espera {
+			t.Fatalf("passo %d: espera %v, esperado %v", i, espera, passo.espera)
+		}
+		if passo.espera == 0 {
+			balde.fichas--
+		}
+	}
+
+	// Sem reposição a espera não tem fim
+	parado := RegraLimite{Taxa: 0, Rajada: 1}
+	vazio := novoBalde(parado, inicio)
+	vazio.fichas--
+	vazio.repor(parado, inicio.Add(time.Hour))
+	if espera := vazio.espera(parado); espera != time.Duration(math.MaxInt64) {
+		t.Fatalf("espera com taxa zero: %v", espera)
+	}
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"recarga-inteligente/internal/dataJson"
+	"time"
+)
+
+// Quantidade maxima de notificacoes guardadas para um veiculo desconectado
+const limiteNotificacoesPendentes = 32
+
+// Sessao de um veiculo identificado. Sobrevive a queda da conexao para que o
+// veiculo possa retoma-la com o token recebido na identificacao.
+type sessao struct {
+	placa          string
+	conexao        *dataJson.Conn // nil enquanto o veiculo esta desconectado
+	desconectadaEm time.Time
+	pendentes      []dataJson.Mensagem
+}
+
+func novoToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Abre uma sessão para o veículo, descartando uma sessão anterior da mesma placa
+func (connection *ConnectionStore) CriarSessao(conexao *dataJson.Conn, placa string) string {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if anterior, existe := connection.sessaoDaPlaca[placa]; existe {
+		delete(connection.sessoes, anterior)
+	}
+	token := novoToken()
+	connection.sessoes[token] = &sessao{placa: placa, conexao: conexao}
+	connection.sessaoDaPlaca[placa] = token
+	return token
+}
+
+// Associa a conexão à sessão do token, devolvendo a placa e as notificações
+// pendentes. Se a placa for informada, ela deve ser a mesma da sessão. Uma
+// conexão antiga ainda registrada na sessão é encerrada.
+func (connection *ConnectionStore) RetomarSessao(conexao *dataJson.Conn, token string, placa string) (string, []dataJson.Mensagem, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	sessaoVeiculo, existe := connection.sessoes[token]
+	if !existe || (placa != "" && placa != sessaoVeiculo.placa) {
+		return "", nil, false
+	}
+
+	if antiga := sessaoVeiculo.conexao; antiga != nil && antiga != conexao {
+		sessaoVeiculo.conexao = nil
+		connection.removerConexao(antiga)
+	}
+
+	sessaoVeiculo.conexao = conexao
+	sessaoVeiculo.desconectadaEm = time.Time{}
+	connection.veiculos[conexao] = sessaoVeiculo.placa
+	// O token só é emitido após a autenticação do veículo
+	connection.autenticados[conexao] = true
+
+	pendentes := sessaoVeiculo.pendentes
+	sessaoVeiculo.pendentes = nil
+	return sessaoVeiculo.placa, pendentes, true
+}
+
+// Guarda uma notificação para entrega quando a sessão da placa for retomada.
+// Retorna false se a placa não tiver sessão.
+func (connection *ConnectionStore) GuardarNotificacao(placa string, mensagem dataJson.Mensagem) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	token, existe := connection.sessaoDaPlaca[placa]
+	if !existe {
+		return false
+	}
+	sessaoVeiculo := connection.sessoes[token]
+	sessaoVeiculo.pendentes = append(sessaoVeiculo.pendentes, mensagem)
+	if len(sessaoVeiculo.pendentes) > limiteNotificacoesPendentes {
+		sessaoVeiculo.pendentes = sessaoVeiculo.pendentes[1:]
+	}
+	return true
+}
+
+// Encerra as sessões desconectadas há mais tempo que a validade, retornando as placas
+func (connection *ConnectionStore) ExpirarSessoes(validade time.Duration) []string {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	expiradas := []string{}
+	for token, sessaoVeiculo := range connection.sessoes {
+		if sessaoVeiculo.conexao != nil || time.Since(sessaoVeiculo.desconectadaEm) <= validade {
+			continue
+		}
+		delete(connection.sessoes, token)
+		delete(connection.sessaoDaPlaca, sessaoVeiculo.placa)
+		expiradas = append(expiradas, sessaoVeiculo.placa)
+	}
+	return expiradas
+}
+
+// Marca como desconectada a sessão ligada à conexão; exige o mutex já travado
+func (connection *ConnectionStore) desconectarSessao(conexao *dataJson.Conn) {
+	token, existe := connection.sessaoDaPlaca[connection.veiculos[conexao]]
+	if !existe {
+		return
+	}
+	sessaoVeiculo := connection.sessoes[token]
+	if sessaoVeiculo.conexao == conexao {
+		sessaoVeiculo.conexao = nil
+		sessaoVeiculo.desconectadaEm = time.Now()
+	}
+}
@@ -2,40 +2,52 @@ package store
 
 import (
 	"fmt"
-	"net"
 	"recarga-inteligente/internal/dataJson"
-	"sort"
 	"sync"
+	"time"
 )
 
 type ConnectionStore struct {
 	mutex                 sync.Mutex
-	veiculos              map[net.Conn]string
-	pontosDeRecarga       map[net.Conn]int
-	idsCadastrados        []int
+	veiculos              map[*dataJson.Conn]string
+	pontosDeRecarga       map[*dataJson.Conn]int
 	filasDosPontos        map[int][]dataJson.Veiculo
 	disponibilidadePontos map[int]bool
+	protocolos            map[*dataJson.Conn]dataJson.Protocolo
+	ultimoContato         map[*dataJson.Conn]time.Time
+	sessoes               map[string]*sessao // token -> sessão do veículo
+	sessaoDaPlaca         map[string]string  // placa -> token
+	autenticados          map[*dataJson.Conn]bool
+	falhasAutenticacao    map[string]*tentativasAutenticacao   // placa -> falhas recentes
+	operadores            map[*dataJson.Conn]string            // conexão -> nome do operador
+	limitesConexao        map[*dataJson.Conn]map[string]*balde // conexão -> tipo de mensagem -> balde
+	limitesPlaca          map[string]map[string]*balde         // placa -> tipo de mensagem -> balde
+	limitesEndereco       map[string]map[string]*balde         // endereço de cliente da API HTTP -> tipo -> balde
+	ultimaLimpezaLimites  time.Time
+	infracoes             map[*dataJson.Conn]*balde
 }
 
 func NewConnectionStore() *ConnectionStore {
-	total := dataJson.GetTotalPontosJson()
-	idsJson := make([]int, 0, total)
-	for i := 1; i <= total; i++ {
-		idsJson = append(idsJson, i)
-	}
-
 	return &ConnectionStore{
-		veiculos:        make(map[net.Conn]string),
-		pontosDeRecarga: make(map[net.Conn]int),
-
-		idsCadastrados: idsJson,
-
+		veiculos:              make(map[*dataJson.Conn]string),
+		pontosDeRecarga:       make(map[*dataJson.Conn]int),
 		filasDosPontos:        make(map[int][]dataJson.Veiculo),
 		disponibilidadePontos: make(map[int]bool),
+		protocolos:            make(map[*dataJson.Conn]dataJson.Protocolo),
+		ultimoContato:         make(map[*dataJson.Conn]time.Time),
+		sessoes:               make(map[string]*sessao),
+		sessaoDaPlaca:         make(map[string]string),
+		autenticados:          make(map[*dataJson.Conn]bool),
+		falhasAutenticacao:    make(map[string]*tentativasAutenticacao),
+		operadores:            make(map[*dataJson.Conn]string),
+		limitesConexao:        make(map[*dataJson.Conn]map[string]*balde),
+		limitesPlaca:          make(map[string]map[string]*balde),
+		limitesEndereco:       make(map[string]map[string]*balde),
+		infracoes:             make(map[*dataJson.Conn]*balde),
 	}
 }
 
-func (connection *ConnectionStore) AddVeiculo(conexao net.Conn, placa string) {
+func (connection *ConnectionStore) AddVeiculo(conexao *dataJson.Conn, placa string) {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
@@ -48,19 +60,21 @@ func (connection *ConnectionStore) AddVeiculo(conexao net.Conn, placa string) {
 	}
 }
 
-func (connection *ConnectionStore) AddPontoRecarga(conexao net.Conn) int {
+// Registra o ponto com o ID com que ele se identificou, já conferido com o
+// cadastro de regiao.json. Retorna false se o ID ja estiver em uso.
+func (connection *ConnectionStore) AddPontoRecargaComID(conexao *dataJson.Conn, id int) bool {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
-	if len(connection.idsCadastrados) == 0 {
-		return -1
+	for _, emUso := range connection.pontosDeRecarga {
+		if emUso == id {
+			return false
+		}
 	}
-	id := connection.idsCadastrados[0]
-	connection.idsCadastrados = connection.idsCadastrados[1:] //remove o id utilizado
 	connection.pontosDeRecarga[conexao] = id
-	return id
+	return true
 }
 
-func (connection *ConnectionStore) GetIdPonto(conexao net.Conn) int {
+func (connection *ConnectionStore) GetIdPonto(conexao *dataJson.Conn) int {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 	id := connection.pontosDeRecarga[conexao]
@@ -74,28 +88,71 @@ func (connection *ConnectionStore) GetTotalPontosConectados() int {
 	return len(connection.pontosDeRecarga)
 }
 
-func (connection *ConnectionStore) RemoveConnection(conexao net.Conn) {
+func (connection *ConnectionStore) RemoveConnection(conexao *dataJson.Conn) {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
+	connection.removerConexao(conexao)
+}
 
-	id, idExiste := connection.pontosDeRecarga[conexao]
-	if idExiste {
-		connection.idsCadastrados = append(connection.idsCadastrados, id) //retorna o id para a lista
-		sort.Ints(connection.idsCadastrados)                              //ordena
-		delete(connection.pontosDeRecarga, conexao)
-	}
+// Limpeza de RemoveConnection; exige o mutex já travado
+func (connection *ConnectionStore) removerConexao(conexao *dataJson.Conn) {
+	connection.desconectarSessao(conexao)
+
+	delete(connection.pontosDeRecarga, conexao)
 	fmt.Printf("Placa removida da conexão: %s\n", connection.veiculos[conexao])
 	delete(connection.veiculos, conexao)
+	delete(connection.protocolos, conexao)
+	delete(connection.ultimoContato, conexao)
+	delete(connection.autenticados, conexao)
+	delete(connection.operadores, conexao)
+	delete(connection.limitesConexao, conexao)
+	delete(connection.infracoes, conexao)
 
 	conexao.Close()
 }
 
+// Registra o protocolo negociado na identificacao da conexão
+func (connection *ConnectionStore) SetProtocolo(conexao *dataJson.Conn, protocolo dataJson.Protocolo) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	connection.protocolos[conexao] = protocolo
+	connection.ultimoContato[conexao] = time.Now()
+}
+
+// Retorna o protocolo negociado pela conexão, se ela já se identificou
+func (connection *ConnectionStore) GetProtocolo(conexao *dataJson.Conn) (dataJson.Protocolo, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	protocolo, existe := connection.protocolos[conexao]
+	return protocolo, existe
+}
+
+// Registra que uma conexão identificada deu sinal de vida
+func (connection *ConnectionStore) RegistrarContato(conexao *dataJson.Conn) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	if _, identificada := connection.protocolos[conexao]; identificada {
+		connection.ultimoContato[conexao] = time.Now()
+	}
+}
+
+// Retorna o instante do último contato de cada conexão identificada
+func (connection *ConnectionStore) GetUltimosContatos() map[*dataJson.Conn]time.Time {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	contatos := make(map[*dataJson.Conn]time.Time, len(connection.ultimoContato))
+	for conexao, instante := range connection.ultimoContato {
+		contatos[conexao] = instante
+	}
+	return contatos
+}
+
 // Retorna um mapa de todas as conexões de pontos de recarga
-func (connection *ConnectionStore) GetPontosMap() map[net.Conn]int {
+func (connection *ConnectionStore) GetPontosMap() map[*dataJson.Conn]int {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
-	pontosCopy := make(map[net.Conn]int)
+	pontosCopy := make(map[*dataJson.Conn]int)
 	for conn, id := range connection.pontosDeRecarga {
 		pontosCopy[conn] = id
 	}
@@ -103,8 +160,36 @@ func (connection *ConnectionStore) GetPontosMap() map[net.Conn]int {
 	return pontosCopy
 }
 
+// Retorna um mapa de todas as conexões de veículos com a sua placa
+func (connection *ConnectionStore) GetVeiculosMap() map[*dataJson.Conn]string {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	veiculosCopy := make(map[*dataJson.Conn]string)
+	for conn, placa := range connection.veiculos {
+		veiculosCopy[conn] = placa
+	}
+
+	return veiculosCopy
+}
+
+// Registra a conexão como de um operador autenticado
+func (connection *ConnectionStore) AddOperador(conexao *dataJson.Conn, nome string) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	connection.operadores[conexao] = nome
+}
+
+// Retorna o nome do operador da conexão, ou false se ela não for de um operador
+func (connection *ConnectionStore) GetOperador(conexao *dataJson.Conn) (string, bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	nome, existe := connection.operadores[conexao]
+	return nome, existe
+}
+
 // Retorna a conexão de um ponto pelo seu ID
-func (connection *ConnectionStore) GetConexaoPorID(id int) net.Conn {
+func (connection *ConnectionStore) GetConexaoPorID(id int) *dataJson.Conn {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
@@ -117,13 +202,13 @@ func (connection *ConnectionStore) GetConexaoPorID(id int) net.Conn {
 	return nil
 }
 
-func (connection *ConnectionStore) GetVeiculoPlaca(conexao net.Conn) string {
+func (connection *ConnectionStore) GetVeiculoPlaca(conexao *dataJson.Conn) string {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 	return connection.veiculos[conexao]
 }
 
-func (connection *ConnectionStore) GetConexaoPorPlaca(placa string) net.Conn {
+func (connection *ConnectionStore) GetConexaoPorPlaca(placa string) *dataJson.Conn {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
@@ -149,6 +234,8 @@ func (connection *ConnectionStore) GetTodasPlacasAtivas() []string {
 }
 
 func (connection *ConnectionStore) GetFilaPorPonto(pontoID int) []dataJson.Veiculo {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
 	return connection.filasDosPontos[pontoID]
 }
 
@@ -192,7 +279,7 @@ func (c *ConnectionStore) VeiculoEstaEmFila(placa string) bool {
 	return false
 }
 
-func (connection *ConnectionStore) PlacaJaEmUso(placa string, conexaoAtual net.Conn) bool {
+func (connection *ConnectionStore) PlacaJaEmUso(placa string, conexaoAtual *dataJson.Conn) bool {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
@@ -204,7 +291,7 @@ func (connection *ConnectionStore) PlacaJaEmUso(placa string, conexaoAtual net.C
 	return false
 }
 
-func (connection *ConnectionStore) RemoverPlacaAtiva(conexao net.Conn) {
+func (connection *ConnectionStore) RemoverPlacaAtiva(conexao *dataJson.Conn) {
 	connection.mutex.Lock()
 	defer connection.mutex.Unlock()
 
@@ -1,30 +1,78 @@
 package tcpIP
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"recarga-inteligente/internal/dataJson"
 )
 
-func ConnectToServerTCP(serverAddress string) (net.Conn, error) {
-	conexao, erro := net.Dial("tcp", serverAddress)
+// Erro devolvido quando o servidor recusa a identificacao do cliente
+type ErroIdentificacaoRecusada struct {
+	Recusa dataJson.IdentificacaoRecusada
+}
+
+func (erro *ErroIdentificacaoRecusada) Error() string {
+	return fmt.Sprintf("identificacao recusada pelo servidor: %s", erro.Recusa.Motivo)
+}
+
+// Conecta ao servidor. Com tlsConfig nil a conexao trafega em TCP sem criptografia.
+func ConnectToServerTCP(serverAddress string, tlsConfig *tls.Config) (*dataJson.Conn, error) {
+	var conexao net.Conn
+	var erro error
+	if tlsConfig != nil {
+		conexao, erro = tls.Dial("tcp", serverAddress, tlsConfig)
+	} else {
+		conexao, erro = net.Dial("tcp", serverAddress)
+	}
 	if erro != nil {
 		return nil, fmt.Errorf("erro ao conectar ao servidor: %v", erro)
 	}
-	return conexao, nil
+	return dataJson.NewConn(conexao), nil
 }
 
-func SendIdentification(conexao net.Conn, origem string) error {
-	msg := dataJson.Mensagem{
-		Tipo:     "identificacao",
-		Conteudo: fmt.Sprintf("%s conectado", origem),
-		Origem:   origem,
+// Envia a identificacao anunciando as versoes e recursos suportados e aguarda
+// a aceitacao com o protocolo escolhido pelo servidor. Deve ser chamada antes
+// do Dispatcher comecar a ler a conexao.
+func SendIdentification(conexao *dataJson.Conn, origem string, identificacao dataJson.Identificacao) (dataJson.IdentificacaoAceita, error) {
+	identificacao.Versoes = dataJson.VersoesSuportadas()
+	identificacao.Recursos = dataJson.RecursosSuportados()
+
+	pedido, erro := dataJson.NewMensagem("identificacao", origem, identificacao)
+	if erro != nil {
+		return dataJson.IdentificacaoAceita{}, fmt.Errorf("erro ao enviar identificacao: %v", erro)
 	}
+	pedido.ID = conexao.NextID()
 
-	erro := dataJson.SendMessage(conexao, msg)
+	erro = dataJson.SendMessage(conexao, pedido)
 	if erro != nil {
-		return fmt.Errorf("erro ao enviar identificacao: %v", erro)
+		return dataJson.IdentificacaoAceita{}, fmt.Errorf("erro ao enviar identificacao: %v", erro)
 	}
 
-	return nil
+	for {
+		resposta, erro := dataJson.ReceiveMessage(conexao)
+		if erro != nil {
+			return dataJson.IdentificacaoAceita{}, fmt.Errorf("erro ao receber resposta da identificacao: %v", erro)
+		}
+		if resposta.ReplyTo != pedido.ID {
+			continue
+		}
+
+		switch resposta.Tipo {
+		case "identificacao-aceita":
+			var aceita dataJson.IdentificacaoAceita
+			erro = resposta.DecodeDados(&aceita)
+			if erro != nil {
+				return dataJson.IdentificacaoAceita{}, erro
+			}
+			conexao.SetCodec(dataJson.CodecDoProtocolo(aceita.Protocolo()))
+			return aceita, nil
+		case "identificacao-recusada":
+			var recusa dataJson.IdentificacaoRecusada
+			resposta.DecodeDados(&recusa)
+			return dataJson.IdentificacaoAceita{}, &ErroIdentificacaoRecusada{Recusa: recusa}
+		default:
+			return dataJson.IdentificacaoAceita{}, fmt.Errorf("resposta inesperada a identificacao: %s", resposta.Tipo)
+		}
+	}
 }
@@ -0,0 +1,180 @@
+package tcpIP
+
+import (
+	"errors"
+	"fmt"
+	"recarga-inteligente/internal/dataJson"
+	"recarga-inteligente/internal/logger"
+	"sync"
+	"time"
+)
+
+// Tempo maximo de espera pela resposta de uma requisicao
+const tempoLimiteRequisicao = 30 * time.Second
+
+var ErrConexaoEncerrada = errors.New("conexao encerrada")
+
+// Erro devolvido por Request quando o servidor recusa a mensagem pelo limite de taxa
+type ErroLimiteExcedido struct {
+	Limite dataJson.LimiteExcedido
+}
+
+func (erro *ErroLimiteExcedido) Error() string {
+	espera := time.Duration(erro.Limite.TentarEmMs) * time.Millisecond
+	return fmt.Sprintf("limite de mensagens %s excedido, tente novamente em %s", erro.Limite.Tipo, espera.Round(100*time.Millisecond))
+}
+
+// Erro devolvido por Request quando o servidor recusa o tipo ou o payload da mensagem
+type ErroPedidoInvalido struct {
+	Pedido dataJson.PedidoInvalido
+}
+
+func (erro *ErroPedidoInvalido) Error() string {
+	if erro.Pedido.Campo != "" {
+		return fmt.Sprintf("pedido %s recusado pelo servidor: campo %s %s", erro.Pedido.Tipo, erro.Pedido.Campo, erro.Pedido.Motivo)
+	}
+	return fmt.Sprintf("pedido %s recusado pelo servidor: %s", erro.Pedido.Tipo, erro.Pedido.Motivo)
+}
+
+// Dispatcher e o unico leitor de uma conexao no lado do cliente. Respostas
+// (mensagens com ReplyTo) sao entregues a requisicao pendente correspondente;
+// mensagens espontaneas do servidor vao para os tratadores inscritos por Tipo.
+type Dispatcher struct {
+	conexao   *dataJson.Conn
+	logger    *logger.Logger
+	mutex     sync.Mutex
+	pendentes map[uint64]chan dataJson.Mensagem
+	handlers  map[string]func(dataJson.Mensagem)
+	encerrado chan struct{}
+}
+
+func NewDispatcher(conexao *dataJson.Conn, logger *logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		conexao:   conexao,
+		logger:    logger,
+		pendentes: make(map[uint64]chan dataJson.Mensagem),
+		handlers:  make(map[string]func(dataJson.Mensagem)),
+		encerrado: make(chan struct{}),
+	}
+}
+
+// Inscreve um tratador para mensagens espontaneas de um Tipo
+func (dispatcher *Dispatcher) Subscribe(tipo string, handler func(dataJson.Mensagem)) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	dispatcher.handlers[tipo] = handler
+}
+
+func (dispatcher *Dispatcher) Unsubscribe(tipo string) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	delete(dispatcher.handlers, tipo)
+}
+
+// Le mensagens ate a conexao ser encerrada, distribuindo cada uma ao seu destino
+func (dispatcher *Dispatcher) Run() error {
+	defer dispatcher.encerrar()
+	for {
+		msg, erro := dataJson.ReceiveMessage(dispatcher.conexao)
+		if erro != nil {
+			return erro
+		}
+
+		// Heartbeat do servidor, respondido sem passar pelos tratadores
+		if msg.Tipo == "ping" {
+			go dispatcher.Reply(msg, "pong", "", nil)
+			continue
+		}
+
+		dispatcher.mutex.Lock()
+		pendente, ehResposta := dispatcher.pendentes[msg.ReplyTo]
+		if msg.ReplyTo != 0 && ehResposta {
+			delete(dispatcher.pendentes, msg.ReplyTo)
+		}
+		handler := dispatcher.handlers[msg.Tipo]
+		dispatcher.mutex.Unlock()
+
+		if msg.ReplyTo != 0 && ehResposta {
+			pendente <- msg
+			continue
+		}
+		if handler == nil {
+			dispatcher.logger.Info(fmt.Sprintf("Mensagem sem tratador ignorada: %s", msg.Tipo))
+			continue
+		}
+		// Cada tratador roda em sua propria goroutine para nao bloquear a leitura
+		go handler(msg)
+	}
+}
+
+// Canal fechado quando a leitura da conexao termina
+func (dispatcher *Dispatcher) Done() <-chan struct{} {
+	return dispatcher.encerrado
+}
+
+func (dispatcher *Dispatcher) encerrar() {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	close(dispatcher.encerrado)
+	dispatcher.pendentes = make(map[uint64]chan dataJson.Mensagem)
+}
+
+// Envia uma mensagem que nao espera resposta
+func (dispatcher *Dispatcher) Send(tipo string, origem string, dados any) error {
+	return dataJson.SendPayload(dispatcher.conexao, tipo, origem, dados)
+}
+
+// Responde a uma mensagem recebida do servidor
+func (dispatcher *Dispatcher) Reply(pedido dataJson.Mensagem, tipo string, origem string, dados any) error {
+	return dataJson.SendReply(dispatcher.conexao, pedido, tipo, origem, dados)
+}
+
+// Envia uma mensagem e aguarda a resposta correlacionada a ela
+func (dispatcher *Dispatcher) Request(tipo string, origem string, dados any) (dataJson.Mensagem, error) {
+	msg, erro := dataJson.NewMensagem(tipo, origem, dados)
+	if erro != nil {
+		return dataJson.Mensagem{}, erro
+	}
+	msg.ID = dispatcher.conexao.NextID()
+
+	resposta := make(chan dataJson.Mensagem, 1)
+	dispatcher.mutex.Lock()
+	select {
+	case <-dispatcher.encerrado:
+		dispatcher.mutex.Unlock()
+		return dataJson.Mensagem{}, ErrConexaoEncerrada
+	default:
+	}
+	dispatcher.pendentes[msg.ID] = resposta
+	dispatcher.mutex.Unlock()
+
+	defer func() {
+		dispatcher.mutex.Lock()
+		delete(dispatcher.pendentes, msg.ID)
+		dispatcher.mutex.Unlock()
+	}()
+
+	erro = dataJson.SendMessage(dispatcher.conexao, msg)
+	if erro != nil {
+		return dataJson.Mensagem{}, erro
+	}
+
+	select {
+	case recebida := <-resposta:
+		switch recebida.Tipo {
+		case "limite-excedido":
+			var limite dataJson.LimiteExcedido
+			recebida.DecodeDados(&limite)
+			return recebida, &ErroLimiteExcedido{Limite: limite}
+		case "pedido-invalido":
+			var pedido dataJson.PedidoInvalido
+			recebida.DecodeDados(&pedido)
+			return recebida, &ErroPedidoInvalido{Pedido: pedido}
+		}
+		return recebida, nil
+	case <-dispatcher.encerrado:
+		return dataJson.Mensagem{}, ErrConexaoEncerrada
+	case <-time.After(tempoLimiteRequisicao):
+		return dataJson.Mensagem{}, fmt.Errorf("tempo esgotado aguardando resposta de %s", tipo)
+	}
+}
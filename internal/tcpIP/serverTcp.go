@@ -1,14 +1,23 @@
 package tcpIP
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"recarga-inteligente/internal/dataJson"
 	"recarga-inteligente/internal/handler"
 	"recarga-inteligente/internal/logger"
+	"recarga-inteligente/internal/repositorio"
 	"recarga-inteligente/internal/store"
+	"time"
 )
 
-func StartServerTCP(porta string, connectionStore *store.ConnectionStore, logger *logger.Logger) error {
+// Tempo maximo para concluir o handshake TLS de uma nova conexao
+const tempoLimiteHandshake = 10 * time.Second
+
+// Inicia o servidor na porta informada. Com tlsConfig nil as conexoes
+// trafegam em TCP sem criptografia.
+func StartServerTCP(porta string, tlsConfig *tls.Config, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, logger *logger.Logger) error {
 	listener, erro := net.Listen("tcp", porta)
 
 	if erro != nil {
@@ -17,7 +26,11 @@ func StartServerTCP(porta string, connectionStore *store.ConnectionStore, logger
 	}
 	defer listener.Close()
 
-	logger.Info(fmt.Sprintf("Servidor inicializado escutando na porta %s...", porta))
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	logger.Info(fmt.Sprintf("Servidor inicializado escutando na porta %s (TLS: %t)...", porta, tlsConfig != nil))
 
 	//Aceita conexoes e trata cada uma em uma goroutine
 	for {
@@ -27,6 +40,22 @@ func StartServerTCP(porta string, connectionStore *store.ConnectionStore, logger
 			continue
 		}
 
-		go handler.HandleConnection(novaConexao, connectionStore, logger)
+		go aceitarConexao(novaConexao, connectionStore, veiculos, logger)
+	}
+}
+
+// Conclui o handshake TLS, se houver, antes de tratar a conexao, para que o
+// certificado do cliente ja esteja disponivel na identificacao
+func aceitarConexao(novaConexao net.Conn, connectionStore *store.ConnectionStore, veiculos repositorio.VehicleRepository, logger *logger.Logger) {
+	if conexaoTLS, ehTLS := novaConexao.(*tls.Conn); ehTLS {
+		conexaoTLS.SetDeadline(time.Now().Add(tempoLimiteHandshake))
+		erro := conexaoTLS.Handshake()
+		if erro != nil {
+			logger.Erro(fmt.Sprintf("Falha no handshake TLS com %s: %v", novaConexao.RemoteAddr(), erro))
+			novaConexao.Close()
+			return
+		}
+		conexaoTLS.SetDeadline(time.Time{})
 	}
+	handler.HandleConnection(dataJson.NewConn(novaConexao), connectionStore, veiculos, logger)
 }
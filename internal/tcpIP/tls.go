@@ -0,0 +1,116 @@
+package tcpIP
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Variaveis de ambiente com os arquivos PEM usados pelo TLS. Sem elas a
+// comunicacao segue em TCP sem criptografia.
+const (
+	EnvCertificadoTLS = "TLS_CERT"
+	EnvChaveTLS       = "TLS_KEY"
+	EnvCATLS          = "TLS_CA"
+)
+
+// Arquivos locais de certificado, chave e autoridade certificadora
+type ArquivosTLS struct {
+	Certificado string
+	Chave       string
+	CA          string
+}
+
+func ArquivosTLSDoAmbiente() ArquivosTLS {
+	return ArquivosTLS{
+		Certificado: os.Getenv(EnvCertificadoTLS),
+		Chave:       os.Getenv(EnvChaveTLS),
+		CA:          os.Getenv(EnvCATLS),
+	}
+}
+
+func (arquivos ArquivosTLS) Habilitado() bool {
+	return arquivos.Certificado != "" || arquivos.Chave != "" || arquivos.CA != ""
+}
+
+// Configuracao do servidor: exige certificado proprio e a CA usada para
+// verificar os certificados de cliente apresentados pelos pontos de recarga.
+// Retorna nil se o TLS nao estiver configurado.
+func ServerTLSConfig(arquivos ArquivosTLS) (*tls.Config, error) {
+	if !arquivos.Habilitado() {
+		return nil, nil
+	}
+	if arquivos.Certificado == "" || arquivos.Chave == "" || arquivos.CA == "" {
+		return nil, fmt.Errorf("TLS do servidor exige %s, %s e %s", EnvCertificadoTLS, EnvChaveTLS, EnvCATLS)
+	}
+
+	certificado, erro := tls.LoadX509KeyPair(arquivos.Certificado, arquivos.Chave)
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao carregar certificado do servidor: %v", erro)
+	}
+	autoridades, erro := carregarCA(arquivos.CA)
+	if erro != nil {
+		return nil, erro
+	}
+
+	// Veiculos se conectam sem certificado; a exigencia para pontos de
+	// recarga e feita na identificacao
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificado},
+		ClientCAs:    autoridades,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Configuracao de um cliente: verifica o servidor pela CA informada e, se
+// houver certificado e chave, apresenta-os ao servidor. Retorna nil se o TLS
+// nao estiver configurado.
+func ClientTLSConfig(arquivos ArquivosTLS, serverAddress string) (*tls.Config, error) {
+	if !arquivos.Habilitado() {
+		return nil, nil
+	}
+	if arquivos.CA == "" {
+		return nil, fmt.Errorf("TLS do cliente exige %s", EnvCATLS)
+	}
+	if (arquivos.Certificado == "") != (arquivos.Chave == "") {
+		return nil, fmt.Errorf("%s e %s devem ser informados juntos", EnvCertificadoTLS, EnvChaveTLS)
+	}
+
+	autoridades, erro := carregarCA(arquivos.CA)
+	if erro != nil {
+		return nil, erro
+	}
+	host, _, erro := net.SplitHostPort(serverAddress)
+	if erro != nil {
+		host = serverAddress
+	}
+
+	config := &tls.Config{
+		RootCAs:    autoridades,
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if arquivos.Certificado != "" {
+		certificado, erro := tls.LoadX509KeyPair(arquivos.Certificado, arquivos.Chave)
+		if erro != nil {
+			return nil, fmt.Errorf("erro ao carregar certificado do cliente: %v", erro)
+		}
+		config.Certificates = []tls.Certificate{certificado}
+	}
+	return config, nil
+}
+
+func carregarCA(arquivo string) (*x509.CertPool, error) {
+	conteudo, erro := os.ReadFile(arquivo)
+	if erro != nil {
+		return nil, fmt.Errorf("erro ao ler CA: %v", erro)
+	}
+	autoridades := x509.NewCertPool()
+	if !autoridades.AppendCertsFromPEM(conteudo) {
+		return nil, fmt.Errorf("nenhum certificado valido em %s", arquivo)
+	}
+	return autoridades, nil
+}
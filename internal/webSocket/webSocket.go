@@ -0,0 +1,277 @@
+package webSocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"recarga-inteligente/internal/dataJson"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Implementação mínima do protocolo WebSocket (RFC 6455) do lado do
+// servidor. Cada mensagem WebSocket carrega um quadro do protocolo, de forma
+// que a conexão pode ser usada como dataJson.Transporte.
+
+// GUID fixo da RFC 6455 usado para calcular Sec-WebSocket-Accept
+const guidWebSocket = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Tamanho máximo de uma mensagem recebida, somando seus fragmentos: o mesmo
+// limite dos quadros do protocolo sobre TCP
+const tamanhoMaximoMensagem = dataJson.TamanhoMaximoQuadro
+
+// Códigos de operação dos quadros WebSocket
+const (
+	opContinuacao = 0x0
+	opTexto       = 0x1
+	opBinario     = 0x2
+	opFechar      = 0x8
+	opPing        = 0x9
+	opPong        = 0xA
+)
+
+// Códigos de status enviados ao fechar a conexão
+const (
+	statusNormal         = 1000
+	statusErroProtocolo  = 1002
+	statusMensagemGrande = 1009
+)
+
+var ErrProtocolo = errors.New("quadro WebSocket inválido")
+
+// Conexão WebSocket já estabelecida
+type Conn struct {
+	conexao      net.Conn
+	leitor       *bufio.Reader
+	estadoTLS    *tls.ConnectionState
+	mutexEscrita sync.Mutex
+	fechar       sync.Once
+}
+
+// Conclui o handshake WebSocket da requisição e assume a conexão HTTP.
+// Em caso de erro a resposta HTTP já foi enviada ao cliente.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !contemToken(r.Header.Get("Connection"), "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "requisição não é um upgrade para WebSocket", http.StatusBadRequest)
+		return nil, fmt.Errorf("requisição sem upgrade para WebSocket")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "versão do WebSocket não suportada", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("versão do WebSocket não suportada: %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	chave := r.Header.Get("Sec-WebSocket-Key")
+	if decodificada, erro := base64.StdEncoding.DecodeString(chave); erro != nil || len(decodificada) != 16 {
+		http.Error(w, "Sec-WebSocket-Key inválida", http.StatusBadRequest)
+		return nil, fmt.Errorf("Sec-WebSocket-Key inválida: %q", chave)
+	}
+
+	conexao, buffer, erro := http.NewResponseController(w).Hijack()
+	if erro != nil {
+		http.Error(w, "erro ao assumir a conexão", http.StatusInternalServerError)
+		return nil, fmt.Errorf("erro ao assumir a conexão: %v", erro)
+	}
+
+	resposta := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + chaveAceita(chave) + "\r\n\r\n"
+	if _, erro := conexao.Write([]byte(resposta)); erro != nil {
+		conexao.Close()
+		return nil, fmt.Errorf("erro ao concluir o handshake: %v", erro)
+	}
+
+	return &Conn{
+		conexao:   conexao,
+		leitor:    buffer.Reader,
+		estadoTLS: r.TLS,
+	}, nil
+}
+
+func chaveAceita(chave string) string {
+	hash := sha1.Sum([]byte(chave + guidWebSocket))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Indica se o cabeçalho, uma lista separada por vírgulas, contém o token
+func contemToken(cabecalho string, token string) bool {
+	for _, valor := range strings.Split(cabecalho, ",") {
+		if strings.EqualFold(strings.TrimSpace(valor), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lê a próxima mensagem de dados, juntando seus fragmentos. Pings são
+// respondidos automaticamente e um pedido de fechamento encerra a leitura
+// com io.EOF.
+func (conn *Conn) ReadFrame() ([]byte, error) {
+	var mensagem []byte
+	fragmentada := false
+
+	for {
+		fim, opcode, dados, erro := conn.lerQuadro()
+		if erro != nil {
+			if errors.Is(erro, ErrProtocolo) {
+				conn.enviarFechamento(statusErroProtocolo)
+			}
+			return nil, erro
+		}
+
+		switch opcode {
+		case opPing:
+			if erro := conn.escreverQuadro(opPong, dados); erro != nil {
+				return nil, erro
+			}
+			continue
+		case opPong:
+			continue
+		case opFechar:
+			status := uint16(statusNormal)
+			if len(dados) >= 2 {
+				status = binary.BigEndian.Uint16(dados)
+			}
+			conn.enviarFechamento(status)
+			return nil, io.EOF
+		case opTexto, opBinario:
+			if fragmentada {
+				conn.enviarFechamento(statusErroProtocolo)
+				return nil, fmt.Errorf("%w: nova mensagem antes do fim da anterior", ErrProtocolo)
+			}
+		case opContinuacao:
+			if !fragmentada {
+				conn.enviarFechamento(statusErroProtocolo)
+				return nil, fmt.Errorf("%w: continuação sem mensagem iniciada", ErrProtocolo)
+			}
+		default:
+			conn.enviarFechamento(statusErroProtocolo)
+			return nil, fmt.Errorf("%w: opcode %#x desconhecido", ErrProtocolo, opcode)
+		}
+
+		if len(mensagem)+len(dados) > tamanhoMaximoMensagem {
+			conn.enviarFechamento(statusMensagemGrande)
+			return nil, fmt.Errorf("mensagem WebSocket maior que %d bytes", tamanhoMaximoMensagem)
+		}
+		mensagem = append(mensagem, dados...)
+		if fim {
+			return mensagem, nil
+		}
+		fragmentada = true
+	}
+}
+
+// Lê um quadro do cliente, removendo a máscara do conteúdo
+func (conn *Conn) lerQuadro() (bool, byte, []byte, error) {
+	var cabecalho [2]byte
+	if _, erro := io.ReadFull(conn.leitor, cabecalho[:]); erro != nil {
+		return false, 0, nil, erro
+	}
+
+	fim := cabecalho[0]&0x80 != 0
+	opcode := cabecalho[0] & 0x0F
+	mascarado := cabecalho[1]&0x80 != 0
+	tamanho := uint64(cabecalho[1] & 0x7F)
+
+	if cabecalho[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: bits reservados em uso", ErrProtocolo)
+	}
+	if !mascarado {
+		return false, 0, nil, fmt.Errorf("%w: quadro do cliente sem máscara", ErrProtocolo)
+	}
+	if opcode >= opFechar && (!fim || tamanho > 125) {
+		return false, 0, nil, fmt.Errorf("%w: quadro de controle fragmentado ou grande demais", ErrProtocolo)
+	}
+
+	switch tamanho {
+	case 126:
+		var estendido [2]byte
+		if _, erro := io.ReadFull(conn.leitor, estendido[:]); erro != nil {
+			return false, 0, nil, erro
+		}
+		tamanho = uint64(binary.BigEndian.Uint16(estendido[:]))
+	case 127:
+		var estendido [8]byte
+		if _, erro := io.ReadFull(conn.leitor, estendido[:]); erro != nil {
+			return false, 0, nil, erro
+		}
+		tamanho = binary.BigEndian.Uint64(estendido[:])
+	}
+	if tamanho > tamanhoMaximoMensagem {
+		conn.enviarFechamento(statusMensagemGrande)
+		return false, 0, nil, fmt.Errorf("quadro WebSocket maior que %d bytes", tamanhoMaximoMensagem)
+	}
+
+	var mascara [4]byte
+	if _, erro := io.ReadFull(conn.leitor, mascara[:]); erro != nil {
+		return false, 0, nil, erro
+	}
+	dados := make([]byte, tamanho)
+	if _, erro := io.ReadFull(conn.leitor, dados); erro != nil {
+		return false, 0, nil, fmt.Errorf("quadro incompleto: %w", erro)
+	}
+	for i := range dados {
+		dados[i] ^= mascara[i%4]
+	}
+	return fim, opcode, dados, nil
+}
+
+// Envia o quadro como uma única mensagem: texto quando o conteúdo é UTF-8
+// válido, como no codec JSON, e binária caso contrário
+func (conn *Conn) WriteFrame(dados []byte) error {
+	opcode := byte(opBinario)
+	if utf8.Valid(dados) {
+		opcode = opTexto
+	}
+	return conn.escreverQuadro(opcode, dados)
+}
+
+// Escreve um quadro sem máscara, como exige a RFC para o servidor
+func (conn *Conn) escreverQuadro(opcode byte, dados []byte) error {
+	quadro := make([]byte, 0, 10+len(dados))
+	quadro = append(quadro, 0x80|opcode)
+	switch {
+	case len(dados) <= 125:
+		quadro = append(quadro, byte(len(dados)))
+	case len(dados) <= 0xFFFF:
+		quadro = append(quadro, 126)
+		quadro = binary.BigEndian.AppendUint16(quadro, uint16(len(dados)))
+	default:
+		quadro = append(quadro, 127)
+		quadro = binary.BigEndian.AppendUint64(quadro, uint64(len(dados)))
+	}
+	quadro = append(quadro, dados...)
+
+	conn.mutexEscrita.Lock()
+	defer conn.mutexEscrita.Unlock()
+	_, erro := conn.conexao.Write(quadro)
+	return erro
+}
+
+// Envia o quadro de fechamento uma única vez
+func (conn *Conn) enviarFechamento(status uint16) {
+	conn.fechar.Do(func() {
+		conn.escreverQuadro(opFechar, binary.BigEndian.AppendUint16(nil, status))
+	})
+}
+
+func (conn *Conn) EstadoTLS() *tls.ConnectionState {
+	return conn.estadoTLS
+}
+
+func (conn *Conn) RemoteAddr() net.Addr {
+	return conn.conexao.RemoteAddr()
+}
+
+func (conn *Conn) Close() error {
+	conn.enviarFechamento(statusNormal)
+	return conn.conexao.Close()
+}